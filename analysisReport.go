@@ -0,0 +1,220 @@
+package ryde
+
+import (
+	_ "embed"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"runtime/debug"
+	"slices"
+	"sort"
+	"time"
+)
+
+const (
+	ANALYSIS_REPORT_VERSION = "1.0.0" // The version of the AnalysisReport format, the major version changes when fields are removed or change meaning.
+	ANALYSIS_REPORT_SCHEMA  = "https://github.com/onasunnymorning/ryde/blob/main/analysisReport.schema.json"
+	RYDE_MODULE_PATH        = "github.com/onasunnymorning/ryde"
+)
+
+// AnalysisReportSchema is the JSON schema of the AnalysisReport.
+//
+//go:embed analysisReport.schema.json
+var AnalysisReportSchema []byte
+
+// Version is the version of ryde in the analysis report. Set it when building with -ldflags "-X github.com/onasunnymorning/ryde.Version=v1.2.3",
+// otherwise the version of the module in the build info is used.
+var Version string
+
+// ToolVersion returns the version of ryde: Version if set, the version of the ryde module in the build info, or (devel).
+func ToolVersion() string {
+	if Version != "" {
+		return Version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if info.Main.Path == RYDE_MODULE_PATH && info.Main.Version != "" {
+			return info.Main.Version
+		}
+		for _, dep := range info.Deps {
+			if dep.Path == RYDE_MODULE_PATH {
+				return dep.Version
+			}
+		}
+	}
+	return "(devel)"
+}
+
+// AnalysisReport is the report of an analysis, written as JSON to the file with ANALYSYS_FILE_SUFFIX. Its format is described by AnalysisReportSchema.
+type AnalysisReport struct {
+	Schema         string               `json:"$schema"`
+	ReportVersion  string               `json:"reportVersion"`          // ANALYSIS_REPORT_VERSION
+	Tool           ReportTool           `json:"tool"`                   // The tool that wrote the report.
+	StartedAt      time.Time            `json:"startedAt"`              // When the analysis started.
+	FinishedAt     time.Time            `json:"finishedAt"`             // When the analysis finished, after all output files were written.
+	Durations      ReportDurations      `json:"durations"`              // How long the analysis took.
+	Error          string               `json:"error,omitempty"`        // The error that stopped the analysis, empty if it succeeded.
+	Reproducible   bool                 `json:"reproducible,omitempty"` // Set when the times are the watermark of the deposit and the durations zero, see XMLAnalyzer.Reproducible.
+	Input          XMLFile              `json:"input"`                  // The deposit that was analyzed, with its SHA-256 if it was read to the end.
+	Signature      *SignatureResult     `json:"signature,omitempty"`
+	Deposit        XMLDepositUnMarshall `json:"deposit"`
+	Header         XMLHeaderUnMarshall  `json:"header"`
+	Counters       map[string]int       `json:"counters"`                 // The number of objects of every type found in the deposit.
+	Reconciliation []HeaderCountResult  `json:"reconciliation,omitempty"` // The header counts compared with the counters. Split deposits reconcile all parts together, so their parts have none.
+	Outputs        []ReportOutputFile   `json:"outputs"`                  // The output files, with their final sizes.
+	Findings       []Finding            `json:"findings"`
+}
+
+// ReportTool identifies the tool that wrote the report.
+type ReportTool struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// ReportDurations breaks down the duration of the analysis in milliseconds.
+type ReportDurations struct {
+	TotalMs  int64 `json:"totalMs"`  // From the start of the analysis until all output files were written.
+	DecodeMs int64 `json:"decodeMs"` // Reading and decoding the deposit, and writing the records to the sinks.
+	OutputMs int64 `json:"outputMs"` // Writing the orphans, findings and the rest of the output after the deposit was decoded.
+}
+
+// ReportOutputFile is an output file with its final size. Line counts are reported for the line oriented formats: CSV and JSON Lines.
+type ReportOutputFile struct {
+	FileName  string `json:"fileName"`
+	FileSize  int64  `json:"fileSize"`
+	LineCount *int   `json:"lineCount,omitempty"`
+}
+
+// trackingFS records the names of the files the analyzer opens for writing, so they can be listed in the analysis report.
+type trackingFS struct {
+	WritableFS
+	a *XMLAnalyzer
+}
+
+func (t trackingFS) OpenFile(name string, flag int, perm fs.FileMode) (WritableFile, error) {
+	f, err := t.WritableFS.OpenFile(name, flag, perm)
+	if err == nil && !slices.Contains(t.a.outputFiles, name) {
+		t.a.outputFiles = append(t.a.outputFiles, name)
+	}
+	return f, err
+}
+
+// Returns the watermark of the deposit, or the Unix epoch if it has none, as a time that is the same for every analysis of the deposit.
+func (a *XMLAnalyzer) watermarkTime() time.Time {
+	if t := depositTime(a.Deposit.Watermark); t != nil {
+		return *t
+	}
+	return time.Unix(0, 0).UTC()
+}
+
+// Builds the analysis report of the analysis that started at startedAt and ended with err, saves it in Report and writes it to its file.
+func (a *XMLAnalyzer) writeAnalysisReport(startedAt time.Time, err error) error {
+	report, reportErr := a.newAnalysisReport(startedAt, err)
+	if reportErr != nil {
+		return reportErr
+	}
+	a.Report = report
+	flag := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if a.Overwrite == OVERWRITE_FAIL {
+		// Never replace the report of an earlier analysis, also not with the report of a failed one
+		flag |= os.O_EXCL
+	}
+	file, reportErr := a.outputFS().OpenFile(a.GetBaseXMLFileName()+ANALYSYS_FILE_SUFFIX, flag, 0666)
+	if reportErr != nil {
+		return reportErr
+	}
+	defer file.Close()
+	reportErr = report.Write(file)
+	if reportErr != nil {
+		return reportErr
+	}
+	return file.Close()
+}
+
+// Returns the analysis report, with the final sizes of the output files written so far.
+func (a *XMLAnalyzer) newAnalysisReport(startedAt time.Time, err error) (*AnalysisReport, error) {
+	finishedAt := time.Now()
+	decodedAt := a.decodedAt
+	if decodedAt.Before(startedAt) {
+		// The analysis failed before the deposit was decoded
+		decodedAt = finishedAt
+	}
+	report := &AnalysisReport{
+		Schema:        ANALYSIS_REPORT_SCHEMA,
+		ReportVersion: ANALYSIS_REPORT_VERSION,
+		Tool:          ReportTool{"ryde", ToolVersion()},
+		StartedAt:     startedAt.UTC(),
+		FinishedAt:    finishedAt.UTC(),
+		Durations: ReportDurations{
+			TotalMs:  finishedAt.Sub(startedAt).Milliseconds(),
+			DecodeMs: decodedAt.Sub(startedAt).Milliseconds(),
+			OutputMs: finishedAt.Sub(decodedAt).Milliseconds(),
+		},
+		Input:     a.XMLFile,
+		Signature: a.Signature,
+		Deposit:   a.Deposit,
+		Header:    a.Header,
+		Counters:  a.Counters,
+		Outputs:   []ReportOutputFile{},
+		Findings:  a.Findings,
+	}
+	if err != nil {
+		report.Error = err.Error()
+	}
+	if a.part == nil {
+		report.Reconciliation = a.headerCountResults()
+	}
+	if report.Findings == nil {
+		report.Findings = []Finding{}
+	}
+	if a.Reproducible {
+		// The times and durations differ from run to run, the watermark of the deposit does not
+		watermark := a.watermarkTime()
+		report.Reproducible = true
+		report.StartedAt = watermark
+		report.FinishedAt = watermark
+		report.Durations = ReportDurations{}
+	}
+	for _, name := range a.outputFiles {
+		output, err := a.outputFileReport(name)
+		if err != nil {
+			return nil, err
+		}
+		report.Outputs = append(report.Outputs, output)
+	}
+	// The files are listed by name, not in the order the sinks happened to create them
+	sort.Slice(report.Outputs, func(i, j int) bool { return report.Outputs[i].FileName < report.Outputs[j].FileName })
+	return report, nil
+}
+
+// Returns the final size of an output file, and its line count if it is line oriented.
+func (a *XMLAnalyzer) outputFileReport(name string) (ReportOutputFile, error) {
+	output := ReportOutputFile{FileName: name}
+	f, err := a.outputFS().Open(name)
+	if err != nil {
+		return output, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return output, err
+	}
+	output.FileSize = fi.Size()
+	switch path.Ext(name) {
+	case ".csv", ".jsonl":
+		lineCount, err := CountLines(f)
+		if err != nil {
+			return output, err
+		}
+		output.LineCount = &lineCount
+	}
+	return output, nil
+}
+
+// Write writes the report as indented JSON to w.
+func (r *AnalysisReport) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
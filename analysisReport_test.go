@@ -0,0 +1,127 @@
+package ryde
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// TestAnalysisReportSchema tests that the schema describes every field of the AnalysisReport.
+func TestAnalysisReportSchema(t *testing.T) {
+	var schema struct {
+		Required   []string                   `json:"required"`
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+	if err := json.Unmarshal(AnalysisReportSchema, &schema); err != nil {
+		t.Fatalf("Failed to parse the schema: %v", err)
+	}
+	var fields []string
+	rt := reflect.TypeOf(AnalysisReport{})
+	for i := 0; i < rt.NumField(); i++ {
+		fields = append(fields, strings.Split(rt.Field(i).Tag.Get("json"), ",")[0])
+	}
+	var properties []string
+	for name := range schema.Properties {
+		properties = append(properties, name)
+	}
+	sort.Strings(fields)
+	sort.Strings(properties)
+	if !reflect.DeepEqual(fields, properties) {
+		t.Errorf("Expected the schema properties %v, got %v", fields, properties)
+	}
+	for _, name := range schema.Required {
+		if _, ok := schema.Properties[name]; !ok {
+			t.Errorf("Required property %s is not in the schema", name)
+		}
+	}
+}
+
+// Analyzes the deposit and returns the analysis report written to the output.
+func analyzeAndReadReport(t *testing.T, deposit string) (map[string]any, error) {
+	fsys := fstest.MapFS{"test_2019-10-17_FULL_S1_R0.xml": &fstest.MapFile{Data: []byte(deposit)}}
+	a, err := NewXMLAnalyzerFS(fsys, "test_2019-10-17_FULL_S1_R0.xml")
+	if err != nil {
+		t.Fatalf("NewXMLAnalyzerFS returned an error: %v", err)
+	}
+	out := NewMemFS()
+	a.OutputFS = out
+	analyzeErr := a.AnalyzeTags()
+	if a.Report == nil {
+		t.Fatalf("Expected a report, got none")
+	}
+	data, err := out.ReadFile("test_2019-10-17_FULL_S1_R0" + ANALYSYS_FILE_SUFFIX)
+	if err != nil {
+		t.Fatalf("Failed to read the analysis report: %v", err)
+	}
+	var report map[string]any
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatalf("The analysis report is not valid JSON: %v", err)
+	}
+	return report, analyzeErr
+}
+
+// TestAnalyzeTagsAnalysisReport tests that the report has the input hash, the output files and the reconciliation.
+func TestAnalyzeTagsAnalysisReport(t *testing.T) {
+	deposit := getValidFullDepositXMLString()
+	report, err := analyzeAndReadReport(t, deposit)
+	if err != nil {
+		t.Fatalf("AnalyzeTags failed with error: %v", err)
+	}
+	if report["reportVersion"] != ANALYSIS_REPORT_VERSION || report["$schema"] != ANALYSIS_REPORT_SCHEMA {
+		t.Errorf("Unexpected report version %v and schema %v", report["reportVersion"], report["$schema"])
+	}
+	if _, ok := report["error"]; ok {
+		t.Errorf("Expected no error, got %v", report["error"])
+	}
+	sum := sha256.Sum256([]byte(deposit))
+	if input := report["input"].(map[string]any); input["sha256"] != hex.EncodeToString(sum[:]) {
+		t.Errorf("Expected sha256 %x, got %v", sum, input["sha256"])
+	}
+	outputs := map[string]map[string]any{}
+	for _, o := range report["outputs"].([]any) {
+		output := o.(map[string]any)
+		outputs[output["fileName"].(string)] = output
+	}
+	domains, ok := outputs["test_2019-10-17_FULL_S1_R0"+DOMAIN_FILE_SUFFIX]
+	if !ok {
+		t.Fatalf("Expected the domain CSV in the outputs, got %v", outputs)
+	}
+	if domains["lineCount"] != 2.0 || domains["fileSize"].(float64) == 0 {
+		t.Errorf("Expected 2 lines in the domain CSV, got %v", domains)
+	}
+	if findings, ok := outputs["test_2019-10-17_FULL_S1_R0"+FINDINGS_JSON_FILE_SUFFIX]; !ok || findings["lineCount"] != nil {
+		t.Errorf("Expected the findings report without a line count, got %v", findings)
+	}
+	if _, ok := outputs["test_2019-10-17_FULL_S1_R0"+ANALYSYS_FILE_SUFFIX]; ok {
+		t.Errorf("Expected the report not to list itself")
+	}
+	reconciliation, _ := report["reconciliation"].([]any)
+	if len(reconciliation) == 0 {
+		t.Fatalf("Expected reconciliation results, got none")
+	}
+	for _, r := range reconciliation {
+		if r.(map[string]any)["match"] != true {
+			t.Errorf("Expected the header counts to match, got %v", r)
+		}
+	}
+}
+
+// TestAnalyzeTagsAnalysisReportError tests that a failed analysis still writes a report with its error and without a hash.
+func TestAnalyzeTagsAnalysisReportError(t *testing.T) {
+	deposit := getValidFullDepositXMLString()
+	report, err := analyzeAndReadReport(t, deposit[:strings.Index(deposit, "<rdeDomain:domain>")+30])
+	if err == nil {
+		t.Fatalf("Expected an error for a truncated deposit")
+	}
+	if report["error"] != err.Error() {
+		t.Errorf("Expected error %q in the report, got %v", err, report["error"])
+	}
+	if _, ok := report["input"].(map[string]any)["sha256"]; ok {
+		t.Errorf("Expected no sha256 for a deposit that was not read to the end")
+	}
+}
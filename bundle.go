@@ -0,0 +1,244 @@
+package ryde
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+const (
+	BUNDLE_TAR_GZ        = "tar.gz"        // Bundle the output files into a gzip compressed tar archive.
+	BUNDLE_ZIP           = "zip"           // Bundle the output files into a zip archive.
+	BUNDLE_MANIFEST_NAME = "MANIFEST.json" // The name of the manifest member, the last member of the bundle.
+)
+
+// BundleManifest describes the deposit the bundle was made from and every other member of the bundle.
+type BundleManifest struct {
+	Tool    ReportTool     `json:"tool"`
+	Deposit BundleDeposit  `json:"deposit"`
+	Members []BundleMember `json:"members"` // Sorted by name.
+}
+
+// BundleDeposit identifies the deposit the output in the bundle was made from.
+type BundleDeposit struct {
+	ID        string `json:"id"`
+	Type      string `json:"type"`
+	Watermark string `json:"watermark"`
+	FileName  string `json:"fileName"`         // The base name of the input file.
+	SHA256    string `json:"sha256,omitempty"` // The SHA-256 of the input file as it was read, e.g. the compressed or encrypted file.
+}
+
+// BundleMember is an output file in the bundle.
+type BundleMember struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	Rows   *int   `json:"rows,omitempty"` // The number of records in CSV, JSON Lines and Parquet files, not counting header rows.
+	SHA256 string `json:"sha256"`
+}
+
+// bundleWriter adds members to a tar.gz or zip archive.
+type bundleWriter interface {
+	Create(name string, size int64, modTime time.Time) (io.Writer, error)
+	Close() error
+}
+
+type tarGzBundle struct {
+	gz *gzip.Writer
+	tw *tar.Writer
+}
+
+func (b *tarGzBundle) Create(name string, size int64, modTime time.Time) (io.Writer, error) {
+	err := b.tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: name, Size: size, Mode: 0644, ModTime: modTime})
+	return b.tw, err
+}
+
+func (b *tarGzBundle) Close() error {
+	err := b.tw.Close()
+	if err != nil {
+		return err
+	}
+	return b.gz.Close()
+}
+
+type zipBundle struct {
+	zw *zip.Writer
+}
+
+func (b *zipBundle) Create(name string, size int64, modTime time.Time) (io.Writer, error) {
+	return b.zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modTime})
+}
+
+func (b *zipBundle) Close() error {
+	return b.zw.Close()
+}
+
+// Returns the name of the bundle, e.g. deposit-output.tar.gz. The suffix keeps it apart from a deposit that is itself a tar.gz file.
+func (a *XMLAnalyzer) bundleFileName() string {
+	return a.GetBaseXMLFileName() + BUNDLE_FILE_SUFFIX + "." + a.Bundle
+}
+
+// Checks the bundle format.
+func (a *XMLAnalyzer) checkBundle() error {
+	switch a.Bundle {
+	case "", BUNDLE_TAR_GZ, BUNDLE_ZIP:
+		return nil
+	}
+	return fmt.Errorf("%w: %q", ErrUnsupportedBundle, a.Bundle)
+}
+
+// Writes the output files, including the analysis report, into the bundle with a MANIFEST.json as the last member.
+// Afterwards the bundle is the only output file, so it is the only file that is moved out of the staging directory.
+func (a *XMLAnalyzer) writeBundle() error {
+	if a.Bundle == "" {
+		return nil
+	}
+	names := append([]string(nil), a.outputFiles...)
+	sort.Strings(names)
+	// The members get the watermark of the deposit rather than the time of the analysis, so only their contents can differ between runs
+	modTime := a.watermarkTime().Truncate(time.Second)
+
+	file, err := a.outputFS().OpenFile(a.bundleFileName(), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	var bundle bundleWriter
+	if a.Bundle == BUNDLE_ZIP {
+		bundle = &zipBundle{zip.NewWriter(file)}
+	} else {
+		gz := gzip.NewWriter(file)
+		bundle = &tarGzBundle{gz, tar.NewWriter(gz)}
+	}
+
+	manifest := BundleManifest{
+		Tool: ReportTool{"ryde", ToolVersion()},
+		Deposit: BundleDeposit{
+			ID:        a.Deposit.ID,
+			Type:      a.Deposit.Type,
+			Watermark: a.Deposit.Watermark,
+			FileName:  filepath.Base(a.XMLFile.FileName),
+			SHA256:    a.XMLFile.SHA256,
+		},
+		Members: []BundleMember{},
+	}
+	for _, name := range names {
+		member, err := a.addBundleMember(bundle, name, modTime)
+		if err != nil {
+			return err
+		}
+		manifest.Members = append(manifest.Members, member)
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetIndent("", "  ")
+	err = enc.Encode(manifest)
+	if err != nil {
+		return err
+	}
+	w, err := bundle.Create(BUNDLE_MANIFEST_NAME, int64(buf.Len()), modTime)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	err = bundle.Close()
+	if err != nil {
+		return err
+	}
+	err = file.Close()
+	if err != nil {
+		return err
+	}
+	a.outputFiles = []string{a.bundleFileName()}
+	return nil
+}
+
+// Copies an output file into the bundle under its base name and returns its size, SHA-256 and row count.
+func (a *XMLAnalyzer) addBundleMember(bundle bundleWriter, name string, modTime time.Time) (BundleMember, error) {
+	member := BundleMember{Name: path.Base(filepath.ToSlash(name))}
+	f, err := a.outputFS().Open(name)
+	if err != nil {
+		return member, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return member, err
+	}
+	member.Size = fi.Size()
+	w, err := bundle.Create(member.Name, member.Size, modTime)
+	if err != nil {
+		return member, err
+	}
+	hash := sha256.New()
+	lines := &lineCounter{}
+	_, err = io.Copy(io.MultiWriter(w, hash, lines), f)
+	if err != nil {
+		return member, err
+	}
+	member.SHA256 = hex.EncodeToString(hash.Sum(nil))
+
+	switch path.Ext(name) {
+	case ".csv":
+		rows := lines.count
+		if rows > 0 && a.csvHeader(name) {
+			rows--
+		}
+		member.Rows = &rows
+	case ".jsonl":
+		member.Rows = &lines.count
+	case PARQUET_FILE_EXTENSION:
+		r, ok := f.(io.ReaderAt)
+		if !ok {
+			break
+		}
+		pf, err := parquet.OpenFile(r, member.Size)
+		if err != nil {
+			return member, err
+		}
+		rows := int(pf.NumRows())
+		member.Rows = &rows
+	}
+	return member, nil
+}
+
+// Checks if the named CSV file, or shard, starts with a header row.
+func (a *XMLAnalyzer) csvHeader(name string) bool {
+	for _, csvFile := range a.CSVFiles {
+		if csvFile.FileName == name {
+			return csvFile.Header
+		}
+		for _, shard := range csvFile.Shards {
+			if shard.FileName == name {
+				return csvFile.Header
+			}
+		}
+	}
+	return false
+}
+
+// lineCounter counts the lines written to it.
+type lineCounter struct {
+	count int
+}
+
+func (l *lineCounter) Write(p []byte) (int, error) {
+	l.count += bytes.Count(p, []byte("\n"))
+	return len(p), nil
+}
@@ -0,0 +1,195 @@
+package ryde
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Returns the members of a tar.gz or zip bundle by name.
+func readBundle(t *testing.T, format string, data []byte) map[string][]byte {
+	members := map[string][]byte{}
+	if format == BUNDLE_ZIP {
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatalf("Failed to open the zip bundle: %v", err)
+		}
+		for _, f := range zr.File {
+			r, err := f.Open()
+			if err != nil {
+				t.Fatalf("Failed to open %s: %v", f.Name, err)
+			}
+			members[f.Name], _ = io.ReadAll(r)
+			r.Close()
+		}
+		return members
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to open the tar.gz bundle: %v", err)
+	}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Failed to read the tar.gz bundle: %v", err)
+		}
+		members[hdr.Name], _ = io.ReadAll(tr)
+	}
+	return members
+}
+
+// TestAnalyzeTagsBundle tests that all output files end up in the bundle, with a manifest that has their hashes and row counts.
+func TestAnalyzeTagsBundle(t *testing.T) {
+	for _, format := range []string{BUNDLE_TAR_GZ, BUNDLE_ZIP} {
+		t.Run(format, func(t *testing.T) {
+			out := NewMemFS()
+			a := newMemAnalyzer(t, getValidFullDepositXMLString(), out)
+			a.Bundle = format
+			a.Reproducible = true
+			if err := a.AnalyzeTags(); err != nil {
+				t.Fatalf("AnalyzeTags failed with error: %v", err)
+			}
+			bundleName := "deposits/test_2019-10-17_FULL_S1_R0-output." + format
+			if names := out.Names(); len(names) != 1 || names[0] != bundleName {
+				t.Fatalf("Expected only %s, got %v", bundleName, names)
+			}
+			data, _ := out.ReadFile(bundleName)
+			members := readBundle(t, format, data)
+			var manifest BundleManifest
+			if err := json.Unmarshal(members[BUNDLE_MANIFEST_NAME], &manifest); err != nil {
+				t.Fatalf("Failed to parse the manifest: %v", err)
+			}
+			if manifest.Deposit.ID != a.Deposit.ID || manifest.Deposit.Watermark != a.Deposit.Watermark || manifest.Deposit.SHA256 != a.XMLFile.SHA256 || len(a.XMLFile.SHA256) != 64 {
+				t.Errorf("Expected the deposit ID, watermark and hash in the manifest, got %+v", manifest.Deposit)
+			}
+			if len(manifest.Members) != len(members)-1 {
+				t.Errorf("Expected every member but the manifest in the manifest, got %d of %d", len(manifest.Members), len(members))
+			}
+			rows := map[string]int{}
+			for _, m := range manifest.Members {
+				sum := sha256.Sum256(members[m.Name])
+				if hex.EncodeToString(sum[:]) != m.SHA256 || int64(len(members[m.Name])) != m.Size {
+					t.Errorf("Expected the size and SHA-256 of %s in the manifest, got %+v", m.Name, m)
+				}
+				if m.Rows != nil {
+					rows[m.Name] = *m.Rows
+				}
+			}
+			if rows["test_2019-10-17_FULL_S1_R0-domains.csv"] != 2 || rows["test_2019-10-17_FULL_S1_R0-uniqueContactIDs.csv"] != 1 {
+				t.Errorf("Unexpected row counts %v", rows)
+			}
+			if _, ok := rows["test_2019-10-17_FULL_S1_R0"+ANALYSYS_FILE_SUFFIX]; ok || members["test_2019-10-17_FULL_S1_R0"+ANALYSYS_FILE_SUFFIX] == nil {
+				t.Errorf("Expected the analysis report in the bundle without a row count")
+			}
+
+			// The members have the watermark as their time and the report has no timing, so the bundle is byte-identical
+			again := NewMemFS()
+			a = newMemAnalyzer(t, getValidFullDepositXMLString(), again)
+			a.Bundle = format
+			a.Reproducible = true
+			if err := a.AnalyzeTags(); err != nil {
+				t.Fatalf("AnalyzeTags failed with error: %v", err)
+			}
+			if data2, _ := again.ReadFile(bundleName); !bytes.Equal(data, data2) {
+				t.Errorf("Expected a byte-identical bundle in reproducible mode")
+			}
+		})
+	}
+}
+
+// TestAnalyzeTagsBundleModTimes tests that the members of the bundle have the watermark of the deposit as their time, also without Reproducible.
+func TestAnalyzeTagsBundleModTimes(t *testing.T) {
+	watermark := time.Date(2019, 10, 17, 0, 0, 0, 0, time.UTC)
+	for _, format := range []string{BUNDLE_TAR_GZ, BUNDLE_ZIP} {
+		out := NewMemFS()
+		a := newMemAnalyzer(t, getValidFullDepositXMLString(), out)
+		a.Bundle = format
+		if err := a.AnalyzeTags(); err != nil {
+			t.Fatalf("AnalyzeTags failed with error: %v", err)
+		}
+		data, _ := out.ReadFile("deposits/test_2019-10-17_FULL_S1_R0-output." + format)
+		modTimes := map[string]time.Time{}
+		if format == BUNDLE_ZIP {
+			zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				t.Fatalf("Failed to open the zip bundle: %v", err)
+			}
+			for _, f := range zr.File {
+				modTimes[f.Name] = f.Modified
+			}
+		} else {
+			gz, err := gzip.NewReader(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("Failed to open the tar.gz bundle: %v", err)
+			}
+			tr := tar.NewReader(gz)
+			for {
+				hdr, err := tr.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("Failed to read the tar.gz bundle: %v", err)
+				}
+				modTimes[hdr.Name] = hdr.ModTime
+			}
+		}
+		if len(modTimes) < 2 {
+			t.Fatalf("Expected the output files and the manifest in the %s bundle, got %v", format, modTimes)
+		}
+		for name, modTime := range modTimes {
+			if !modTime.Equal(watermark) {
+				t.Errorf("Expected %s in the %s bundle to have the watermark %v as its time, got %v", name, format, watermark, modTime)
+			}
+		}
+	}
+}
+
+// TestAnalyzeTagsBundleParquetRows tests that the manifest has the row count of Parquet files.
+func TestAnalyzeTagsBundleParquetRows(t *testing.T) {
+	out := NewMemFS()
+	a := newMemAnalyzer(t, getValidFullDepositXMLString(), out)
+	a.Bundle = BUNDLE_ZIP
+	a.Sinks = []OutputSink{&ParquetSink{}}
+	if err := a.AnalyzeTags(); err != nil {
+		t.Fatalf("AnalyzeTags failed with error: %v", err)
+	}
+	data, _ := out.ReadFile("deposits/test_2019-10-17_FULL_S1_R0-output.zip")
+	var manifest BundleManifest
+	json.Unmarshal(readBundle(t, BUNDLE_ZIP, data)[BUNDLE_MANIFEST_NAME], &manifest)
+	for _, m := range manifest.Members {
+		if strings.HasSuffix(m.Name, "-domains.parquet") {
+			if m.Rows == nil || *m.Rows != 2 {
+				t.Errorf("Expected 2 rows in %s, got %v", m.Name, m.Rows)
+			}
+			return
+		}
+	}
+	t.Errorf("Expected the domains Parquet file in the manifest, got %+v", manifest.Members)
+}
+
+// TestAnalyzeTagsUnsupportedBundle tests that unknown bundle formats are rejected before anything is written.
+func TestAnalyzeTagsUnsupportedBundle(t *testing.T) {
+	out := NewMemFS()
+	a := newMemAnalyzer(t, getValidFullDepositXMLString(), out)
+	a.Bundle = "rar"
+	if err := a.AnalyzeTags(); !errors.Is(err, ErrUnsupportedBundle) {
+		t.Errorf("Expected ErrUnsupportedBundle, got %v", err)
+	}
+	if names := out.Names(); len(names) != 0 {
+		t.Errorf("Expected no output, got %v", names)
+	}
+}
@@ -0,0 +1,117 @@
+package ryde
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/ianaindex"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// The encoding of XML without an encoding declaration or byte order mark.
+const DEFAULT_XML_ENCODING = "UTF-8"
+
+// The byte order marks we detect at the start of the XML.
+var (
+	utf8BOM    = []byte{0xef, 0xbb, 0xbf}
+	utf16LEBOM = []byte{0xff, 0xfe}
+	utf16BEBOM = []byte{0xfe, 0xff}
+)
+
+// The number of bytes we read ahead to find the encoding in the XML declaration.
+const xmlDeclarationPeekSize = 1024
+
+// Matches the encoding pseudo-attribute in the XML declaration, e.g. <?xml version="1.0" encoding="ISO-8859-1"?>.
+var xmlEncodingRegex = regexp.MustCompile(`^\s*<\?xml[^>]*?\sencoding\s*=\s*["']([A-Za-z][A-Za-z0-9._-]*)["']`)
+
+// Returns the encoding declared in the XML declaration at the start of head, or an empty string if there is none.
+func declaredXMLEncoding(head []byte) string {
+	m := xmlEncodingRegex.FindSubmatch(head)
+	if m == nil {
+		return ""
+	}
+	return string(m[1])
+}
+
+// LookupCharset returns the encoding for an IANA charset name, e.g. ISO-8859-1, windows-1252 or Shift_JIS.
+// It returns ErrUnsupportedCharset if the charset is unknown or not supported.
+func LookupCharset(name string) (encoding.Encoding, error) {
+	e, err := ianaindex.IANA.Encoding(name)
+	if err != nil || e == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedCharset, name)
+	}
+	return e, nil
+}
+
+// Checks if the charset name is a name for UTF-8.
+func isUTF8(name string) bool {
+	return strings.EqualFold(name, "UTF-8") || strings.EqualFold(name, "UTF8")
+}
+
+// Checks if the charset name is a name for UTF-16.
+func isUTF16(name string) bool {
+	return strings.HasPrefix(strings.ToUpper(name), "UTF-16")
+}
+
+// Returns a reader that converts the XML read from r to UTF-8, so the decoder and the positions it reports always work on UTF-8.
+// UTF-16 is detected from its byte order mark, other encodings from the XML declaration. The encoding is recorded in XMLFile.Encoding.
+// The offsets in the finding positions are offsets in the converted UTF-8, not in the file, so the SARIF output leaves them out for converted XML.
+func (a *XMLAnalyzer) transcodeXMLReader(r io.Reader) (io.Reader, error) {
+	a.XMLFile.Encoding = DEFAULT_XML_ENCODING
+	a.XMLFile.transcoded = false
+	br := bufio.NewReader(r)
+	bom, err := br.Peek(3)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	var utf16 encoding.Encoding
+	switch {
+	case bytes.HasPrefix(bom, utf8BOM):
+		br.Discard(len(utf8BOM))
+		a.XMLFile.transcoded = true
+	case bytes.HasPrefix(bom, utf16LEBOM):
+		utf16 = unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM)
+		a.XMLFile.Encoding = "UTF-16LE"
+	case bytes.HasPrefix(bom, utf16BEBOM):
+		utf16 = unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM)
+		a.XMLFile.Encoding = "UTF-16BE"
+	}
+	if utf16 != nil {
+		a.XMLFile.transcoded = true
+		br = bufio.NewReader(transform.NewReader(br, utf16.NewDecoder()))
+	}
+
+	head, err := br.Peek(xmlDeclarationPeekSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, err
+	}
+	declared := declaredXMLEncoding(head)
+	switch {
+	case declared == "" || isUTF8(declared):
+		return br, nil
+	case isUTF16(declared):
+		if utf16 == nil {
+			return nil, fmt.Errorf("%w: %s without a byte order mark", ErrUnsupportedCharset, declared)
+		}
+		return br, nil
+	}
+	e, err := LookupCharset(declared)
+	if err != nil {
+		return nil, err
+	}
+	a.XMLFile.Encoding = declared
+	a.XMLFile.transcoded = true
+	return transform.NewReader(br, e.NewDecoder()), nil
+}
+
+// The CharsetReader of the XML decoder. The XML has already been converted to UTF-8 by transcodeXMLReader, so it is returned as is.
+// The decoder calls this for every XML declaration with an encoding other than UTF-8.
+func passThroughCharsetReader(charset string, input io.Reader) (io.Reader, error) {
+	return input, nil
+}
@@ -0,0 +1,83 @@
+package ryde
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// Returns the valid test deposit with the given encoding declaration and a contact city with non-ASCII characters.
+func getDepositXMLStringWithEncoding(encoding string) string {
+	return strings.NewReplacer(
+		`encoding="UTF-8"`, `encoding="`+encoding+`"`,
+		"<contact:city>Dulles</contact:city>", "<contact:city>São Paulo</contact:city>",
+	).Replace(getValidFullDepositXMLString())
+}
+
+// TestAnalyzeTagsCharsets tests that deposits in other encodings than UTF-8 are converted to UTF-8.
+func TestAnalyzeTagsCharsets(t *testing.T) {
+	latin1, _ := charmap.ISO8859_1.NewEncoder().String(getDepositXMLStringWithEncoding("ISO-8859-1"))
+	windows1252, _ := charmap.Windows1252.NewEncoder().String(getDepositXMLStringWithEncoding("windows-1252"))
+	utf16LE, _ := unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewEncoder().String(getDepositXMLStringWithEncoding("UTF-16"))
+	utf16BE, _ := unicode.UTF16(unicode.BigEndian, unicode.UseBOM).NewEncoder().String(getDepositXMLStringWithEncoding("UTF-16"))
+	utf8BOM := string(utf8BOM) + getDepositXMLStringWithEncoding("UTF-8")
+
+	tests := []struct {
+		name     string
+		data     string
+		encoding string
+	}{
+		{"latin1", latin1, "ISO-8859-1"},
+		{"windows-1252", windows1252, "windows-1252"},
+		{"utf-16le", utf16LE, "UTF-16LE"},
+		{"utf-16be", utf16BE, "UTF-16BE"},
+		{"utf-8 bom", utf8BOM, "UTF-8"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fsys := fstest.MapFS{"test_2019-10-17_FULL_S1_R0.xml": &fstest.MapFile{Data: []byte(test.data)}}
+			a, err := NewXMLAnalyzerFS(fsys, "test_2019-10-17_FULL_S1_R0.xml")
+			if err != nil {
+				t.Fatalf("NewXMLAnalyzerFS returned an error: %v", err)
+			}
+			out := NewMemFS()
+			a.OutputFS = out
+			if err := a.AnalyzeTags(); err != nil {
+				t.Fatalf("AnalyzeTags failed with error: %v", err)
+			}
+			if a.XMLFile.Encoding != test.encoding {
+				t.Errorf("Expected encoding %s, got %s", test.encoding, a.XMLFile.Encoding)
+			}
+			if a.offsetsInFile() {
+				t.Errorf("Expected the offsets of the converted XML not to be offsets in the file")
+			}
+			data, err := out.ReadFile(a.CSVFiles["contactPostalInfo"].FileName)
+			if err != nil {
+				t.Fatalf("Failed to read postal info: %v", err)
+			}
+			if !bytes.Contains(data, []byte("São Paulo")) {
+				t.Errorf("Expected the city to be converted to UTF-8, got %s", data)
+			}
+		})
+	}
+}
+
+// TestAnalyzeTagsUnsupportedCharset tests that unknown encodings are rejected.
+func TestAnalyzeTagsUnsupportedCharset(t *testing.T) {
+	for _, encoding := range []string{"X-UNKNOWN", "UTF-16"} {
+		fsys := fstest.MapFS{"test_2019-10-17_FULL_S1_R0.xml": &fstest.MapFile{Data: []byte(getDepositXMLStringWithEncoding(encoding))}}
+		a, err := NewXMLAnalyzerFS(fsys, "test_2019-10-17_FULL_S1_R0.xml")
+		if err != nil {
+			t.Fatalf("NewXMLAnalyzerFS returned an error: %v", err)
+		}
+		a.OutputFS = NewMemFS()
+		if err := a.AnalyzeTags(); !errors.Is(err, ErrUnsupportedCharset) {
+			t.Errorf("%s: expected ErrUnsupportedCharset, got %v", encoding, err)
+		}
+	}
+}
@@ -1,41 +1,158 @@
 package main
 
 import (
+	"bytes"
 	"flag"
+	"io"
 	"log"
+	"os"
 
+	"github.com/ProtonMail/go-crypto/openpgp"
 	"github.com/onasunnymorning/ryde"
 )
 
 func main() {
 
-	filename := flag.String("f", "", "(path to) filename")
+	filename := flag.String("f", "", "(path to) filename, use - to read from stdin. The parts S2..Sn of a split deposit can be passed as extra arguments")
+	baseName := flag.String("o", "", "base name for the output files, required when reading from stdin")
+	outputDir := flag.String("outdir", "", "directory to write the output files to, defaults to the directory of the base name")
+	overwrite := flag.String("overwrite", ryde.OVERWRITE_TRUNCATE, "what to do with existing output: fail, truncate or versioned (write to the next free subdirectory v1, v2, ...)")
+	sizeHint := flag.Int64("size", 0, "expected size in bytes when reading from stdin, used to report progress")
+	rulesFile := flag.String("rules", "", "(path to) a JSON file with validation rules")
+	tarEntry := flag.String("tarentry", "", "pattern to find the deposit XML in a tar archive, defaults to *.xml")
+	tolerant := flag.Bool("tolerant", false, "quarantine objects that fail to decode instead of aborting the analysis")
+	keyringFile := flag.String("keyring", "", "(path to) an armored or binary OpenPGP keyring with the private key to decrypt .ryde deposits")
+	passphraseFile := flag.String("passphrase-file", "", "(path to) a file with the passphrase of the private key")
+	signatureFile := flag.String("sig", "", "(path to) the detached OpenPGP signature of the deposit")
+	verifyKeyringFile := flag.String("verify-keyring", "", "(path to) an armored or binary OpenPGP keyring with the public key to verify the signature")
+	csvHeader := flag.Bool("header", false, "start every CSV file with a header row with the column names")
+	dataPackage := flag.Bool("datapackage", false, "write a Frictionless datapackage.json that describes the columns, types and keys of the CSV files")
+	maxRows := flag.Int("max-rows", 0, "start a new CSV file after this many rows, e.g. -domains.001.csv")
+	maxBytes := flag.Int64("max-bytes", 0, "start a new CSV file before a file grows beyond this many bytes")
+	partition := flag.String("partition", "", "split the CSV files by registrar or hash of the object key")
+	partitions := flag.Int("partitions", ryde.CSV_DEFAULT_PARTITION_COUNT, "the number of partitions for -partition hash")
+	parquetOutput := flag.Bool("parquet", false, "write the objects to typed Parquet files instead of CSV files")
+	sqlDialect := flag.String("sql", "", "write the records to a self-contained SQL file for postgres or sqlite instead of CSV files")
+	jsonLines := flag.String("jsonl", "", "write the objects as nested JSON Lines to this file instead of CSV files, use - for stdout")
+	reproducible := flag.Bool("reproducible", false, "use the deposit watermark as the time in the analysis report, so the same deposit gives byte-identical output")
+	checkFileName := flag.Bool("check-filename", false, "check the deposit file name against the RyDE naming convention, the deposit and the header")
+	bundle := flag.String("bundle", "", "write all output files into one archive with a MANIFEST.json: tar.gz or zip")
 	flag.Parse()
 
 	if *filename == "" {
 		log.Fatal("Please provide a filename")
 	}
 
-	a, err := ryde.NewXMLAnalyzer(*filename)
-	if err != nil {
-		log.Fatal(err)
+	var err error
+	var keyring openpgp.EntityList
+	if *keyringFile != "" {
+		var passphrase []byte
+		if *passphraseFile != "" {
+			passphrase, err = os.ReadFile(*passphraseFile)
+			if err != nil {
+				log.Fatal(err)
+			}
+			passphrase = bytes.TrimRight(passphrase, "\r\n")
+		}
+		keyring, err = ryde.LoadKeyring(*keyringFile, passphrase)
+		if err != nil {
+			log.Fatal(err)
+		}
 	}
 
-	err = a.OpenXMLFile()
-	if err != nil {
-		log.Fatal(err)
+	var jsonLinesWriter io.Writer
+	jsonLinesFile := *jsonLines
+	if jsonLinesFile == "-" {
+		jsonLinesWriter = os.Stdout
+		jsonLinesFile = ""
 	}
 
-	err = a.CreateXMLDecoder()
-	if err != nil {
-		log.Fatal(err)
+	var rules []ryde.ValidationRule
+	if *rulesFile != "" {
+		rules, err = ryde.LoadValidationRules(*rulesFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Applies the options that are the same for every file we analyze
+	configure := func(a *ryde.XMLAnalyzer) {
+		a.Tolerant = *tolerant
+		a.OutputDir = *outputDir
+		a.Overwrite = *overwrite
+		a.Reproducible = *reproducible
+		a.Bundle = *bundle
+		a.CheckFileName = *checkFileName
+		a.TarEntryPattern = *tarEntry
+		a.Keyring = keyring
+		a.Rules = rules
+		switch {
+		case *parquetOutput:
+			a.Sinks = []ryde.OutputSink{&ryde.ParquetSink{}}
+		case *sqlDialect != "":
+			a.Sinks = []ryde.OutputSink{&ryde.SQLSink{Dialect: *sqlDialect}}
+		case *jsonLines != "":
+			// A file is written through the output filesystem of the analyzer, so it is staged like the other output files
+			a.Sinks = []ryde.OutputSink{&ryde.JSONLinesSink{Writer: jsonLinesWriter, FileName: jsonLinesFile}}
+		case *csvHeader || *dataPackage || *maxRows > 0 || *maxBytes > 0 || *partition != "":
+			a.Sinks = []ryde.OutputSink{&ryde.CSVSink{
+				Header:         *csvHeader,
+				DataPackage:    *dataPackage,
+				MaxRows:        *maxRows,
+				MaxBytes:       *maxBytes,
+				Partition:      *partition,
+				PartitionCount: *partitions,
+			}}
+		}
+	}
+
+	// Any extra arguments are the other parts of a split deposit
+	if flag.NArg() > 0 {
+		if jsonLinesFile != "" {
+			log.Fatal("The parts of a split deposit are analyzed separately, use -jsonl - to write their objects to one stream")
+		}
+		// A signature covers a single file, verifying one part would leave the others unverified
+		if *signatureFile != "" || *verifyKeyringFile != "" {
+			log.Fatal("Signatures cannot be verified for split deposits, verify the signature of every part on its own")
+		}
+		s, err := ryde.NewSplitDeposit(append([]string{*filename}, flag.Args()...)...)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, a := range s.Parts {
+			configure(a)
+		}
+		err = s.Analyze()
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Analyzed %d parts of deposit %s with %d findings, counters: %v, report: %s\n", len(s.Parts), s.Deposit.ID, len(s.Findings), s.Counters, s.Parts[0].GetBaseXMLFileName()+ryde.SPLIT_DEPOSIT_FILE_SUFFIX)
+		return
 	}
 
-	err = a.AnalyzeDepositTag()
+	var a *ryde.XMLAnalyzer
+	if *filename == "-" {
+		a, err = ryde.NewXMLAnalyzerFromReader(os.Stdin, *baseName, *sizeHint)
+	} else {
+		a, err = ryde.NewXMLAnalyzer(*filename)
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
+	if *baseName != "" {
+		a.BaseName = *baseName
+	}
+	configure(a)
+
+	if *signatureFile != "" {
+		a.SignatureFile = *signatureFile
+		a.VerificationKeyring, err = ryde.LoadKeyring(*verifyKeyringFile, nil)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
 
+	// AnalyzeTags reads the deposit attributes as it goes, so the file is only read once
 	err = a.AnalyzeTags()
 	if err != nil {
 		log.Fatal(err)
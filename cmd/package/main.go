@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/onasunnymorning/ryde"
+)
+
+func main() {
+
+	filename := flag.String("f", "", "(path to) the deposit XML file")
+	baseName := flag.String("o", "", "base name for the .ryde and .sig files, defaults to the XML file name without its extension")
+	recipientsFile := flag.String("recipients", "", "(path to) an armored or binary OpenPGP keyring with the public keys of the escrow agent")
+	signerFile := flag.String("signer", "", "(path to) an armored or binary OpenPGP keyring with the private key to sign the deposit")
+	passphraseFile := flag.String("passphrase-file", "", "(path to) a file with the passphrase of the signing key")
+	flag.Parse()
+
+	if *filename == "" {
+		log.Fatal("Please provide a filename")
+	}
+
+	recipients, err := ryde.LoadKeyring(*recipientsFile, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var passphrase []byte
+	if *passphraseFile != "" {
+		passphrase, err = os.ReadFile(*passphraseFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		passphrase = bytes.TrimRight(passphrase, "\r\n")
+	}
+	signers, err := ryde.LoadKeyring(*signerFile, passphrase)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(signers) == 0 {
+		log.Fatal(ryde.ErrNoSigner)
+	}
+
+	p := ryde.RyDEPackager{Recipients: recipients, Signer: signers[0]}
+	rydeFile, sigFile, err := p.PackageFile(*filename, *baseName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Wrote %s and %s\n", rydeFile, sigFile)
+
+}
@@ -0,0 +1,119 @@
+package ryde
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+const (
+	COMPRESSION_NONE  = "none"
+	COMPRESSION_GZIP  = "gzip"
+	COMPRESSION_BZIP2 = "bzip2"
+	COMPRESSION_XZ    = "xz"
+	COMPRESSION_ZSTD  = "zstd"
+)
+
+// Maps the supported compression formats to the magic bytes their streams start with.
+var compressionMagicBytes = map[string][]byte{
+	COMPRESSION_GZIP:  {0x1f, 0x8b},
+	COMPRESSION_BZIP2: []byte("BZh"),
+	COMPRESSION_XZ:    {0xfd, '7', 'z', 'X', 'Z', 0x00},
+	COMPRESSION_ZSTD:  {0x28, 0xb5, 0x2f, 0xfd},
+}
+
+// Maps the file extensions of the supported compression formats to the format.
+var compressionExtensions = map[string]string{
+	".gz":  COMPRESSION_GZIP,
+	".bz2": COMPRESSION_BZIP2,
+	".xz":  COMPRESSION_XZ,
+	".zst": COMPRESSION_ZSTD,
+}
+
+// DetectCompression returns the compression format of the stream in br by peeking at its magic bytes, without consuming them.
+// It returns COMPRESSION_NONE if the stream is not compressed in one of the supported formats.
+func DetectCompression(br *bufio.Reader) (string, error) {
+	// Peek returns an error if the stream is shorter than requested, we still want to check what we have
+	head, err := br.Peek(6)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return "", err
+	}
+	for compression, magic := range compressionMagicBytes {
+		if bytes.HasPrefix(head, magic) {
+			return compression, nil
+		}
+	}
+	return COMPRESSION_NONE, nil
+}
+
+// NewDecompressor returns a reader that decompresses r with the given compression format.
+// The returned io.Closer releases the resources of the decompressor and does not close r.
+func NewDecompressor(r io.Reader, compression string) (io.Reader, io.Closer, error) {
+	switch compression {
+	case COMPRESSION_NONE:
+		return r, closerFunc(func() {}), nil
+	case COMPRESSION_GZIP:
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		return zr, zr, nil
+	case COMPRESSION_BZIP2:
+		return bzip2.NewReader(r), closerFunc(func() {}), nil
+	case COMPRESSION_XZ:
+		xr, err := xz.NewReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		return xr, closerFunc(func() {}), nil
+	case COMPRESSION_ZSTD:
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		return zr, closerFunc(zr.Close), nil
+	}
+	return nil, nil, ErrUnsupportedCompression
+}
+
+// closerFunc turns a func() into an io.Closer.
+type closerFunc func()
+
+func (f closerFunc) Close() error {
+	f()
+	return nil
+}
+
+// Returns the filename without the extension of a supported compression format, if it has one.
+func trimCompressionExtension(filename string) string {
+	for ext := range compressionExtensions {
+		if strings.HasSuffix(filename, ext) {
+			return strings.TrimSuffix(filename, ext)
+		}
+	}
+	return filename
+}
+
+// Detects the compression of the XML reader and puts a decompressor in front of it if needed.
+// The compressed bytes are counted by the progress reader, the uncompressed bytes by the returned counting reader.
+func (a *XMLAnalyzer) decompressXMLReader(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	compression, err := DetectCompression(br)
+	if err != nil {
+		return nil, err
+	}
+	dr, closer, err := NewDecompressor(br, compression)
+	if err != nil {
+		return nil, err
+	}
+	a.XMLFile.Compression = compression
+	a.XMLFile.decompressor = closer
+	a.XMLFile.uncompressed = &countingReader{r: dr}
+	return a.XMLFile.uncompressed, nil
+}
@@ -0,0 +1,128 @@
+package ryde
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// Returns the valid XML deposit compressed with the given compression format.
+func compressTestDeposit(t *testing.T, compression string) []byte {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	var err error
+	switch compression {
+	case COMPRESSION_GZIP:
+		w = gzip.NewWriter(&buf)
+	case COMPRESSION_XZ:
+		w, err = xz.NewWriter(&buf)
+	case COMPRESSION_ZSTD:
+		w, err = zstd.NewWriter(&buf)
+	default:
+		t.Fatalf("Unsupported compression %s", compression)
+	}
+	if err != nil {
+		t.Fatalf("Failed to create %s writer: %v", compression, err)
+	}
+	if _, err := w.Write([]byte(getValidFullDepositXMLString())); err != nil {
+		t.Fatalf("Failed to compress deposit: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Failed to close %s writer: %v", compression, err)
+	}
+	return buf.Bytes()
+}
+
+// TestDetectCompression tests that the compression format is detected from the magic bytes without consuming them.
+func TestDetectCompression(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []byte
+		want  string
+	}{
+		{"empty", []byte{}, COMPRESSION_NONE},
+		{"xml", []byte("<?xml version=\"1.0\"?>"), COMPRESSION_NONE},
+		{"gzip", []byte{0x1f, 0x8b, 0x08, 0x00}, COMPRESSION_GZIP},
+		{"bzip2", []byte("BZh91AY&SY"), COMPRESSION_BZIP2},
+		{"xz", []byte{0xfd, '7', 'z', 'X', 'Z', 0x00, 0x00}, COMPRESSION_XZ},
+		{"zstd", []byte{0x28, 0xb5, 0x2f, 0xfd, 0x00}, COMPRESSION_ZSTD},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			br := bufio.NewReader(bytes.NewReader(tt.input))
+			got, err := DetectCompression(br)
+			if err != nil {
+				t.Fatalf("DetectCompression returned an error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("DetectCompression() = %s, want %s", got, tt.want)
+			}
+			rest, _ := io.ReadAll(br)
+			if !bytes.Equal(rest, tt.input) {
+				t.Errorf("Expected DetectCompression not to consume the input")
+			}
+		})
+	}
+}
+
+// TestAnalyzeTagsCompressed tests that compressed deposits are decompressed while they are analyzed.
+func TestAnalyzeTagsCompressed(t *testing.T) {
+	for compression, ext := range map[string]string{COMPRESSION_GZIP: ".gz", COMPRESSION_XZ: ".xz", COMPRESSION_ZSTD: ".zst"} {
+		t.Run(compression, func(t *testing.T) {
+			data := compressTestDeposit(t, compression)
+			filename := filepath.Join(t.TempDir(), "deposit.xml"+ext)
+			if err := os.WriteFile(filename, data, 0666); err != nil {
+				t.Fatalf("Failed to write compressed deposit: %v", err)
+			}
+			a, err := NewXMLAnalyzer(filename)
+			if err != nil {
+				t.Fatalf("NewXMLAnalyzer returned an error: %s", err)
+			}
+			if a.GetBaseXMLFileName() != strings.TrimSuffix(filename, ".xml"+ext) {
+				t.Errorf("Unexpected base name %s", a.GetBaseXMLFileName())
+			}
+			err = a.AnalyzeTags()
+			if err != nil {
+				t.Fatalf("AnalyzeTags failed with error: %v", err)
+			}
+			if a.XMLFile.Compression != compression {
+				t.Errorf("Expected compression %s, got %s", compression, a.XMLFile.Compression)
+			}
+			if a.XMLFile.BytesRead != int64(len(data)) {
+				t.Errorf("Expected %d compressed bytes to be read, got %d", len(data), a.XMLFile.BytesRead)
+			}
+			if a.XMLFile.UncompressedBytes != int64(len(getValidFullDepositXMLString())) {
+				t.Errorf("Expected %d uncompressed bytes to be read, got %d", len(getValidFullDepositXMLString()), a.XMLFile.UncompressedBytes)
+			}
+			if a.Counters["domain"] != 2 || a.Deposit.ID != "20191017001" {
+				t.Errorf("Unexpected analysis result %v %v", a.Counters, a.Deposit)
+			}
+		})
+	}
+}
+
+// TestIsValidDepositFileName tests the file extensions that are accepted for deposits.
+func TestIsValidDepositFileName(t *testing.T) {
+	tests := map[string]bool{
+		"deposit.xml":     true,
+		"deposit.xml.gz":  true,
+		"deposit.xml.bz2": true,
+		"deposit.xml.xz":  true,
+		"deposit.xml.zst": true,
+		"deposit.gz":      false,
+		"deposit.txt":     false,
+	}
+	for filename, want := range tests {
+		if got := IsValidDepositFileName(filename); got != want {
+			t.Errorf("IsValidDepositFileName(%s) = %v, want %v", filename, got, want)
+		}
+	}
+}
@@ -17,5 +17,24 @@ const (
 	HOST_STATUS_FILE_SUFFIX       = "-hostStatuses.csv"
 	NNDN_FILE_SUFFIX              = "-nndns.csv"
 	UNIQUE_CONTACT_ID_FILE_SUFFIX = "-uniqueContactIDs.csv"
+	ORPHAN_CONTACT_FILE_SUFFIX    = "-orphanContacts.csv"
+	ORPHAN_HOST_FILE_SUFFIX       = "-orphanHosts.csv"
 	ANALYSYS_FILE_SUFFIX          = "-analysis.json"
+	FINDINGS_JSON_FILE_SUFFIX     = "-findings.json"
+	FINDINGS_SARIF_FILE_SUFFIX    = "-findings.sarif"
+	QUARANTINE_FILE_SUFFIX        = "-quarantine.jsonl"
+	DATAPACKAGE_FILE_SUFFIX       = "-datapackage.json"
+	JSONL_FILE_SUFFIX             = "-objects.jsonl"
+	SHARD_MANIFEST_FILE_SUFFIX    = "-shards.json"
+	BUNDLE_FILE_SUFFIX            = "-output"
+	SPLIT_DEPOSIT_FILE_SUFFIX     = "-deposit.json"
+	SPLIT_DEPOSIT_SARIF_SUFFIX    = "-deposit.sarif"
+	RYDE_FILE_SUFFIX              = ".ryde"
+	SIGNATURE_FILE_SUFFIX         = ".sig"
+)
+
+const (
+	SEVERITY_ERROR   = "error"
+	SEVERITY_WARNING = "warning"
+	SEVERITY_INFO    = "info"
 )
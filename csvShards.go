@@ -0,0 +1,326 @@
+package ryde
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+)
+
+const (
+	PARTITION_REGISTRAR         = "registrar" // Partition the CSV files by the sponsoring registrar (clID) of the objects.
+	PARTITION_HASH              = "hash"      // Partition the CSV files by a hash of the object key.
+	CSV_DEFAULT_PARTITION_COUNT = 16          // The number of hash partitions if CSVSink.PartitionCount is not set.
+	CSV_SHARD_MAX_OPEN_FILES    = 256         // The number of shards that are kept open if CSVSink.MaxOpenFiles is not set.
+)
+
+// The record types that are written after the deposit has been read, not right after the object they belong to.
+// They cannot take the registrar partition of their object, so they are not partitioned by registrar.
+var csvDerivedRecordTypes = []string{"uniqueContactID", "orphanContact", "orphanHost"}
+
+// CSVShard is one of the files a CSV file is split across when CSVSink shards the output.
+type CSVShard struct {
+	FileName  string `json:"fileName"`
+	Partition string `json:"partition,omitempty"` // The partition of the shard, e.g. registrar-RegistrarX or hash-007, empty if the output is not partitioned.
+	Index     int    `json:"index"`               // The number of the shard within its partition, starting at 0.
+	Rows      int    `json:"rows"`                // The number of records in the shard, not counting the header row.
+	FileSize  int64  `json:"fileSize"`
+
+	file    WritableFile
+	w       *bufio.Writer
+	lastUse int // When the shard was last written to, to find the least recently used open shard.
+}
+
+// ShardManifest lists every shard of the CSV output with its row count. It is written to the file with SHARD_MANIFEST_FILE_SUFFIX.
+type ShardManifest struct {
+	DepositID string               `json:"depositId"`
+	Partition string               `json:"partition,omitempty"`
+	MaxRows   int                  `json:"maxRows,omitempty"`
+	MaxBytes  int64                `json:"maxBytes,omitempty"`
+	Shards    []ShardManifestEntry `json:"shards"` // Sorted by record type, partition and index.
+}
+
+// ShardManifestEntry is a shard of the CSV file of a record type. The file name is relative to the directory of the manifest.
+type ShardManifestEntry struct {
+	RecordType string `json:"recordType"`
+	CSVShard
+}
+
+// Whether the CSV files are sharded.
+func (s *CSVSink) sharded() bool {
+	return s.MaxRows > 0 || s.MaxBytes > 0 || s.Partition != ""
+}
+
+// Checks the sharding options and prepares the CSV files, the shards are created as records are written.
+func (s *CSVSink) beginShards(a *XMLAnalyzer) error {
+	if s.Partition != "" && s.Partition != PARTITION_REGISTRAR && s.Partition != PARTITION_HASH {
+		return fmt.Errorf("%w: %q", ErrUnsupportedPartition, s.Partition)
+	}
+	for recordType := range CSVFilesAndSuffixes {
+		a.CSVFiles[recordType] = CSVFile{Header: s.Header}
+	}
+	s.current = map[string]*CSVShard{}
+	s.lastPartition = map[string]string{}
+	s.open = nil
+	s.uses = 0
+	s.row.Reset()
+	s.rowWriter = csv.NewWriter(&s.row)
+	return nil
+}
+
+// Writes the record to the current shard of its type and partition, starting a new shard when the current one is full.
+func (s *CSVSink) writeShardedRecord(r Record) error {
+	recordType := r.RecordType()
+	csvFile, ok := s.a.CSVFiles[recordType]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownRecordType, recordType)
+	}
+	values := r.Values()
+	partition := s.partition(recordType, values)
+	s.lastPartition[recordType] = partition
+
+	s.row.Reset()
+	err := s.rowWriter.Write(values)
+	if err != nil {
+		return err
+	}
+	s.rowWriter.Flush()
+	row := s.row.Bytes()
+
+	key := recordType + "\x00" + partition
+	shard := s.current[key]
+	if shard != nil && shard.Rows > 0 && (s.MaxRows > 0 && shard.Rows >= s.MaxRows || s.MaxBytes > 0 && shard.FileSize+int64(len(row)) > s.MaxBytes) {
+		err = s.closeShard(shard)
+		if err != nil {
+			return err
+		}
+		shard = &CSVShard{Partition: partition, Index: shard.Index + 1}
+		csvFile.Shards = append(csvFile.Shards, shard)
+	}
+	if shard == nil {
+		shard = &CSVShard{Partition: partition}
+		csvFile.Shards = append(csvFile.Shards, shard)
+	}
+	s.a.CSVFiles[recordType] = csvFile
+	s.current[key] = shard
+	err = s.openShard(recordType, shard)
+	if err != nil {
+		return err
+	}
+	_, err = shard.w.Write(row)
+	shard.Rows++
+	shard.FileSize += int64(len(row))
+	return err
+}
+
+// Returns the partition of a record: the registrar of the object it belongs to, or the hash of its first column, which is the key of the object.
+func (s *CSVSink) partition(recordType string, values []string) string {
+	switch s.Partition {
+	case PARTITION_HASH:
+		count := s.PartitionCount
+		if count <= 0 {
+			count = CSV_DEFAULT_PARTITION_COUNT
+		}
+		h := fnv.New32a()
+		h.Write([]byte(values[0]))
+		return fmt.Sprintf("hash-%03d", h.Sum32()%uint32(count))
+	case PARTITION_REGISTRAR:
+		if slices.Contains(csvDerivedRecordTypes, recordType) {
+			return ""
+		}
+		if recordType == "registrar" {
+			return registrarPartition(values[0])
+		}
+		schema := RecordSchemas[recordType]
+		for _, fk := range schema.ForeignKeys {
+			if fk.Reference == "registrar" {
+				return registrarPartition(values[slices.Index(schema.FieldNames(), fk.Fields[0])])
+			}
+		}
+		// The statuses, addresses etc. of an object are written right after it
+		for _, fk := range schema.ForeignKeys {
+			if partition, ok := s.lastPartition[fk.Reference]; ok {
+				return partition
+			}
+		}
+	}
+	return ""
+}
+
+// Returns the partition of a registrar, escaped so it can be used in a file name.
+func registrarPartition(id string) string {
+	if id == "" {
+		return ""
+	}
+	return "registrar-" + url.PathEscape(id)
+}
+
+// Returns the file name of a shard: the name of the CSV file with the partition and, when the files are rotated, the index before the extension.
+func (s *CSVSink) shardFileName(recordType string, shard *CSVShard) string {
+	name := s.a.GetBaseXMLFileName() + strings.TrimSuffix(CSVFilesAndSuffixes[recordType], ".csv")
+	if shard.Partition != "" {
+		name += "." + shard.Partition
+	}
+	if s.MaxRows > 0 || s.MaxBytes > 0 {
+		name += fmt.Sprintf(".%03d", shard.Index)
+	}
+	return name + ".csv"
+}
+
+// Makes sure the shard is open, creating it with its header row if it is new. If too many shards are open, the least recently used one is closed.
+func (s *CSVSink) openShard(recordType string, shard *CSVShard) error {
+	s.uses++
+	shard.lastUse = s.uses
+	if shard.file != nil {
+		return nil
+	}
+	maxOpen := s.MaxOpenFiles
+	if maxOpen <= 0 {
+		maxOpen = CSV_SHARD_MAX_OPEN_FILES
+	}
+	if len(s.open) >= maxOpen {
+		lru := s.open[0]
+		for _, open := range s.open {
+			if open.lastUse < lru.lastUse {
+				lru = open
+			}
+		}
+		err := s.closeShard(lru)
+		if err != nil {
+			return err
+		}
+	}
+	flag := os.O_WRONLY | os.O_APPEND
+	if shard.FileName == "" {
+		shard.FileName = s.shardFileName(recordType, shard)
+		flag = os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	}
+	file, err := s.a.outputFS().OpenFile(shard.FileName, flag, 0666)
+	if err != nil {
+		return err
+	}
+	shard.file = file
+	shard.w = bufio.NewWriter(file)
+	s.open = append(s.open, shard)
+	if flag&os.O_CREATE != 0 && s.Header {
+		header := strings.Join(RecordSchemas[recordType].FieldNames(), ",") + "\n"
+		_, err = shard.w.WriteString(header)
+		shard.FileSize += int64(len(header))
+	}
+	return err
+}
+
+// Flushes and closes the shard, it is reopened for appending when it is written to again.
+func (s *CSVSink) closeShard(shard *CSVShard) error {
+	if shard.file == nil {
+		return nil
+	}
+	s.open = slices.DeleteFunc(s.open, func(open *CSVShard) bool { return open == shard })
+	err := shard.w.Flush()
+	closeErr := shard.file.Close()
+	shard.file = nil
+	shard.w = nil
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// Closes all shards, creates an empty file for the record types without records, and writes the manifest.
+func (s *CSVSink) endShards(a *XMLAnalyzer) error {
+	var firstErr error
+	for len(s.open) > 0 {
+		if err := s.closeShard(s.open[0]); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr != nil {
+		return firstErr
+	}
+	for recordType, csvFile := range a.CSVFiles {
+		if len(csvFile.Shards) > 0 {
+			continue
+		}
+		shard := &CSVShard{}
+		if err := s.openShard(recordType, shard); err != nil {
+			return err
+		}
+		if err := s.closeShard(shard); err != nil {
+			return err
+		}
+		csvFile.Shards = []*CSVShard{shard}
+		a.CSVFiles[recordType] = csvFile
+	}
+	return s.writeShardManifestFile(a)
+}
+
+// Returns the manifest of the shards of the CSV files.
+func (s *CSVSink) newShardManifest(a *XMLAnalyzer) ShardManifest {
+	manifest := ShardManifest{DepositID: a.Deposit.ID, Partition: s.Partition, MaxRows: s.MaxRows, MaxBytes: s.MaxBytes, Shards: []ShardManifestEntry{}}
+	for recordType, csvFile := range a.CSVFiles {
+		for _, shard := range csvFile.Shards {
+			entry := ShardManifestEntry{RecordType: recordType, CSVShard: *shard}
+			entry.FileName = path.Base(shard.FileName)
+			manifest.Shards = append(manifest.Shards, entry)
+		}
+	}
+	sort.Slice(manifest.Shards, func(i, j int) bool {
+		x, y := manifest.Shards[i], manifest.Shards[j]
+		if x.RecordType != y.RecordType {
+			return x.RecordType < y.RecordType
+		}
+		if x.Partition != y.Partition {
+			return x.Partition < y.Partition
+		}
+		return x.Index < y.Index
+	})
+	return manifest
+}
+
+// Writes the manifest of the shards next to them.
+func (s *CSVSink) writeShardManifestFile(a *XMLAnalyzer) error {
+	file, err := a.outputFS().OpenFile(a.GetBaseXMLFileName()+SHARD_MANIFEST_FILE_SUFFIX, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	enc := json.NewEncoder(file)
+	enc.SetIndent("", "  ")
+	err = enc.Encode(s.newShardManifest(a))
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// Counts the lines and saves the sizes of the shards of a CSV file, and their totals in the CSV file.
+func (a *XMLAnalyzer) countLinesInShards(csvFile *CSVFile) error {
+	csvFile.FileSize = 0
+	csvFile.LineCount = 0
+	for _, shard := range csvFile.Shards {
+		file, err := a.outputFS().Open(shard.FileName)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		lineCount, err := CountLines(file)
+		if err != nil {
+			return err
+		}
+		fi, err := file.Stat()
+		if err != nil {
+			return err
+		}
+		shard.FileSize = fi.Size()
+		csvFile.FileSize += shard.FileSize
+		csvFile.LineCount += lineCount
+	}
+	return nil
+}
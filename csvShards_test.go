@@ -0,0 +1,164 @@
+package ryde
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// Analyzes the deposit with the sink and returns the output and the shard manifest.
+func analyzeSharded(t *testing.T, deposit string, sink *CSVSink) (*XMLAnalyzer, *MemFS, ShardManifest) {
+	out := NewMemFS()
+	a := newMemAnalyzer(t, deposit, out)
+	a.Sinks = []OutputSink{sink}
+	if err := a.AnalyzeTags(); err != nil {
+		t.Fatalf("AnalyzeTags failed with error: %v", err)
+	}
+	data, err := out.ReadFile("deposits/test_2019-10-17_FULL_S1_R0" + SHARD_MANIFEST_FILE_SUFFIX)
+	if err != nil {
+		t.Fatalf("Failed to read the shard manifest: %v", err)
+	}
+	var manifest ShardManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		t.Fatalf("Failed to parse the shard manifest: %v", err)
+	}
+	return a, out, manifest
+}
+
+// Returns the shards of a record type in the manifest, keyed by file name, with their contents.
+func shardContents(t *testing.T, out *MemFS, manifest ShardManifest, recordType string) map[string]string {
+	contents := map[string]string{}
+	for _, shard := range manifest.Shards {
+		if shard.RecordType != recordType {
+			continue
+		}
+		data, err := out.ReadFile("deposits/" + shard.FileName)
+		if err != nil {
+			t.Fatalf("Shard %s in the manifest does not exist: %v", shard.FileName, err)
+		}
+		if lines := strings.Count(string(data), "\n"); lines != shard.Rows && lines != shard.Rows+1 {
+			t.Errorf("Expected %d rows in %s, got %d lines", shard.Rows, shard.FileName, lines)
+		}
+		contents[shard.FileName] = string(data)
+	}
+	return contents
+}
+
+// TestCSVSinkRotation tests that the CSV files are rotated by rows and by bytes, with a header row in every shard.
+func TestCSVSinkRotation(t *testing.T) {
+	tests := []struct {
+		name string
+		sink *CSVSink
+	}{
+		{"rows", &CSVSink{Header: true, DataPackage: true, MaxRows: 1}},
+		{"bytes", &CSVSink{Header: true, DataPackage: true, MaxBytes: 10}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			a, out, manifest := analyzeSharded(t, getValidFullDepositXMLString(), tc.sink)
+			domains := shardContents(t, out, manifest, "domain")
+			expected := map[string]string{
+				"test_2019-10-17_FULL_S1_R0-domains.000.csv": "example1.example",
+				"test_2019-10-17_FULL_S1_R0-domains.001.csv": "example2.example",
+			}
+			if len(domains) != len(expected) {
+				t.Fatalf("Expected %d domain shards, got %v", len(expected), domains)
+			}
+			for name, domain := range expected {
+				if !strings.HasPrefix(domains[name], "name,roid,") || !strings.Contains(domains[name], domain) {
+					t.Errorf("Expected %s with a header row and %s, got %q", name, domain, domains[name])
+				}
+			}
+			if shards := shardContents(t, out, manifest, "nndn"); len(shards) != 1 || shards["test_2019-10-17_FULL_S1_R0-nndns.000.csv"] == "" {
+				t.Errorf("Expected one shard with the header for a record type without records, got %v", shards)
+			}
+			if a.CSVFiles["domain"].LineCount != 4 || len(a.CSVFiles["domain"].Shards) != 2 {
+				t.Errorf("Expected 4 lines in 2 domain shards, got %+v", a.CSVFiles["domain"])
+			}
+
+			data, _ := out.ReadFile("deposits/test_2019-10-17_FULL_S1_R0" + DATAPACKAGE_FILE_SUFFIX)
+			var dp DataPackage
+			if err := json.Unmarshal(data, &dp); err != nil {
+				t.Fatalf("Failed to parse the data package: %v", err)
+			}
+			for _, r := range dp.Resources {
+				if r.Name == "domain" && strings.Join(r.Path, ",") != "test_2019-10-17_FULL_S1_R0-domains.000.csv,test_2019-10-17_FULL_S1_R0-domains.001.csv" {
+					t.Errorf("Expected the domain resource to list its shards, got %v", r.Path)
+				}
+			}
+		})
+	}
+}
+
+// TestCSVSinkPartitionByRegistrar tests that objects and their statuses are written to the partition of their registrar,
+// also when the shards have to be closed and reopened.
+func TestCSVSinkPartitionByRegistrar(t *testing.T) {
+	deposit := getValidFullDepositXMLString()
+	second := strings.Index(deposit, "<rdeDomain:name>example2.example</rdeDomain:name>")
+	deposit = deposit[:second] + strings.Replace(deposit[second:], "<rdeDomain:clID>RegistrarX</rdeDomain:clID>", "<rdeDomain:clID>Registrar Y</rdeDomain:clID>", 1)
+	_, out, manifest := analyzeSharded(t, deposit, &CSVSink{Partition: PARTITION_REGISTRAR, MaxOpenFiles: 1})
+	if manifest.Partition != PARTITION_REGISTRAR {
+		t.Errorf("Expected the partitioning in the manifest, got %q", manifest.Partition)
+	}
+	statuses := shardContents(t, out, manifest, "domainStatus")
+	expected := map[string]string{
+		"test_2019-10-17_FULL_S1_R0-domainStatuses.registrar-RegistrarX.csv":    "example1.example,ok\n",
+		"test_2019-10-17_FULL_S1_R0-domainStatuses.registrar-Registrar%20Y.csv": "example2.example,ok\nexample2.example,clientUpdateProhibited\n",
+	}
+	if len(statuses) != len(expected) {
+		t.Fatalf("Expected %d status shards, got %v", len(expected), statuses)
+	}
+	for name, rows := range expected {
+		if statuses[name] != rows {
+			t.Errorf("Expected %q in %s, got %q", rows, name, statuses[name])
+		}
+	}
+	if hosts := shardContents(t, out, manifest, "hostStatus"); len(hosts) != 1 || hosts["test_2019-10-17_FULL_S1_R0-hostStatuses.registrar-RegistrarX.csv"] == "" {
+		t.Errorf("Expected the host statuses with RegistrarX, got %v", hosts)
+	}
+	if ids := shardContents(t, out, manifest, "uniqueContactID"); ids["test_2019-10-17_FULL_S1_R0-uniqueContactIDs.csv"] != "sh8013\n" {
+		t.Errorf("Expected the unique contact IDs not to be partitioned, got %v", ids)
+	}
+}
+
+// TestCSVSinkPartitionByHash tests that records are partitioned by the hash of the object key, together with the object they belong to.
+func TestCSVSinkPartitionByHash(t *testing.T) {
+	_, out, manifest := analyzeSharded(t, getValidFullDepositXMLString(), &CSVSink{Partition: PARTITION_HASH, PartitionCount: 4})
+	partitions := map[string]string{}
+	for _, shard := range manifest.Shards {
+		if shard.Rows > 0 && !strings.HasPrefix(shard.Partition, "hash-00") {
+			t.Errorf("Expected one of 4 hash partitions, got %q", shard.Partition)
+		}
+		if shard.RecordType != "domain" && shard.RecordType != "domainStatus" {
+			continue
+		}
+		data, _ := out.ReadFile("deposits/" + shard.FileName)
+		for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+			domain := strings.Split(line, ",")[0]
+			if p, ok := partitions[domain]; ok && p != shard.Partition {
+				t.Errorf("Expected the records of %s in one partition, got %s and %s", domain, p, shard.Partition)
+			}
+			partitions[domain] = shard.Partition
+		}
+	}
+	if len(partitions) != 2 {
+		t.Errorf("Expected 2 partitioned domains, got %v", partitions)
+	}
+
+	// With one open file every record type closes the shard of the previous one, which is appended to when it comes back
+	_, out, manifest = analyzeSharded(t, getValidFullDepositXMLString(), &CSVSink{Partition: PARTITION_HASH, PartitionCount: 1, MaxOpenFiles: 1})
+	domains := shardContents(t, out, manifest, "domain")
+	if rows := domains["test_2019-10-17_FULL_S1_R0-domains.hash-000.csv"]; !strings.HasPrefix(rows, "example1.example,") || !strings.Contains(rows, "\nexample2.example,") {
+		t.Errorf("Expected both domains in one partition, got %v", domains)
+	}
+}
+
+// TestCSVSinkUnsupportedPartition tests that unknown partitionings are rejected.
+func TestCSVSinkUnsupportedPartition(t *testing.T) {
+	a := newMemAnalyzer(t, getValidFullDepositXMLString(), NewMemFS())
+	a.Sinks = []OutputSink{&CSVSink{Partition: "tld"}}
+	if err := a.AnalyzeTags(); !errors.Is(err, ErrUnsupportedPartition) {
+		t.Errorf("Expected ErrUnsupportedPartition, got %v", err)
+	}
+}
@@ -0,0 +1,167 @@
+package ryde
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	DATAPACKAGE_PROFILE       = "tabular-data-package"
+	DATAPACKAGE_RESOURCE      = "tabular-data-resource"
+	DATAPACKAGE_DATE_FORMAT   = "any" // The dates in a deposit have a variable number of fractional seconds
+	DATAPACKAGE_CSV_MEDIATYPE = "text/csv"
+)
+
+// Matches the characters that are not allowed in the name of a data package or resource.
+var dataPackageNameRegex = regexp.MustCompile(`[^a-z0-9._-]+`)
+
+// DataPackage is a Frictionless tabular data package (https://specs.frictionlessdata.io/tabular-data-package/) that describes the CSV files.
+type DataPackage struct {
+	Profile   string                `json:"profile"`
+	Name      string                `json:"name"`
+	Resources []DataPackageResource `json:"resources"`
+}
+
+// DataPackageResource describes a CSV file in a data package.
+type DataPackageResource struct {
+	Profile   string             `json:"profile"`
+	Name      string             `json:"name"`
+	Title     string             `json:"title,omitempty"`
+	Path      DataPackagePath    `json:"path"`
+	Format    string             `json:"format"`
+	MediaType string             `json:"mediatype"`
+	Encoding  string             `json:"encoding"`
+	Bytes     int64              `json:"bytes,omitempty"`
+	Dialect   DataPackageDialect `json:"dialect"`
+	Schema    DataPackageSchema  `json:"schema"`
+}
+
+// DataPackagePath is the path of the CSV file of a resource, or the paths of the files a sharded resource is split across.
+// A single path is written as a string, several as an array.
+type DataPackagePath []string
+
+func (p DataPackagePath) MarshalJSON() ([]byte, error) {
+	if len(p) == 1 {
+		return json.Marshal(p[0])
+	}
+	return json.Marshal([]string(p))
+}
+
+func (p *DataPackagePath) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*p = DataPackagePath{single}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(p))
+}
+
+// DataPackageDialect describes the CSV dialect of a resource.
+type DataPackageDialect struct {
+	Delimiter string `json:"delimiter"`
+	Header    bool   `json:"header"`
+}
+
+// DataPackageSchema is the table schema of a resource.
+type DataPackageSchema struct {
+	Fields      []DataPackageField      `json:"fields"`
+	PrimaryKey  []string                `json:"primaryKey,omitempty"`
+	ForeignKeys []DataPackageForeignKey `json:"foreignKeys,omitempty"`
+}
+
+// DataPackageField describes a column of a resource.
+type DataPackageField struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Format      string `json:"format,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// DataPackageForeignKey references the primary key of another resource.
+type DataPackageForeignKey struct {
+	Fields    []string             `json:"fields"`
+	Reference DataPackageReference `json:"reference"`
+}
+
+// DataPackageReference is the resource and columns a foreign key references.
+type DataPackageReference struct {
+	Resource string   `json:"resource"`
+	Fields   []string `json:"fields"`
+}
+
+// Returns a name that is valid for a data package or resource: lowercase alphanumerics, '.', '_' and '-'.
+func dataPackageName(name string) string {
+	return strings.Trim(dataPackageNameRegex.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+// NewDataPackage returns a data package that describes the CSV files of the analyzer. Record types without a schema are left out.
+// The resources are named after their record type and sorted by name, their paths are relative to the directory of the CSV files.
+// The resource of a sharded record type lists all its shards.
+func (a *XMLAnalyzer) NewDataPackage(header bool) DataPackage {
+	dp := DataPackage{
+		Profile: DATAPACKAGE_PROFILE,
+		Name:    dataPackageName(path.Base(a.GetBaseXMLFileName())),
+	}
+	for recordType, csvFile := range a.CSVFiles {
+		schema, ok := RecordSchemas[recordType]
+		if !ok {
+			continue
+		}
+		resource := DataPackageResource{
+			Profile:   DATAPACKAGE_RESOURCE,
+			Name:      dataPackageName(recordType),
+			Title:     schema.Description,
+			Path:      DataPackagePath{path.Base(csvFile.FileName)},
+			Format:    "csv",
+			MediaType: DATAPACKAGE_CSV_MEDIATYPE,
+			Encoding:  "utf-8",
+			Bytes:     csvFile.FileSize,
+			Dialect:   DataPackageDialect{Delimiter: ",", Header: header},
+			Schema:    DataPackageSchema{PrimaryKey: schema.PrimaryKey},
+		}
+		if len(csvFile.Shards) > 0 {
+			resource.Path = nil
+			for _, shard := range csvFile.Shards {
+				resource.Path = append(resource.Path, path.Base(shard.FileName))
+			}
+		}
+		for _, f := range schema.Fields {
+			field := DataPackageField{Name: f.Name, Type: f.Type, Description: f.Description}
+			if f.Type == "datetime" {
+				field.Format = DATAPACKAGE_DATE_FORMAT
+			}
+			resource.Schema.Fields = append(resource.Schema.Fields, field)
+		}
+		for _, fk := range schema.ForeignKeys {
+			resource.Schema.ForeignKeys = append(resource.Schema.ForeignKeys, DataPackageForeignKey{
+				Fields:    fk.Fields,
+				Reference: DataPackageReference{Resource: dataPackageName(fk.Reference), Fields: fk.ReferenceFields},
+			})
+		}
+		dp.Resources = append(dp.Resources, resource)
+	}
+	sort.Slice(dp.Resources, func(i, j int) bool { return dp.Resources[i].Name < dp.Resources[j].Name })
+	return dp
+}
+
+// WriteDataPackage writes the data package of the CSV files as indented JSON.
+func (a *XMLAnalyzer) WriteDataPackage(w io.Writer, header bool) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(a.NewDataPackage(header))
+}
+
+// Writes the data package next to the CSV files.
+func (a *XMLAnalyzer) WriteDataPackageFile(header bool) error {
+	file, err := a.outputFS().OpenFile(a.GetBaseXMLFileName()+DATAPACKAGE_FILE_SUFFIX, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return a.WriteDataPackage(file, header)
+}
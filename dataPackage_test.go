@@ -0,0 +1,157 @@
+package ryde
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// TestRecordSchemas tests that every record type has a schema with a column for every value, and that keys refer to existing columns.
+func TestRecordSchemas(t *testing.T) {
+	records := []Record{
+		DomainRecord{}, DomainStatusRecord{}, DomainNameserverRecord{}, DomainDnssecRecord{}, DomainTransferRecord{},
+		HostRecord{}, HostStatusRecord{}, HostAddressRecord{},
+		ContactRecord{}, ContactStatusRecord{}, ContactPostalInfoRecord{},
+		RegistrarRecord{}, RegistrarPostalInfoRecord{},
+		IDNTableRefRecord{}, NNDNRecord{}, UniqueContactIDRecord{}, OrphanContactRecord{}, OrphanHostRecord{},
+	}
+	for _, r := range records {
+		schema, ok := RecordSchemas[r.RecordType()]
+		if !ok {
+			t.Errorf("No schema for record type %s", r.RecordType())
+			continue
+		}
+		if len(schema.Fields) != len(r.Values()) {
+			t.Errorf("Schema of %s has %d fields, the record has %d values", r.RecordType(), len(schema.Fields), len(r.Values()))
+		}
+		if _, ok := CSVFilesAndSuffixes[r.RecordType()]; !ok {
+			t.Errorf("No CSV file for record type %s", r.RecordType())
+		}
+	}
+	if len(records) != len(RecordSchemas) {
+		t.Errorf("Expected %d schemas, got %d", len(records), len(RecordSchemas))
+	}
+
+	hasFields := func(schema RecordSchema, fields []string) bool {
+		names := strings.Join(schema.FieldNames(), ",")
+		for _, f := range fields {
+			if !strings.Contains(","+names+",", ","+f+",") {
+				return false
+			}
+		}
+		return true
+	}
+	for recordType, schema := range RecordSchemas {
+		if !hasFields(schema, schema.PrimaryKey) {
+			t.Errorf("Primary key %v of %s is not a column", schema.PrimaryKey, recordType)
+		}
+		for _, fk := range schema.ForeignKeys {
+			ref, ok := RecordSchemas[fk.Reference]
+			if !ok {
+				t.Errorf("Foreign key of %s references unknown record type %s", recordType, fk.Reference)
+				continue
+			}
+			if !hasFields(schema, fk.Fields) {
+				t.Errorf("Foreign key %v of %s is not a column", fk.Fields, recordType)
+			}
+			if !reflect.DeepEqual(fk.ReferenceFields, ref.PrimaryKey) {
+				t.Errorf("Foreign key of %s references %v, expected the primary key %v of %s", recordType, fk.ReferenceFields, ref.PrimaryKey, fk.Reference)
+			}
+		}
+	}
+}
+
+func TestDataPackageName(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"test_2019-10-17_FULL_S1_R0", "test_2019-10-17_full_s1_r0"},
+		{"domainNameservers", "domainnameservers"},
+		{"xn--80ak6aa92e_2024-01-01_FULL_S1_R0", "xn--80ak6aa92e_2024-01-01_full_s1_r0"},
+		{"my deposit!", "my-deposit"},
+	}
+	for _, tc := range testCases {
+		if actual := dataPackageName(tc.input); actual != tc.expected {
+			t.Errorf("dataPackageName(%q) = %q, expected %q", tc.input, actual, tc.expected)
+		}
+	}
+}
+
+// TestCSVSinkHeaderAndDataPackage tests that the CSV files start with a header row and that the data package describes them.
+func TestCSVSinkHeaderAndDataPackage(t *testing.T) {
+	testCases := []struct {
+		name   string
+		header bool
+	}{
+		{"with header", true},
+		{"without header", false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fsys := fstest.MapFS{"test_2019-10-17_FULL_S1_R0.xml": &fstest.MapFile{Data: []byte(getValidFullDepositXMLString())}}
+			a, err := NewXMLAnalyzerFS(fsys, "test_2019-10-17_FULL_S1_R0.xml")
+			if err != nil {
+				t.Fatalf("NewXMLAnalyzerFS returned an error: %v", err)
+			}
+			out := NewMemFS()
+			a.OutputFS = out
+			a.Sinks = []OutputSink{&CSVSink{Header: tc.header, DataPackage: true}}
+			if err := a.AnalyzeTags(); err != nil {
+				t.Fatalf("AnalyzeTags failed with error: %v", err)
+			}
+
+			data, err := out.ReadFile("test_2019-10-17_FULL_S1_R0" + DOMAIN_FILE_SUFFIX)
+			if err != nil {
+				t.Fatalf("Failed to read the domain file: %v", err)
+			}
+			rows, err := csv.NewReader(strings.NewReader(string(data))).ReadAll()
+			if err != nil {
+				t.Fatalf("Failed to parse the domain file: %v", err)
+			}
+			expectedRows := a.Counters["domain"]
+			if tc.header {
+				expectedRows++
+				if !reflect.DeepEqual(rows[0], RecordSchemas["domain"].FieldNames()) {
+					t.Errorf("Expected header row %v, got %v", RecordSchemas["domain"].FieldNames(), rows[0])
+				}
+			}
+			if len(rows) != expectedRows {
+				t.Errorf("Expected %d rows, got %d", expectedRows, len(rows))
+			}
+			if a.CSVFiles["domain"].Header != tc.header || a.CSVFiles["domain"].LineCount != expectedRows {
+				t.Errorf("Unexpected header flag %v and line count %d", a.CSVFiles["domain"].Header, a.CSVFiles["domain"].LineCount)
+			}
+
+			data, err = out.ReadFile("test_2019-10-17_FULL_S1_R0" + DATAPACKAGE_FILE_SUFFIX)
+			if err != nil {
+				t.Fatalf("Failed to read the data package: %v", err)
+			}
+			var dp DataPackage
+			if err := json.Unmarshal(data, &dp); err != nil {
+				t.Fatalf("Failed to parse the data package: %v", err)
+			}
+			if dp.Name != "test_2019-10-17_full_s1_r0" || dp.Profile != DATAPACKAGE_PROFILE {
+				t.Errorf("Unexpected data package %s with profile %s", dp.Name, dp.Profile)
+			}
+			if len(dp.Resources) != len(RecordSchemas) {
+				t.Fatalf("Expected %d resources, got %d", len(RecordSchemas), len(dp.Resources))
+			}
+			for _, r := range dp.Resources {
+				if r.Dialect.Header != tc.header {
+					t.Errorf("Expected header %v for resource %s, got %v", tc.header, r.Name, r.Dialect.Header)
+				}
+				if _, err := out.ReadFile(r.Path[0]); err != nil {
+					t.Errorf("Resource %s points to %s which does not exist: %v", r.Name, r.Path, err)
+				}
+			}
+			first := dp.Resources[0]
+			if first.Name != "contact" || first.Schema.PrimaryKey[0] != "id" || first.Schema.Fields[7].Format != DATAPACKAGE_DATE_FORMAT {
+				t.Errorf("Unexpected first resource %+v", first)
+			}
+		})
+	}
+}
@@ -4,8 +4,34 @@ import "fmt"
 
 var (
 	ErrInvalidDepositType     = fmt.Errorf("invalid deposit type, only FULL or DIFF are allowed")
-	ErrInvalidDepositFileName = fmt.Errorf("invalid deposit file name, must end with .xml")
-	ErrNoXMLReader            = fmt.Errorf("XMLFile.osFile is nil, try calling OpenXMLFile() first")
+	ErrInvalidRyDEFileName    = fmt.Errorf("invalid RyDE file name, must be {tld}_{YYYY-MM-DD}_{FULL|DIFF|INCR}_S{seq}_R{resend}")
+	ErrIncompleteSplitDeposit = fmt.Errorf("split deposit is incomplete, the parts must be numbered S1 to Sn")
+	ErrSplitDepositMismatch   = fmt.Errorf("the parts of the split deposit do not belong to the same deposit")
+	ErrInvalidDepositFileName = fmt.Errorf("invalid deposit file name, must end with .ryde, or .xml or .tar optionally followed by .gz, .bz2, .xz or .zst")
+	ErrNoKeyring              = fmt.Errorf("the deposit is encrypted, but no keyring with a private key to decrypt it was provided")
+	ErrNoVerificationKeyring  = fmt.Errorf("a signature file was provided, but no keyring with the public key to verify it")
+	ErrInvalidSignature       = fmt.Errorf("invalid deposit signature")
+	ErrNoRecipients           = fmt.Errorf("no recipient keys to encrypt the deposit to")
+	ErrNoSigner               = fmt.Errorf("no signing key with a decrypted private key to sign the deposit with")
+	ErrUnknownDepositSize     = fmt.Errorf("the size of the deposit XML must be known to package it")
+	ErrNoXMLInTar             = fmt.Errorf("tar archive does not contain an entry matching the deposit XML pattern")
+	ErrUnknownRecordType      = fmt.Errorf("unknown record type")
+	ErrUnsupportedCharset     = fmt.Errorf("unsupported character encoding")
+	ErrUnsupportedSQLDialect  = fmt.Errorf("unsupported SQL dialect, only postgres or sqlite are supported")
+	ErrUnsupportedCompression = fmt.Errorf("unsupported compression, only gzip, bzip2, xz or zstd are supported")
+	ErrNoXMLReader            = fmt.Errorf("XMLFile.file is nil, try calling OpenXMLFile() first")
 	ErrNoXMLDecoder           = fmt.Errorf("XMLFile.Decoder is nil, try calling CreateXMLDecoder() first")
+	ErrMissingBaseName        = fmt.Errorf("a base name for the output files is required when analyzing a stream")
+	ErrStreamAlreadyRead      = fmt.Errorf("the stream has already been read, it can only be analyzed once")
 	ErrNoDepositTagInFile     = fmt.Errorf("reached EOF before finding a <rde:deposit> start element")
+	ErrMissingRuleID          = fmt.Errorf("validation rule is missing an id")
+	ErrDuplicateRuleID        = fmt.Errorf("duplicate validation rule id")
+	ErrInvalidRuleObject      = fmt.Errorf("invalid validation rule object, only domain, host, contact or registrar are allowed")
+	ErrObjectQuarantined      = fmt.Errorf("object could not be decoded and was quarantined")
+	ErrObjectsQuarantined     = fmt.Errorf("analysis finished with quarantined objects")
+	ErrOutputExists           = fmt.Errorf("the output already exists, choose another output directory or overwrite policy")
+	ErrUnsupportedPartition   = fmt.Errorf("unsupported partitioning, only registrar or hash are supported")
+	ErrUnsupportedOverwrite   = fmt.Errorf("unsupported overwrite policy, only fail, truncate or versioned are supported")
+	ErrUnsupportedBundle      = fmt.Errorf("unsupported bundle format, only tar.gz or zip are supported")
+	ErrInvalidRuleSeverity    = fmt.Errorf("invalid validation rule severity, only error, warning or info are allowed")
 )
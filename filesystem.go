@@ -0,0 +1,421 @@
+package ryde
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WritableFile is a file opened for writing in a WritableFS.
+type WritableFile interface {
+	io.WriteCloser
+}
+
+// WritableFS is a filesystem the analyzer can write its output files to.
+// It embeds fs.FS so the output can be read back, e.g. to count the lines in the CSV files.
+type WritableFS interface {
+	fs.FS
+	// OpenFile opens the named file for writing with the given flags (os.O_CREATE, os.O_TRUNC, os.O_APPEND, ...) and permissions.
+	OpenFile(name string, flag int, perm fs.FileMode) (WritableFile, error)
+}
+
+// StagingFS is a WritableFS that can create directories and rename and remove files.
+// The analyzer uses it to write the output to a temporary directory that is renamed into place only when the analysis succeeds.
+// Output written to a WritableFS that does not implement StagingFS is written in place.
+type StagingFS interface {
+	WritableFS
+	// MkdirAll creates the named directory and any missing parents.
+	MkdirAll(name string, perm fs.FileMode) error
+	// MkdirTemp creates a new directory in dir, named after pattern with its last * replaced by a random string, and returns its name.
+	MkdirTemp(dir, pattern string) (string, error)
+	// Rename renames oldname to newname, replacing newname if it exists.
+	Rename(oldname, newname string) error
+	// RemoveAll removes the named file or directory and everything it contains.
+	RemoveAll(name string) error
+}
+
+// OSFS reads and writes files on the host filesystem. Names are host paths, relative to the working directory or absolute.
+// It is the default filesystem of the analyzer.
+// Unlike os.DirFS, names are not restricted to unrooted slash-separated paths, so existing file names keep working.
+type OSFS struct{}
+
+// Open opens the named file for reading.
+func (OSFS) Open(name string) (fs.File, error) {
+	return os.Open(name)
+}
+
+// OpenFile opens the named file for writing.
+func (OSFS) OpenFile(name string, flag int, perm fs.FileMode) (WritableFile, error) {
+	return os.OpenFile(name, flag, perm)
+}
+
+// MkdirAll creates the named directory and any missing parents.
+func (OSFS) MkdirAll(name string, perm fs.FileMode) error {
+	return os.MkdirAll(name, perm)
+}
+
+// MkdirTemp creates a new temporary directory in dir.
+func (OSFS) MkdirTemp(dir, pattern string) (string, error) {
+	return os.MkdirTemp(dir, pattern)
+}
+
+// Rename renames oldname to newname.
+func (OSFS) Rename(oldname, newname string) error {
+	return os.Rename(oldname, newname)
+}
+
+// RemoveAll removes the named file or directory and everything it contains.
+func (OSFS) RemoveAll(name string) error {
+	return os.RemoveAll(name)
+}
+
+// MemFS is an in-memory WritableFS and StagingFS. It is safe for concurrent use.
+// Names must be valid fs paths (see fs.ValidPath). Files and directories opened for reading see the contents at the time they were opened.
+// Directories are implied by the names of the files they contain.
+type MemFS struct {
+	mu    sync.Mutex
+	files map[string]*memFile
+	temps int // The number of temporary directories created, used to name the next one.
+}
+
+type memFile struct {
+	data    []byte
+	mode    fs.FileMode
+	modTime time.Time
+	shared  bool // Whether data was handed to a reader since it was last copied.
+}
+
+// NewMemFS returns an empty MemFS.
+func NewMemFS() *MemFS {
+	return &MemFS{files: make(map[string]*memFile)}
+}
+
+// WriteFile writes data to the named file, replacing it if it exists.
+func (m *MemFS) WriteFile(name string, data []byte) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: "write", Path: name, Err: fs.ErrInvalid}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.files[name] = &memFile{data: bytes.Clone(data), mode: 0666, modTime: time.Now()}
+	return nil
+}
+
+// ReadFile returns a copy of the contents of the named file.
+func (m *MemFS) ReadFile(name string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.files[name]
+	if !ok || !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrNotExist}
+	}
+	return bytes.Clone(f.data), nil
+}
+
+// Names returns the names of all files in the MemFS, sorted.
+func (m *MemFS) Names() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := make([]string, 0, len(m.files))
+	for name := range m.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Open opens the named file or directory for reading.
+func (m *MemFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if f, ok := m.files[name]; ok {
+		// Writes never change the bytes a reader has, see memFileWriter.Write, so the file can be read without copying it
+		f.shared = true
+		return &memReader{Reader: bytes.NewReader(f.data), info: f.info(name)}, nil
+	}
+	if !m.isDir(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return &memDir{info: memDirInfo(name), entries: m.readDir(name)}, nil
+}
+
+// Stat returns a FileInfo describing the named file or directory.
+func (m *MemFS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if f, ok := m.files[name]; ok {
+		return f.info(name), nil
+	}
+	if !m.isDir(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return memDirInfo(name), nil
+}
+
+// ReadDir reads the named directory and returns its entries sorted by name.
+func (m *MemFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.files[name]; ok || !m.isDir(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	return m.readDir(name), nil
+}
+
+// OpenFile opens the named file for writing.
+func (m *MemFS) OpenFile(name string, flag int, perm fs.FileMode) (WritableFile, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.files[name]
+	switch {
+	case !ok && flag&os.O_CREATE == 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	case ok && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+	case !ok:
+		f = &memFile{mode: perm}
+		m.files[name] = f
+	case flag&os.O_TRUNC != 0:
+		f.data = nil
+	}
+	f.modTime = time.Now()
+	w := &memFileWriter{fs: m, file: f}
+	if flag&os.O_APPEND != 0 {
+		w.offset = len(f.data)
+	}
+	return w, nil
+}
+
+// MkdirAll only checks the name, the directories of a MemFS exist as long as they contain files.
+func (m *MemFS) MkdirAll(name string, perm fs.FileMode) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrInvalid}
+	}
+	return nil
+}
+
+// MkdirTemp returns the name of a new directory in dir that no file is in yet.
+func (m *MemFS) MkdirTemp(dir, pattern string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for {
+		m.temps++
+		name := pattern + strconv.Itoa(m.temps)
+		if i := strings.LastIndex(pattern, "*"); i >= 0 {
+			name = pattern[:i] + strconv.Itoa(m.temps) + pattern[i+1:]
+		}
+		name = path.Join(dir, name)
+		if !fs.ValidPath(name) {
+			return "", &fs.PathError{Op: "mkdirtemp", Path: name, Err: fs.ErrInvalid}
+		}
+		if !m.exists(name) {
+			return name, nil
+		}
+	}
+}
+
+// Rename renames the file oldname to newname, replacing newname if it exists.
+func (m *MemFS) Rename(oldname, newname string) error {
+	if !fs.ValidPath(newname) {
+		return &fs.PathError{Op: "rename", Path: newname, Err: fs.ErrInvalid}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.files[oldname]
+	if !ok {
+		return &fs.PathError{Op: "rename", Path: oldname, Err: fs.ErrNotExist}
+	}
+	delete(m.files, oldname)
+	m.files[newname] = f
+	return nil
+}
+
+// RemoveAll removes the named file, or all files in the named directory.
+func (m *MemFS) RemoveAll(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for n := range m.files {
+		if n == name || strings.HasPrefix(n, name+"/") {
+			delete(m.files, n)
+		}
+	}
+	return nil
+}
+
+// Checks if name is a file or a directory with files in it. The caller holds the lock.
+func (m *MemFS) exists(name string) bool {
+	for n := range m.files {
+		if n == name || strings.HasPrefix(n, name+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks if name is the root or a directory with files in it. The caller holds the lock.
+func (m *MemFS) isDir(name string) bool {
+	if name == "." {
+		return true
+	}
+	for n := range m.files {
+		if strings.HasPrefix(n, name+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the files and directories in the named directory, sorted by name. The caller holds the lock.
+func (m *MemFS) readDir(name string) []fs.DirEntry {
+	prefix := name + "/"
+	if name == "." {
+		prefix = ""
+	}
+	entries := map[string]fs.DirEntry{}
+	for n, f := range m.files {
+		rest, ok := strings.CutPrefix(n, prefix)
+		if !ok {
+			continue
+		}
+		if child, _, isDir := strings.Cut(rest, "/"); isDir {
+			entries[child] = fs.FileInfoToDirEntry(memDirInfo(child))
+		} else {
+			entries[child] = fs.FileInfoToDirEntry(f.info(child))
+		}
+	}
+	list := make([]fs.DirEntry, 0, len(entries))
+	for _, entry := range entries {
+		list = append(list, entry)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name() < list[j].Name() })
+	return list
+}
+
+// Returns the FileInfo of the file with the given name. The caller holds the lock.
+func (f *memFile) info(name string) memFileInfo {
+	return memFileInfo{name: path.Base(name), size: int64(len(f.data)), mode: f.mode, modTime: f.modTime}
+}
+
+// Returns the FileInfo of the directory with the given name. Directories are implied by their files, so they have no modification time.
+func memDirInfo(name string) memFileInfo {
+	return memFileInfo{name: path.Base(name), mode: fs.ModeDir | 0777}
+}
+
+// memFileInfo describes a file or directory in a MemFS.
+type memFileInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (i memFileInfo) Name() string       { return i.name }
+func (i memFileInfo) Size() int64        { return i.size }
+func (i memFileInfo) Mode() fs.FileMode  { return i.mode }
+func (i memFileInfo) ModTime() time.Time { return i.modTime }
+func (i memFileInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i memFileInfo) Sys() any           { return nil }
+
+// memReader reads a file in a MemFS, as it was when it was opened.
+type memReader struct {
+	*bytes.Reader
+	info memFileInfo
+}
+
+func (r *memReader) Stat() (fs.FileInfo, error) {
+	return r.info, nil
+}
+
+func (r *memReader) Close() error {
+	return nil
+}
+
+// memDir is a directory in a MemFS opened for reading, with the entries it had when it was opened.
+type memDir struct {
+	info    memFileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *memDir) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *memDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: fs.ErrInvalid}
+}
+
+func (d *memDir) Close() error {
+	return nil
+}
+
+// ReadDir returns the next n entries of the directory, or all remaining entries if n <= 0, like os.File.ReadDir.
+func (d *memDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	rest := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	rest = rest[:min(n, len(rest))]
+	d.offset += len(rest)
+	return rest, nil
+}
+
+// memFileWriter writes to a file in a MemFS, starting at the beginning of the file unless it was opened with os.O_APPEND, like os.File.
+type memFileWriter struct {
+	fs     *MemFS
+	file   *memFile
+	offset int
+	closed bool
+}
+
+func (w *memFileWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, fs.ErrClosed
+	}
+	w.fs.mu.Lock()
+	defer w.fs.mu.Unlock()
+	end := w.offset + len(p)
+	if w.file.shared && w.offset < len(w.file.data) {
+		// Readers share the data of the file, so bytes they can see are overwritten in a copy. Appended bytes are beyond what they read.
+		w.file.data = bytes.Clone(w.file.data)
+		w.file.shared = false
+	}
+	if end > len(w.file.data) {
+		w.file.data = append(w.file.data, make([]byte, end-len(w.file.data))...)
+	}
+	copy(w.file.data[w.offset:], p)
+	w.offset = end
+	w.file.modTime = time.Now()
+	return len(p), nil
+}
+
+func (w *memFileWriter) Close() error {
+	if w.closed {
+		return fs.ErrClosed
+	}
+	w.closed = true
+	return nil
+}
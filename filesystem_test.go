@@ -0,0 +1,170 @@
+package ryde
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// TestMemFS tests writing, appending to and reading files in a MemFS.
+func TestMemFS(t *testing.T) {
+	m := NewMemFS()
+	if _, err := m.OpenFile("out/test.csv", os.O_WRONLY, 0666); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("Expected fs.ErrNotExist, got %v", err)
+	}
+	if _, err := m.OpenFile("/out/test.csv", os.O_CREATE|os.O_WRONLY, 0666); !errors.Is(err, fs.ErrInvalid) {
+		t.Fatalf("Expected fs.ErrInvalid, got %v", err)
+	}
+
+	tests := []struct {
+		flag     int
+		write    string
+		expected string
+	}{
+		{os.O_CREATE | os.O_WRONLY, "hello world", "hello world"},
+		{os.O_CREATE | os.O_WRONLY, "HELLO", "HELLO world"},
+		{os.O_WRONLY | os.O_APPEND, "!", "HELLO world!"},
+		{os.O_CREATE | os.O_WRONLY | os.O_TRUNC, "bye", "bye"},
+	}
+	for _, test := range tests {
+		w, err := m.OpenFile("out/test.csv", test.flag, 0666)
+		if err != nil {
+			t.Fatalf("OpenFile returned an error: %v", err)
+		}
+		w.Write([]byte(test.write))
+		w.Close()
+		data, err := m.ReadFile("out/test.csv")
+		if err != nil {
+			t.Fatalf("ReadFile returned an error: %v", err)
+		}
+		if string(data) != test.expected {
+			t.Errorf("Expected %q, got %q", test.expected, data)
+		}
+	}
+
+	if _, err := m.OpenFile("out/test.csv", os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0666); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("Expected fs.ErrExist, got %v", err)
+	}
+	if err := fstest.TestFS(m, "out/test.csv"); err != nil {
+		t.Errorf("MemFS does not behave like a fs.FS: %v", err)
+	}
+}
+
+// TestMemFSOpen tests that files and directories opened for reading see the contents at the time they were opened.
+func TestMemFSOpen(t *testing.T) {
+	m := NewMemFS()
+	m.WriteFile("out/test.csv", []byte("hello world"))
+	m.WriteFile("out/sub/test.csv", []byte("sub"))
+	r, err := m.Open("out/test.csv")
+	if err != nil {
+		t.Fatalf("Open returned an error: %v", err)
+	}
+	dir, err := m.Open("out")
+	if err != nil {
+		t.Fatalf("Open returned an error: %v", err)
+	}
+	for _, flag := range []int{os.O_WRONLY, os.O_WRONLY | os.O_APPEND, os.O_WRONLY | os.O_TRUNC} {
+		w, _ := m.OpenFile("out/test.csv", flag, 0666)
+		w.Write([]byte("HELLO"))
+		w.Close()
+	}
+	m.WriteFile("out/new.csv", nil)
+
+	data, err := io.ReadAll(r)
+	if err != nil || string(data) != "hello world" {
+		t.Errorf("Expected %q, got %q (%v)", "hello world", data, err)
+	}
+	entries, err := dir.(fs.ReadDirFile).ReadDir(-1)
+	if err != nil || len(entries) != 2 || entries[0].Name() != "sub" || !entries[0].IsDir() || entries[1].Name() != "test.csv" || entries[1].IsDir() {
+		t.Errorf("Unexpected directory entries %v (%v)", entries, err)
+	}
+	if data, _ := m.ReadFile("out/test.csv"); string(data) != "HELLO" {
+		t.Errorf("Expected %q, got %q", "HELLO", data)
+	}
+	if _, err := m.Stat("out/missing.csv"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected fs.ErrNotExist, got %v", err)
+	}
+	if _, err := m.ReadDir("out/test.csv"); err == nil {
+		t.Errorf("Expected an error reading a file as a directory")
+	}
+}
+
+// TestMemFSStaging tests creating temporary directories in a MemFS, renaming files out of them and removing them.
+func TestMemFSStaging(t *testing.T) {
+	m := NewMemFS()
+	dir, err := m.MkdirTemp("out", ".staging-*")
+	if err != nil || dir != "out/.staging-1" {
+		t.Fatalf("Expected out/.staging-1, got %s %v", dir, err)
+	}
+	m.WriteFile(dir+"/a.csv", []byte("a"))
+	m.WriteFile(dir+"/b.csv", []byte("b"))
+	if next, _ := m.MkdirTemp("out", ".staging-*"); next == dir {
+		t.Errorf("Expected a new temporary directory, got %s", next)
+	}
+	if err := m.Rename(dir+"/a.csv", "out/a.csv"); err != nil {
+		t.Fatalf("Rename returned an error: %v", err)
+	}
+	if err := m.Rename(dir+"/c.csv", "out/c.csv"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected fs.ErrNotExist, got %v", err)
+	}
+	if err := m.RemoveAll(dir); err != nil {
+		t.Fatalf("RemoveAll returned an error: %v", err)
+	}
+	if names := m.Names(); len(names) != 1 || names[0] != "out/a.csv" {
+		t.Errorf("Expected only out/a.csv, got %v", names)
+	}
+}
+
+// TestAnalyzeTagsFS tests analyzing deposits from an in-memory filesystem and a zip file, writing the output to a MemFS.
+func TestAnalyzeTagsFS(t *testing.T) {
+	deposit := []byte(getValidFullDepositXMLString())
+	var zipped bytes.Buffer
+	zw := zip.NewWriter(&zipped)
+	w, _ := zw.Create("deposits/test_2019-10-17_FULL_S1_R0.xml")
+	w.Write(deposit)
+	zw.Close()
+	zr, err := zip.NewReader(bytes.NewReader(zipped.Bytes()), int64(zipped.Len()))
+	if err != nil {
+		t.Fatalf("Failed to read zip: %v", err)
+	}
+
+	inputs := map[string]fs.FS{
+		"map": fstest.MapFS{"deposits/test_2019-10-17_FULL_S1_R0.xml": &fstest.MapFile{Data: deposit}},
+		"zip": zr,
+	}
+	for name, fsys := range inputs {
+		t.Run(name, func(t *testing.T) {
+			a, err := NewXMLAnalyzerFS(fsys, "deposits/test_2019-10-17_FULL_S1_R0.xml")
+			if err != nil {
+				t.Fatalf("NewXMLAnalyzerFS returned an error: %v", err)
+			}
+			if a.XMLFile.FileSize != int64(len(deposit)) {
+				t.Errorf("Expected file size %d, got %d", len(deposit), a.XMLFile.FileSize)
+			}
+			out := NewMemFS()
+			a.OutputFS = out
+			if err := a.AnalyzeTags(); err != nil {
+				t.Fatalf("AnalyzeTags failed with error: %v", err)
+			}
+			if err := a.CountLinesInCSVFilesAndSaveSize(); err != nil {
+				t.Fatalf("CountLinesInCSVFilesAndSaveSize failed with error: %v", err)
+			}
+			if a.CSVFiles["domain"].LineCount != 2 {
+				t.Errorf("Expected 2 lines in the domain CSV, got %d", a.CSVFiles["domain"].LineCount)
+			}
+			data, err := out.ReadFile("deposits/test_2019-10-17_FULL_S1_R0" + FINDINGS_JSON_FILE_SUFFIX)
+			if err != nil || !strings.Contains(string(data), `"depositId": "20191017001"`) {
+				t.Errorf("Expected the findings report in the output, got %s %v", data, err)
+			}
+			if _, err := os.Stat("deposits"); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("Expected no output on disk, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,317 @@
+package ryde
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"sort"
+)
+
+// Finding represents a problem found in the deposit, either by a built-in check or by a user defined ValidationRule.
+type Finding struct {
+	RuleID   string         `json:"ruleId"`          // The stable ID of the rule that produced the finding.
+	Severity string         `json:"severity"`        // The severity of the finding: error, warning or info.
+	Object   string         `json:"object"`          // The type of object the finding applies to.
+	Key      string         `json:"key"`             // The key of the object (domain name, host name, contact ID or registrar ID).
+	Field    string         `json:"field,omitempty"` // The path of the field the finding applies to, if known.
+	Message  string         `json:"message"`         // A human readable description of the finding.
+	Position SourcePosition `json:"position"`        // The location of the object in the XML source.
+}
+
+// SourcePosition represents a location in the XML source as reported by the xml.Decoder.
+// The XML source is the UTF-8 XML the decoder reads: the deposit after decompression, decryption and conversion to UTF-8.
+type SourcePosition struct {
+	Offset int64 `json:"offset"` // The byte offset from the start of the UTF-8 XML source, only the same as the offset in the file for uncompressed UTF-8 XML files.
+	Line   int   `json:"line"`   // The 1-based line number.
+	Column int   `json:"column"` // The 1-based column number.
+}
+
+// FindingsReport is the machine-readable report of all findings for a deposit.
+type FindingsReport struct {
+	File      string    `json:"file"`      // The name of the XML file that was analyzed.
+	DepositID string    `json:"depositId"` // The ID of the deposit.
+	Watermark string    `json:"watermark"` // The watermark of the deposit.
+	Findings  []Finding `json:"findings"`  // The findings in document order.
+}
+
+// BuiltinRule describes a check that is performed by the analyzer itself.
+type BuiltinRule struct {
+	ID          string // The stable ID of the rule.
+	Severity    string // The severity of findings produced by the rule.
+	Description string // A short description of the rule.
+}
+
+const (
+	RULE_HEADER_COUNT_MISMATCH     = "RDE001"
+	RULE_FILE_NAME_INVALID         = "RDE002"
+	RULE_FILE_NAME_TYPE_MISMATCH   = "RDE003"
+	RULE_FILE_NAME_RESEND_MISMATCH = "RDE004"
+	RULE_FILE_NAME_DATE_MISMATCH   = "RDE005"
+	RULE_FILE_NAME_TLD_MISMATCH    = "RDE006"
+)
+
+// BuiltinRules holds the checks that are performed by the analyzer itself, keyed by rule ID.
+var BuiltinRules = map[string]BuiltinRule{
+	RULE_HEADER_COUNT_MISMATCH:     {RULE_HEADER_COUNT_MISMATCH, SEVERITY_ERROR, "The number of objects in the deposit does not match the count in the header"},
+	RULE_FILE_NAME_INVALID:         {RULE_FILE_NAME_INVALID, SEVERITY_WARNING, "The file name does not follow the RyDE naming convention"},
+	RULE_FILE_NAME_TYPE_MISMATCH:   {RULE_FILE_NAME_TYPE_MISMATCH, SEVERITY_ERROR, "The type in the file name does not match the deposit type"},
+	RULE_FILE_NAME_RESEND_MISMATCH: {RULE_FILE_NAME_RESEND_MISMATCH, SEVERITY_ERROR, "The resend number in the file name does not match the deposit resend attribute"},
+	RULE_FILE_NAME_DATE_MISMATCH:   {RULE_FILE_NAME_DATE_MISMATCH, SEVERITY_ERROR, "The date in the file name does not match the deposit watermark"},
+	RULE_FILE_NAME_TLD_MISMATCH:    {RULE_FILE_NAME_TLD_MISMATCH, SEVERITY_ERROR, "The TLD in the file name does not match the header TLD"},
+}
+
+// Maps the object URIs used in the header counts to the counter that holds the number of objects of that type.
+var headerCountCounters = map[string]string{
+	NameSpace["rdeDomain"]:    "domain",
+	NameSpace["rdeHost"]:      "host",
+	NameSpace["rdeContact"]:   "contact",
+	NameSpace["rdeRegistrar"]: "registrar",
+	NameSpace["rdeIDN"]:       "idnTableRef",
+	NameSpace["rdeNNDN"]:      "nndn",
+}
+
+// Returns the current position of the XML decoder.
+func (a *XMLAnalyzer) currentPosition() SourcePosition {
+	line, column := a.XMLFile.Decoder.InputPos()
+	return SourcePosition{
+		Offset: a.XMLFile.Decoder.InputOffset(),
+		Line:   line,
+		Column: column,
+	}
+}
+
+// Adds a finding for a built-in rule to the analyzer.
+func (a *XMLAnalyzer) addBuiltinFinding(ruleID, object, key, field, message string, pos SourcePosition) {
+	a.Findings = append(a.Findings, Finding{
+		RuleID:   ruleID,
+		Severity: BuiltinRules[ruleID].Severity,
+		Object:   object,
+		Key:      key,
+		Field:    field,
+		Message:  message,
+		Position: pos,
+	})
+}
+
+// Compares the object counts in the header against the number of objects found in the deposit and adds a finding for each mismatch.
+func (a *XMLAnalyzer) reconcileHeaderCounts() {
+	for _, result := range a.headerCountResults() {
+		if !result.Match {
+			message := fmt.Sprintf("header count for %s is %d, but the deposit contains %d", result.Object, result.HeaderCount, result.Found)
+			if result.Quarantined > 0 {
+				message += fmt.Sprintf(" and %d quarantined", result.Quarantined)
+			}
+			a.addBuiltinFinding(RULE_HEADER_COUNT_MISMATCH, "header", a.Header.TLD, "count["+result.URI+"]", message, a.headerPosition)
+		}
+	}
+}
+
+// HeaderCountResult compares the number of objects of a type in the header with the number of objects found in the deposit.
+type HeaderCountResult struct {
+	URI         string `json:"uri"`                   // The URI of the object type in the header.
+	Object      string `json:"object"`                // The counter of the object type, e.g. domain.
+	HeaderCount int    `json:"headerCount"`           // The number of objects according to the header.
+	Found       int    `json:"found"`                 // The number of objects found in the deposit and written to the output.
+	Quarantined int    `json:"quarantined,omitempty"` // The number of objects that could not be decoded and were quarantined, which are not in Found.
+	Match       bool   `json:"match"`                 // Whether the counts are the same.
+}
+
+// Returns the result of comparing every header count of an object type we count with the counters.
+// Quarantined objects are not in the output, so they do not count as found.
+func (a *XMLAnalyzer) headerCountResults() []HeaderCountResult {
+	var results []HeaderCountResult
+	for _, count := range a.Header.Count {
+		uri := StandardizeString(count.Uri)
+		counter, ok := headerCountCounters[uri]
+		if !ok {
+			continue
+		}
+		found := a.Counters[counter] - a.quarantinedObjects[counter]
+		results = append(results, HeaderCountResult{uri, counter, count.ID, found, a.quarantinedObjects[counter], found == count.ID})
+	}
+	return results
+}
+
+// Returns the findings report for the analyzer.
+func (a *XMLAnalyzer) FindingsReport() FindingsReport {
+	findings := a.Findings
+	if findings == nil {
+		findings = []Finding{}
+	}
+	return FindingsReport{
+		File:      a.XMLFile.FileName,
+		DepositID: a.Deposit.ID,
+		Watermark: a.Deposit.Watermark,
+		Findings:  findings,
+	}
+}
+
+// WriteFindingsJSON writes the findings report as indented JSON to w.
+func (a *XMLAnalyzer) WriteFindingsJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(a.FindingsReport())
+}
+
+// The subset of the SARIF 2.1.0 format (https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html) we use to report findings.
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool      sarifTool       `json:"tool"`
+	Artifacts []sarifArtifact `json:"artifacts,omitempty"`
+	Results   []sarifResult   `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string             `json:"id"`
+	ShortDescription     sarifMessage       `json:"shortDescription"`
+	DefaultConfiguration sarifConfiguration `json:"defaultConfiguration"`
+}
+
+type sarifConfiguration struct {
+	Level string `json:"level"`
+}
+
+type sarifArtifact struct {
+	Location sarifArtifactLocation `json:"location"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation  `json:"physicalLocation"`
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation *sarifArtifactLocation `json:"artifactLocation,omitempty"` // Left out for deposits read from a stream.
+	Region           sarifRegion            `json:"region"`
+}
+
+type sarifRegion struct {
+	StartLine   int    `json:"startLine,omitempty"`
+	StartColumn int    `json:"startColumn,omitempty"`
+	ByteOffset  *int64 `json:"byteOffset,omitempty"` // Left out when the offsets of the findings are not offsets in the file.
+}
+
+type sarifLogicalLocation struct {
+	Name               string `json:"name"`
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+	Kind               string `json:"kind"`
+}
+
+// Maps finding severities to SARIF result levels.
+var sarifLevels = map[string]string{
+	SEVERITY_ERROR:   "error",
+	SEVERITY_WARNING: "warning",
+	SEVERITY_INFO:    "note",
+}
+
+// Checks if the offsets of the positions are offsets in the XML file, which they are not when the file is compressed, encrypted,
+// a tar archive or converted to UTF-8.
+func (a *XMLAnalyzer) offsetsInFile() bool {
+	return (a.XMLFile.Compression == "" || a.XMLFile.Compression == COMPRESSION_NONE) && !a.XMLFile.Encrypted && len(a.XMLFile.TarEntries) == 0 && !a.XMLFile.transcoded
+}
+
+// Returns the location of the XML file as a relative URI reference, with slashes and escaped characters, or nil for a stream, which has no location.
+func (a *XMLAnalyzer) sarifArtifactLocation() *sarifArtifactLocation {
+	if a.XMLFile.stream != nil || a.XMLFile.FileName == "" {
+		return nil
+	}
+	uri := &url.URL{Path: filepath.ToSlash(a.XMLFile.FileName)}
+	return &sarifArtifactLocation{uri.String()}
+}
+
+// WriteFindingsSARIF writes the findings as a SARIF 2.1.0 log to w.
+// Both the built-in rules and the user defined rules are listed as rules of the tool driver.
+func (a *XMLAnalyzer) WriteFindingsSARIF(w io.Writer) error {
+	driver := sarifDriver{
+		Name:           "ryde",
+		InformationURI: "https://github.com/onasunnymorning/ryde",
+		Rules:          []sarifRule{},
+	}
+	ids := make([]string, 0, len(BuiltinRules))
+	for id := range BuiltinRules {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		rule := BuiltinRules[id]
+		driver.Rules = append(driver.Rules, sarifRule{rule.ID, sarifMessage{rule.Description}, sarifConfiguration{sarifLevels[rule.Severity]}})
+	}
+	for _, rule := range a.Rules {
+		driver.Rules = append(driver.Rules, sarifRule{rule.ID, sarifMessage{rule.Message}, sarifConfiguration{sarifLevels[rule.Severity]}})
+	}
+
+	artifact := a.sarifArtifactLocation()
+	var artifacts []sarifArtifact
+	if artifact != nil {
+		artifacts = []sarifArtifact{{*artifact}}
+	}
+	results := make([]sarifResult, 0, len(a.Findings))
+	offsetsInFile := a.offsetsInFile()
+	for _, f := range a.Findings {
+		region := sarifRegion{StartLine: f.Position.Line, StartColumn: f.Position.Column}
+		if offsetsInFile {
+			region.ByteOffset = &f.Position.Offset
+		}
+		fqn := f.Object + "/" + f.Key
+		if f.Field != "" {
+			fqn += "/" + f.Field
+		}
+		results = append(results, sarifResult{
+			RuleID:  f.RuleID,
+			Level:   sarifLevels[f.Severity],
+			Message: sarifMessage{f.Message},
+			Locations: []sarifLocation{{
+				PhysicalLocation: sarifPhysicalLocation{
+					ArtifactLocation: artifact,
+					Region:           region,
+				},
+				LogicalLocations: []sarifLogicalLocation{{f.Key, fqn, "object"}},
+			}},
+		})
+	}
+
+	log := sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs: []sarifRun{{
+			Tool:      sarifTool{driver},
+			Artifacts: artifacts,
+			Results:   results,
+		}},
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(log)
+}
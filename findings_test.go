@@ -0,0 +1,155 @@
+package ryde
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestFindingsPositions tests that findings point to the start of the object in the XML source.
+func TestFindingsPositions(t *testing.T) {
+	f, err := createValidXMLDepositTestFile()
+	if err != nil {
+		t.Fatalf("Failed to create temporary file: %v", err)
+	}
+	defer os.Remove(f)
+	a, err := NewXMLAnalyzer(f)
+	if err != nil {
+		t.Fatalf("NewXMLAnalyzer returned an error: %s", err)
+	}
+	a.Rules, err = ParseValidationRules(strings.NewReader(`[{"id":"HOST002","object":"host","severity":"info","field":"Addr","message":"host has more than two addresses","expr":"len(Addr) <= 2"}]`))
+	if err != nil {
+		t.Fatalf("ParseValidationRules returned an error: %s", err)
+	}
+	err = a.AnalyzeTags()
+	if err != nil {
+		t.Fatalf("AnalyzeTags failed with error: %v", err)
+	}
+	if len(a.Findings) != 1 {
+		t.Fatalf("Expected 1 finding, got %d: %v", len(a.Findings), a.Findings)
+	}
+	xmlString := getValidFullDepositXMLString()
+	offset := strings.Index(xmlString, "<rdeHost:host>")
+	line := strings.Count(xmlString[:offset], "\n") + 1
+	column := offset - strings.LastIndex(xmlString[:offset], "\n")
+	got := a.Findings[0]
+	if got.Position.Offset != int64(offset) || got.Position.Line != line || got.Position.Column != column {
+		t.Errorf("Expected position %d %d:%d, got %d %d:%d", offset, line, column, got.Position.Offset, got.Position.Line, got.Position.Column)
+	}
+	if got.Key != "ns1.example1.example" || got.Field != "Addr" || got.Object != "host" {
+		t.Errorf("Unexpected finding %v", got)
+	}
+}
+
+// TestReconcileHeaderCounts tests that a mismatch between the header counts and the counters results in a finding.
+func TestReconcileHeaderCounts(t *testing.T) {
+	a := &XMLAnalyzer{
+		Header: XMLHeaderUnMarshall{
+			TLD: "test",
+			Count: []HeaderURICount{
+				{Uri: NameSpace["rdeDomain"], ID: 2},
+				{Uri: NameSpace["rdeHost"], ID: 1},
+				{Uri: NameSpace["rdeEppParams"], ID: 1},
+			},
+		},
+		Counters: map[string]int{"domain": 2, "host": 3},
+	}
+	a.reconcileHeaderCounts()
+	if len(a.Findings) != 1 {
+		t.Fatalf("Expected 1 finding, got %d: %v", len(a.Findings), a.Findings)
+	}
+	if a.Findings[0].RuleID != RULE_HEADER_COUNT_MISMATCH || a.Findings[0].Severity != SEVERITY_ERROR {
+		t.Errorf("Unexpected finding %v", a.Findings[0])
+	}
+}
+
+// TestWriteFindingsReports tests that the JSON and SARIF reports can be decoded and contain the findings.
+func TestWriteFindingsReports(t *testing.T) {
+	a := &XMLAnalyzer{
+		XMLFile: XMLFile{FileName: "test.xml"},
+		Deposit: XMLDepositUnMarshall{ID: "1", Watermark: "2019-10-17T00:00:00Z"},
+		Rules:   []ValidationRule{{ID: "NS001", Object: "domain", Severity: SEVERITY_WARNING, Message: "too many nameservers"}},
+		Findings: []Finding{
+			{RuleID: "NS001", Severity: SEVERITY_WARNING, Object: "domain", Key: "example.example", Field: "Ns", Message: "too many nameservers", Position: SourcePosition{100, 5, 3}},
+			{RuleID: RULE_HEADER_COUNT_MISMATCH, Severity: SEVERITY_ERROR, Object: "header", Key: "example", Message: "mismatch", Position: SourcePosition{10, 2, 3}},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := a.WriteFindingsJSON(&buf); err != nil {
+		t.Fatalf("WriteFindingsJSON returned an error: %s", err)
+	}
+	var report FindingsReport
+	if err := json.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatalf("Failed to decode findings JSON: %s", err)
+	}
+	if report.DepositID != "1" || len(report.Findings) != 2 || report.Findings[0].Position.Offset != 100 {
+		t.Errorf("Unexpected findings report %v", report)
+	}
+
+	buf.Reset()
+	if err := a.WriteFindingsSARIF(&buf); err != nil {
+		t.Fatalf("WriteFindingsSARIF returned an error: %s", err)
+	}
+	var sarif sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &sarif); err != nil {
+		t.Fatalf("Failed to decode SARIF: %s", err)
+	}
+	if sarif.Version != "2.1.0" || len(sarif.Runs) != 1 {
+		t.Fatalf("Unexpected SARIF log %v", sarif)
+	}
+	run := sarif.Runs[0]
+	if len(run.Tool.Driver.Rules) != len(BuiltinRules)+1 {
+		t.Errorf("Expected %d rules, got %d", len(BuiltinRules)+1, len(run.Tool.Driver.Rules))
+	}
+	if len(run.Results) != 2 || run.Results[0].Level != "warning" || run.Results[0].Locations[0].PhysicalLocation.Region.StartLine != 5 {
+		t.Errorf("Unexpected SARIF results %v", run.Results)
+	}
+	if run.Results[0].Locations[0].LogicalLocations[0].FullyQualifiedName != "domain/example.example/Ns" {
+		t.Errorf("Unexpected logical location %v", run.Results[0].Locations[0].LogicalLocations[0])
+	}
+	if offset := run.Results[0].Locations[0].PhysicalLocation.Region.ByteOffset; offset == nil || *offset != 100 {
+		t.Errorf("Expected byte offset 100, got %v", offset)
+	}
+
+	if uri := run.Artifacts[0].Location.URI; uri != "test.xml" || run.Results[0].Locations[0].PhysicalLocation.ArtifactLocation.URI != uri {
+		t.Errorf("Expected the artifact URI test.xml, got %v", run.Artifacts)
+	}
+
+	// The artifact is a relative URI reference, and a stream has none
+	tests := []struct {
+		xmlFile  XMLFile
+		expected string
+	}{
+		{XMLFile{FileName: "deposits/my deposit#1.xml"}, `"uri": "deposits/my%20deposit%231.xml"`},
+		{XMLFile{FileName: "c:deposit.xml"}, `"uri": "./c:deposit.xml"`},
+		{XMLFile{FileName: "-", stream: strings.NewReader("")}, ""},
+	}
+	for _, test := range tests {
+		a.XMLFile = test.xmlFile
+		buf.Reset()
+		if err := a.WriteFindingsSARIF(&buf); err != nil {
+			t.Fatalf("WriteFindingsSARIF returned an error: %s", err)
+		}
+		if test.expected == "" && (strings.Contains(buf.String(), "artifact") || strings.Contains(buf.String(), `"uri"`)) {
+			t.Errorf("Expected no artifact for a stream, got %s", buf.String())
+		}
+		if test.expected != "" && strings.Count(buf.String(), test.expected) != 3 {
+			t.Errorf("Expected the artifact and both results to have %s, got %s", test.expected, buf.String())
+		}
+	}
+
+	// The offsets in the converted or decompressed XML are not offsets in the file, so they are left out
+	for _, xmlFile := range []XMLFile{{FileName: "test.xml", transcoded: true}, {FileName: "test.xml.gz", Compression: COMPRESSION_GZIP}} {
+		a.XMLFile = xmlFile
+		buf.Reset()
+		if err := a.WriteFindingsSARIF(&buf); err != nil {
+			t.Fatalf("WriteFindingsSARIF returned an error: %s", err)
+		}
+		if strings.Contains(buf.String(), "byteOffset") {
+			t.Errorf("Expected no byte offsets for %+v, got %s", xmlFile, buf.String())
+		}
+	}
+}
@@ -1,3 +1,31 @@
 module github.com/onasunnymorning/ryde
 
-go 1.21.3
+go 1.24.9
+
+require (
+	github.com/expr-lang/expr v1.17.8
+	github.com/klauspost/compress v1.17.9
+	github.com/ulikunitz/xz v0.5.12
+)
+
+require (
+	github.com/parquet-go/parquet-go v0.32.0
+	golang.org/x/text v0.14.0
+)
+
+require (
+	github.com/andybalholm/brotli v1.1.1 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/parquet-go/bitpack v1.0.0 // indirect
+	github.com/parquet-go/jsonlite v1.0.0 // indirect
+	github.com/pierrec/lz4/v4 v4.1.21 // indirect
+	github.com/twpayne/go-geom v1.6.1 // indirect
+	google.golang.org/protobuf v1.34.2 // indirect
+)
+
+require (
+	github.com/ProtonMail/go-crypto v1.1.6
+	github.com/cloudflare/circl v1.3.7 // indirect
+	golang.org/x/crypto v0.17.0 // indirect
+	golang.org/x/sys v0.38.0 // indirect
+)
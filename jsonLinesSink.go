@@ -0,0 +1,70 @@
+package ryde
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+)
+
+// JSONLine is a line of JSON Lines output: the type of an object and the object itself.
+// The field names of the objects are the names of the XML elements and attributes they are decoded from, e.g. {"type":"host","object":{"name":"ns1.example.example","addr":[{"ip":"v4","address":"192.0.2.1"}],...}}.
+type JSONLine struct {
+	Type   string `json:"type"`
+	Object any    `json:"object"`
+}
+
+// JSONLinesSink writes every domain, host, contact, registrar, NNDN and IDN table reference as a nested JSON document on its own line.
+// The lines are written to Writer, e.g. os.Stdout to pipe them into jq. If Writer is nil they are written to the file FileName in the output
+// filesystem, or to a file named after the XML file with JSONL_FILE_SUFFIX if FileName is empty. Like the other output files, the file is
+// written to the staging directory first and follows the Overwrite and Bundle options.
+type JSONLinesSink struct {
+	Writer   io.Writer
+	FileName string
+	file     WritableFile
+	buf      *bufio.Writer
+	enc      *json.Encoder
+}
+
+// Begin creates the output file if no Writer is set.
+func (s *JSONLinesSink) Begin(a *XMLAnalyzer) error {
+	w := s.Writer
+	if w == nil {
+		name := s.FileName
+		if name == "" {
+			name = a.GetBaseXMLFileName() + JSONL_FILE_SUFFIX
+		}
+		file, err := a.outputFS().OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+		if err != nil {
+			return err
+		}
+		s.file = file
+		w = file
+	}
+	s.buf = bufio.NewWriter(w)
+	s.enc = json.NewEncoder(s.buf)
+	s.enc.SetEscapeHTML(false)
+	return nil
+}
+
+// WriteRecord ignores the flat records, the objects they are derived from are written by WriteObject.
+func (s *JSONLinesSink) WriteRecord(r Record) error {
+	return nil
+}
+
+// WriteObject writes the object as a JSONLine, with its strings standardized like the values of the records.
+func (s *JSONLinesSink) WriteObject(objectType string, object any) error {
+	return s.enc.Encode(JSONLine{objectType, StandardizeObject(object)})
+}
+
+// End flushes the lines and closes the output file if the sink created it.
+func (s *JSONLinesSink) End(a *XMLAnalyzer) error {
+	err := s.buf.Flush()
+	if s.file != nil {
+		if closeErr := s.file.Close(); err == nil {
+			err = closeErr
+		}
+		s.file = nil
+	}
+	return err
+}
@@ -0,0 +1,156 @@
+package ryde
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// TestJSONLinesSink tests that every object is written as a nested JSON document on its own line.
+func TestJSONLinesSink(t *testing.T) {
+	fsys := fstest.MapFS{"test_2019-10-17_FULL_S1_R0.xml": &fstest.MapFile{Data: []byte(getValidFullDepositXMLString())}}
+	a, err := NewXMLAnalyzerFS(fsys, "test_2019-10-17_FULL_S1_R0.xml")
+	if err != nil {
+		t.Fatalf("NewXMLAnalyzerFS returned an error: %v", err)
+	}
+	a.OutputFS = NewMemFS()
+	var buf bytes.Buffer
+	a.Sinks = []OutputSink{&JSONLinesSink{Writer: &buf}}
+	if err := a.AnalyzeTags(); err != nil {
+		t.Fatalf("AnalyzeTags failed with error: %v", err)
+	}
+
+	types := map[string]int{}
+	objects := map[string]map[string]any{}
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var line struct {
+			Type   string         `json:"type"`
+			Object map[string]any `json:"object"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("Line %q is not valid JSON: %v", scanner.Text(), err)
+		}
+		types[line.Type]++
+		objects[line.Type] = line.Object
+	}
+	for objectType, counter := range map[string]string{"domain": "domain", "host": "host", "contact": "contact", "registrar": "registrar", "nndn": "nndn", "idnTableRef": "idnTableRef"} {
+		if types[objectType] != a.Counters[counter] {
+			t.Errorf("Expected %d %s lines, got %d", a.Counters[counter], objectType, types[objectType])
+		}
+	}
+
+	domain := objects["domain"]
+	if domain["name"] != "example2.example" || len(domain["status"].([]any)) != 2 {
+		t.Errorf("Unexpected domain %v", domain)
+	}
+	if _, ok := domain["trnData"]; ok {
+		t.Errorf("Expected no trnData for a domain without a transfer, got %v", domain["trnData"])
+	}
+	host := objects["host"]
+	addr := host["addr"].([]any)
+	if len(addr) != 3 || addr[2].(map[string]any)["address"] != "2001:DB8:1::1" || addr[2].(map[string]any)["ip"] != "v6" {
+		t.Errorf("Unexpected host addresses %v", addr)
+	}
+}
+
+// TestJSONLinesSinkFile tests that the lines are written next to the CSV files if no writer is set.
+func TestJSONLinesSinkFile(t *testing.T) {
+	fsys := fstest.MapFS{"test_2019-10-17_FULL_S1_R0.xml": &fstest.MapFile{Data: []byte(getValidFullDepositXMLString())}}
+	a, err := NewXMLAnalyzerFS(fsys, "test_2019-10-17_FULL_S1_R0.xml")
+	if err != nil {
+		t.Fatalf("NewXMLAnalyzerFS returned an error: %v", err)
+	}
+	out := NewMemFS()
+	a.OutputFS = out
+	a.Sinks = []OutputSink{&JSONLinesSink{}}
+	if err := a.AnalyzeTags(); err != nil {
+		t.Fatalf("AnalyzeTags failed with error: %v", err)
+	}
+	data, err := out.ReadFile("test_2019-10-17_FULL_S1_R0" + JSONL_FILE_SUFFIX)
+	if err != nil {
+		t.Fatalf("Failed to read the JSON Lines file: %v", err)
+	}
+	if !strings.HasPrefix(string(data), `{"type":"domain","object":{"name":"example1.example"`) || !strings.Contains(string(data), `"whoisInfo":{"name":"whois.example.example","url":"http://whois.example.example"}`) {
+		t.Errorf("Unexpected JSON Lines output %s", data)
+	}
+}
+
+// TestJSONLinesSinkFileName tests that the lines are written to FileName through the output filesystem, so they are staged and follow the Overwrite option.
+func TestJSONLinesSinkFileName(t *testing.T) {
+	fsys := fstest.MapFS{"test_2019-10-17_FULL_S1_R0.xml": &fstest.MapFile{Data: []byte(getValidFullDepositXMLString())}}
+	out := NewMemFS()
+	for _, overwrite := range []string{OVERWRITE_TRUNCATE, OVERWRITE_FAIL} {
+		a, err := NewXMLAnalyzerFS(fsys, "test_2019-10-17_FULL_S1_R0.xml")
+		if err != nil {
+			t.Fatalf("NewXMLAnalyzerFS returned an error: %v", err)
+		}
+		a.OutputFS = out
+		// Only the JSON Lines file is in the same place in both runs
+		a.OutputDir = overwrite
+		a.Overwrite = overwrite
+		a.Sinks = []OutputSink{&JSONLinesSink{FileName: "objects.jsonl"}}
+		err = a.AnalyzeTags()
+		if overwrite == OVERWRITE_FAIL {
+			if !errors.Is(err, ErrOutputExists) {
+				t.Errorf("Expected ErrOutputExists for an existing JSON Lines file, got %v", err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("AnalyzeTags failed with error: %v", err)
+		}
+	}
+	data, err := out.ReadFile("objects.jsonl")
+	if err != nil {
+		t.Fatalf("Failed to read the JSON Lines file: %v", err)
+	}
+	if !strings.HasPrefix(string(data), `{"type":"domain","object":{"name":"example1.example"`) {
+		t.Errorf("Unexpected JSON Lines output %s", data)
+	}
+	for _, name := range out.Names() {
+		if strings.Contains(name, ".ryde-staging-") || strings.HasSuffix(name, JSONL_FILE_SUFFIX) && name != "objects.jsonl" {
+			t.Errorf("Unexpected output file %s", name)
+		}
+	}
+}
+
+// TestObjectJSONFieldNames tests that the JSON field names are the names of the XML elements and attributes.
+func TestObjectJSONFieldNames(t *testing.T) {
+	testCases := []struct {
+		name     string
+		object   any
+		expected string
+	}{
+		{
+			name:     "host",
+			object:   XMLHost{Name: "ns1.example.example", RoID: "H1-TEST", Status: []XMLHostStatus{{"ok"}}, Addr: []XMLHostAddr{{"v4", "192.0.2.1"}}, ClID: "RegistrarX"},
+			expected: `{"name":"ns1.example.example","roid":"H1-TEST","status":[{"s":"ok"}],"addr":[{"ip":"v4","address":"192.0.2.1"}],"clID":"RegistrarX"}`,
+		},
+		{
+			name:     "domain with DS record and transfer",
+			object:   XMLDomain{Name: "example.example", SecDNS: XMLSecDNS{[]DSData{{12345, 8, 2, "ABCD"}}}, TrnData: TrnData{TrStatus: TrStatus{"pending"}, ReRr: ReRr{RegID: "RegistrarX"}}},
+			expected: `{"name":"example.example","roid":"","clID":"","secDNS":{"dsData":[{"keyTag":12345,"alg":8,"digestType":2,"digest":"ABCD"}]},"trnData":{"trStatus":{"state":"pending"},"reRr":{"id":"RegistrarX"},"acRr":{"id":""}}}`,
+		},
+		{
+			name:     "nndn",
+			object:   XMLNNDN{AName: "blocked.example", NameState: "blocked"},
+			expected: `{"aName":"blocked.example","nameState":"blocked"}`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := json.Marshal(tc.object)
+			if err != nil {
+				t.Fatalf("Marshal returned an error: %v", err)
+			}
+			if string(actual) != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, actual)
+			}
+		})
+	}
+}
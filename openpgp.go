@@ -0,0 +1,129 @@
+package ryde
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+)
+
+// The OpenPGP packet tags an encrypted message starts with: a public-key or a symmetric-key encrypted session key.
+const (
+	openPGPTagPublicKeyEncryptedSessionKey    = 1
+	openPGPTagSymmetricKeyEncryptedSessionKey = 3
+)
+
+// The header of an ASCII armored OpenPGP message.
+var openPGPArmoredMessageHeader = []byte("-----BEGIN PGP MESSAGE-----")
+
+// LoadKeyring reads an armored or binary OpenPGP keyring from filename.
+// If passphrase is not empty, the encrypted private keys in the keyring are decrypted with it.
+func LoadKeyring(filename string, passphrase []byte) (openpgp.EntityList, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadKeyring(f, passphrase)
+}
+
+// ReadKeyring reads an armored or binary OpenPGP keyring from r.
+// If passphrase is not empty, the encrypted private keys in the keyring are decrypted with it.
+func ReadKeyring(r io.Reader, passphrase []byte) (openpgp.EntityList, error) {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(10)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	var keyring openpgp.EntityList
+	if bytes.HasPrefix(head, []byte("-----BEGIN")) {
+		keyring, err = openpgp.ReadArmoredKeyRing(br)
+	} else {
+		keyring, err = openpgp.ReadKeyRing(br)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading keyring: %s", err)
+	}
+	if len(passphrase) > 0 {
+		for _, entity := range keyring {
+			if err := entity.DecryptPrivateKeys(passphrase); err != nil {
+				return nil, fmt.Errorf("error decrypting private keys: %s", err)
+			}
+		}
+	}
+	return keyring, nil
+}
+
+// IsOpenPGPMessage checks if the stream in br is an encrypted OpenPGP message, armored or binary, by peeking at its first bytes without consuming them.
+func IsOpenPGPMessage(br *bufio.Reader) (bool, error) {
+	head, err := br.Peek(len(openPGPArmoredMessageHeader))
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return false, err
+	}
+	if len(head) == 0 {
+		return false, nil
+	}
+	if bytes.HasPrefix(head, openPGPArmoredMessageHeader) {
+		return true, nil
+	}
+	// The first bit of an OpenPGP packet header is always set. The tag is in bits 5-0 for new format headers and bits 5-2 for old format headers.
+	b := head[0]
+	if b&0x80 == 0 {
+		return false, nil
+	}
+	tag := (b & 0x3f) >> 2
+	if b&0x40 != 0 {
+		tag = b & 0x3f
+	}
+	return tag == openPGPTagPublicKeyEncryptedSessionKey || tag == openPGPTagSymmetricKeyEncryptedSessionKey, nil
+}
+
+// Checks if the XML reader is an encrypted OpenPGP message and if so, returns a reader that decrypts it with the private keys in a.Keyring.
+// The plaintext is streamed and never written to disk.
+func (a *XMLAnalyzer) decryptXMLReader(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	encrypted, err := IsOpenPGPMessage(br)
+	if err != nil {
+		return nil, err
+	}
+	if !encrypted {
+		return br, nil
+	}
+	if len(a.Keyring) == 0 {
+		return nil, ErrNoKeyring
+	}
+	var msg io.Reader = br
+	if head, _ := br.Peek(len(openPGPArmoredMessageHeader)); bytes.Equal(head, openPGPArmoredMessageHeader) {
+		block, err := armor.Decode(br)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding armored message: %s", err)
+		}
+		msg = block.Body
+	}
+	md, err := openpgp.ReadMessage(msg, a.Keyring, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting deposit: %s", err)
+	}
+	a.XMLFile.Encrypted = true
+	if md.DecryptedWith.PublicKey != nil {
+		a.XMLFile.DecryptionKeyID = md.DecryptedWith.PublicKey.KeyIdString()
+	}
+	a.XMLFile.decrypted = md.UnverifiedBody
+	return md.UnverifiedBody, nil
+}
+
+// Reads the rest of the decrypted message. OpenPGP only checks the integrity of a message once it has been read entirely,
+// while the analysis stops reading at the end of the deposit XML.
+func (a *XMLAnalyzer) verifyDecryptedXMLReader() error {
+	if a.XMLFile.decrypted == nil {
+		return nil
+	}
+	if _, err := io.Copy(io.Discard, a.XMLFile.decrypted); err != nil {
+		return fmt.Errorf("error verifying the integrity of the decrypted deposit: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package ryde
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+)
+
+// Returns a new OpenPGP entity for testing.
+func createTestEntity(t *testing.T) *openpgp.Entity {
+	e, err := openpgp.NewEntity("Escrow Agent", "test", "escrow@example.com", nil)
+	if err != nil {
+		t.Fatalf("Failed to create entity: %v", err)
+	}
+	return e
+}
+
+// Encrypts data to the given entity, optionally ASCII armored.
+func encryptTestData(t *testing.T, data []byte, to *openpgp.Entity, armored bool) []byte {
+	var buf bytes.Buffer
+	var w io.WriteCloser = nopWriteCloser{&buf}
+	if armored {
+		var err error
+		w, err = armor.Encode(&buf, "PGP MESSAGE", nil)
+		if err != nil {
+			t.Fatalf("Failed to create armor encoder: %v", err)
+		}
+	}
+	pw, err := openpgp.Encrypt(w, []*openpgp.Entity{to}, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+	pw.Write(data)
+	pw.Close()
+	w.Close()
+	return buf.Bytes()
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// TestLoadKeyring tests loading armored and binary keyrings, with and without a passphrase.
+func TestLoadKeyring(t *testing.T) {
+	e := createTestEntity(t)
+	passphrase := []byte("secret")
+	if err := e.EncryptPrivateKeys(passphrase, nil); err != nil {
+		t.Fatalf("Failed to encrypt private keys: %v", err)
+	}
+	var binary bytes.Buffer
+	if err := e.SerializePrivateWithoutSigning(&binary, nil); err != nil {
+		t.Fatalf("Failed to serialize entity: %v", err)
+	}
+	var armored bytes.Buffer
+	aw, _ := armor.Encode(&armored, openpgp.PrivateKeyType, nil)
+	aw.Write(binary.Bytes())
+	aw.Close()
+
+	dir := t.TempDir()
+	for name, content := range map[string][]byte{"keyring.gpg": binary.Bytes(), "keyring.asc": armored.Bytes()} {
+		t.Run(name, func(t *testing.T) {
+			filename := filepath.Join(dir, name)
+			os.WriteFile(filename, content, 0666)
+
+			keyring, err := LoadKeyring(filename, passphrase)
+			if err != nil {
+				t.Fatalf("LoadKeyring returned an error: %v", err)
+			}
+			if len(keyring) != 1 || keyring[0].PrivateKey.Encrypted {
+				t.Errorf("Expected 1 decrypted private key, got %v", keyring)
+			}
+			if _, err := LoadKeyring(filename, []byte("wrong")); err == nil {
+				t.Errorf("Expected an error for a wrong passphrase")
+			}
+		})
+	}
+}
+
+// TestIsOpenPGPMessage tests the detection of encrypted OpenPGP messages.
+func TestIsOpenPGPMessage(t *testing.T) {
+	e := createTestEntity(t)
+	tests := []struct {
+		name     string
+		data     []byte
+		expected bool
+	}{
+		{"binary", encryptTestData(t, []byte("data"), e, false), true},
+		{"armored", encryptTestData(t, []byte("data"), e, true), true},
+		{"xml", []byte("<?xml version=\"1.0\"?>"), false},
+		{"gzip", []byte{0x1f, 0x8b, 0x08}, false},
+		{"empty", []byte{}, false},
+	}
+	for _, test := range tests {
+		encrypted, err := IsOpenPGPMessage(bufio.NewReader(bytes.NewReader(test.data)))
+		if err != nil {
+			t.Fatalf("%s: IsOpenPGPMessage returned an error: %v", test.name, err)
+		}
+		if encrypted != test.expected {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, encrypted)
+		}
+	}
+}
+
+// TestAnalyzeTagsEncrypted tests that an encrypted, compressed tar is decrypted and analyzed in a single pass.
+func TestAnalyzeTagsEncrypted(t *testing.T) {
+	e := createTestEntity(t)
+	data := createTestTar(t, map[string]string{"test_2019-10-17_FULL_S1_R0.xml": getValidFullDepositXMLString()}, []string{"test_2019-10-17_FULL_S1_R0.xml"})
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write(data)
+	zw.Close()
+
+	for _, armored := range []bool{false, true} {
+		filename := filepath.Join(t.TempDir(), "test_2019-10-17_FULL_S1_R0.ryde")
+		os.WriteFile(filename, encryptTestData(t, gz.Bytes(), e, armored), 0666)
+
+		a, err := NewXMLAnalyzer(filename)
+		if err != nil {
+			t.Fatalf("NewXMLAnalyzer returned an error: %v", err)
+		}
+		if err := a.AnalyzeTags(); !errors.Is(err, ErrNoKeyring) {
+			t.Fatalf("Expected ErrNoKeyring, got %v", err)
+		}
+
+		a.Keyring = openpgp.EntityList{e}
+		if err := a.AnalyzeTags(); err != nil {
+			t.Fatalf("AnalyzeTags failed with error: %v", err)
+		}
+		if !a.XMLFile.Encrypted || a.XMLFile.DecryptionKeyID == "" || a.XMLFile.Compression != COMPRESSION_GZIP || len(a.XMLFile.TarEntries) != 1 {
+			t.Errorf("Unexpected XML file %+v", a.XMLFile)
+		}
+		if a.Counters["domain"] != 2 {
+			t.Errorf("Expected 2 domains, got %d", a.Counters["domain"])
+		}
+	}
+}
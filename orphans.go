@@ -0,0 +1,101 @@
+package ryde
+
+import (
+	"sort"
+	"strings"
+)
+
+// objectReferences keeps track of the contacts and hosts in the deposit and of the ones that are referenced by domains, so we can report orphans.
+type objectReferences struct {
+	contacts           map[string]string // The IDs of the contact objects in the deposit, by ID.
+	hosts              map[string]string // The names of the host objects in the deposit as they appear in it, by their lower case name.
+	referencedContacts map[string]bool   // The contact IDs referenced by domains, as registrant or contact.
+	referencedHosts    map[string]bool   // The host names domains delegate to.
+	uniqueContactIDs   map[string]bool   // The contact IDs domains reference as contact, as they appear in the deposit.
+}
+
+func newObjectReferences() *objectReferences {
+	return &objectReferences{
+		contacts:           make(map[string]string),
+		hosts:              make(map[string]string),
+		referencedContacts: make(map[string]bool),
+		referencedHosts:    make(map[string]bool),
+		uniqueContactIDs:   make(map[string]bool),
+	}
+}
+
+// Host names are case insensitive, so we compare them in lower case.
+func hostKey(name string) string {
+	return strings.ToLower(StandardizeString(name))
+}
+
+// Adds a contact object that was found in the deposit.
+func (r *objectReferences) addContact(id string) {
+	id = StandardizeString(id)
+	r.contacts[id] = id
+}
+
+// Adds a host object that was found in the deposit. The name is kept as it appears in the deposit, so orphans are reported like in the host file.
+func (r *objectReferences) addHost(name string) {
+	r.hosts[hostKey(name)] = StandardizeString(name)
+}
+
+// Adds the contacts and hosts referenced by a domain.
+func (r *objectReferences) addDomain(dom *XMLDomain) {
+	if dom.Registrant != "" {
+		r.referencedContacts[StandardizeString(dom.Registrant)] = true
+	}
+	for _, contact := range dom.Contact {
+		r.referencedContacts[StandardizeString(contact.ID)] = true
+	}
+	for _, ns := range dom.Ns {
+		for _, host := range ns.HostObjs {
+			r.referencedHosts[hostKey(host)] = true
+		}
+	}
+}
+
+// Returns the sorted contact IDs of contacts that are not referenced by any domain.
+func (r *objectReferences) orphanContacts() []string {
+	return unreferenced(r.contacts, r.referencedContacts)
+}
+
+// Returns the sorted names of hosts that no domain delegates to.
+func (r *objectReferences) orphanHosts() []string {
+	return unreferenced(r.hosts, r.referencedHosts)
+}
+
+// Returns the sorted names of the objects whose keys are not in references.
+func unreferenced(objects map[string]string, references map[string]bool) []string {
+	orphans := []string{}
+	for k, name := range objects {
+		if !references[k] {
+			orphans = append(orphans, name)
+		}
+	}
+	sort.Strings(orphans)
+	return orphans
+}
+
+// Writes the orphaned contacts and hosts to the output sinks and counts them.
+// DIFF and INCR deposits only contain the objects that changed, so a domain referencing a contact or host may not be part of it. We only report orphans for FULL deposits.
+func (a *XMLAnalyzer) writeOrphans() error {
+	if !strings.EqualFold(a.Deposit.Type, "FULL") {
+		return nil
+	}
+	for _, id := range a.references.orphanContacts() {
+		a.Counters["orphanContact"]++
+		err := a.writeRecord(OrphanContactRecord{id})
+		if err != nil {
+			return err
+		}
+	}
+	for _, name := range a.references.orphanHosts() {
+		a.Counters["orphanHost"]++
+		err := a.writeRecord(OrphanHostRecord{name})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
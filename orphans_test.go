@@ -0,0 +1,99 @@
+package ryde
+
+import (
+	"encoding/csv"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// TestObjectReferences tests that contacts and hosts that are not referenced by any domain are reported as orphans.
+func TestObjectReferences(t *testing.T) {
+	r := newObjectReferences()
+	r.addContact("jd1234")
+	r.addContact("sh8013")
+	r.addContact("orphan2")
+	r.addContact("orphan1")
+	r.addHost("NS1.example.example")
+	r.addHost("NS2.Example.EXAMPLE")
+	r.addDomain(&XMLDomain{
+		Registrant: "jd1234",
+		Contact:    []XMLDomainContact{{Type: "admin", ID: "sh8013\n  "}},
+		Ns:         []XMLDomainHost{{HostObjs: []string{"ns1.EXAMPLE.example", "ns1.example.com"}}},
+	})
+
+	if got, want := r.orphanContacts(), []string{"orphan1", "orphan2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("orphanContacts() = %v, want %v", got, want)
+	}
+	if got, want := r.orphanHosts(), []string{"NS2.Example.EXAMPLE"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("orphanHosts() = %v, want %v", got, want)
+	}
+}
+
+// TestAnalyzeTagsOrphans tests that orphaned contacts and hosts are counted and written to their CSV files, with the host name as it is in the deposit.
+func TestAnalyzeTagsOrphans(t *testing.T) {
+	orphans := `<rdeContact:contact>
+		  <rdeContact:id>orphan1</rdeContact:id>
+		  <rdeContact:roid>Corphan1-TEST</rdeContact:roid>
+		</rdeContact:contact>
+		<rdeHost:host>
+		  <rdeHost:name>NS2.Example2.EXAMPLE</rdeHost:name>
+		  <rdeHost:roid>Hns2_example_test-TEST</rdeHost:roid>
+		</rdeHost:host>
+		<!-- Registrar: RegistrarX -->`
+	f, err := createXMLDepositTestFileWithReplacements("<!-- Registrar: RegistrarX -->", orphans)
+	if err != nil {
+		t.Fatalf("Failed to create temporary file: %v", err)
+	}
+	defer os.Remove(f)
+	a, err := NewXMLAnalyzer(f)
+	if err != nil {
+		t.Fatalf("NewXMLAnalyzer returned an error: %s", err)
+	}
+	err = a.AnalyzeTags()
+	if err != nil {
+		t.Fatalf("AnalyzeTags failed with error: %v", err)
+	}
+	if a.Counters["orphanContact"] != 1 || a.Counters["orphanHost"] != 1 {
+		t.Errorf("Expected 1 orphaned contact and host, got %d and %d", a.Counters["orphanContact"], a.Counters["orphanHost"])
+	}
+
+	for k, want := range map[string]string{"orphanContact": "orphan1", "orphanHost": "NS2.Example2.EXAMPLE"} {
+		file, err := os.Open(a.CSVFiles[k].FileName)
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", a.CSVFiles[k].FileName, err)
+		}
+		rows, err := csv.NewReader(file).ReadAll()
+		file.Close()
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", a.CSVFiles[k].FileName, err)
+		}
+		if len(rows) != 1 || rows[0][0] != want {
+			t.Errorf("Expected %s to contain %s, got %v", a.CSVFiles[k].FileName, want, rows)
+		}
+	}
+}
+
+// TestAnalyzeTagsNoOrphansForDiff tests that orphans are not reported for DIFF and INCR deposits, which only contain changed objects.
+func TestAnalyzeTagsNoOrphansForDiff(t *testing.T) {
+	for _, depositType := range []string{"DIFF", "INCR"} {
+		t.Run(depositType, func(t *testing.T) {
+			f, err := createXMLDepositTestFileWithReplacements(`type="FULL"`, `type="`+depositType+`"`, "<rdeDomain:ns>", "<rdeDomain:foo>", "</rdeDomain:ns>", "</rdeDomain:foo>")
+			if err != nil {
+				t.Fatalf("Failed to create temporary file: %v", err)
+			}
+			defer os.Remove(f)
+			a, err := NewXMLAnalyzer(f)
+			if err != nil {
+				t.Fatalf("NewXMLAnalyzer returned an error: %s", err)
+			}
+			err = a.AnalyzeTags()
+			if err != nil {
+				t.Fatalf("AnalyzeTags failed with error: %v", err)
+			}
+			if a.Counters["orphanHost"] != 0 {
+				t.Errorf("Expected no orphaned hosts for a %s deposit, got %d", depositType, a.Counters["orphanHost"])
+			}
+		})
+	}
+}
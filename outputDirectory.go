@@ -0,0 +1,185 @@
+package ryde
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	OVERWRITE_TRUNCATE     = "truncate"        // Replace the output files of an earlier analysis. The default.
+	OVERWRITE_FAIL         = "fail"            // Fail if an output file already exists.
+	OVERWRITE_VERSIONED    = "versioned"       // Write the output to the next free subdirectory v1, v2, ... of a directory named after the base name.
+	OUTPUT_STAGING_PATTERN = ".ryde-staging-*" // The name of the temporary directory the output is written to, next to the output files.
+)
+
+// stagedFS writes the output files to the staging directory instead of their own directory, under the same base name.
+type stagedFS struct {
+	WritableFS
+	dir string
+}
+
+func (s stagedFS) staged(name string) string {
+	return filepath.Join(s.dir, filepath.Base(name))
+}
+
+func (s stagedFS) Open(name string) (fs.File, error) {
+	return s.WritableFS.Open(s.staged(name))
+}
+
+func (s stagedFS) OpenFile(name string, flag int, perm fs.FileMode) (WritableFile, error) {
+	return s.WritableFS.OpenFile(s.staged(name), flag, perm)
+}
+
+// Checks if the named file or directory exists in fsys.
+func outputExists(fsys fs.FS, name string) bool {
+	_, err := fs.Stat(fsys, name)
+	return err == nil
+}
+
+// Resolves the base name of the output files according to the OutputDir and Overwrite policy, and creates the staging directory
+// if the output filesystem is a StagingFS.
+func (a *XMLAnalyzer) prepareOutput() error {
+	a.outputBase = ""
+	a.stagingDir = ""
+	err := a.checkBundle()
+	if err != nil {
+		return err
+	}
+	base := a.GetBaseXMLFileName()
+	fsys := a.baseOutputFS()
+	switch a.Overwrite {
+	case "", OVERWRITE_TRUNCATE:
+	case OVERWRITE_FAIL:
+		// The analysis report is always written, so it tells whether an earlier analysis wrote output here
+		if outputExists(fsys, base+ANALYSYS_FILE_SUFFIX) {
+			return fmt.Errorf("%w: %s", ErrOutputExists, base+ANALYSYS_FILE_SUFFIX)
+		}
+		if a.Bundle != "" && outputExists(fsys, a.bundleFileName()) {
+			return fmt.Errorf("%w: %s", ErrOutputExists, a.bundleFileName())
+		}
+	case OVERWRITE_VERSIONED:
+		for n := 1; ; n++ {
+			dir := filepath.Join(base, "v"+strconv.Itoa(n))
+			if !outputExists(fsys, dir) {
+				base = filepath.Join(dir, filepath.Base(base))
+				break
+			}
+		}
+	default:
+		return fmt.Errorf("%w: %q", ErrUnsupportedOverwrite, a.Overwrite)
+	}
+	a.outputBase = base
+
+	staging, ok := fsys.(StagingFS)
+	if !ok {
+		return nil
+	}
+	dir := filepath.Dir(base)
+	err = staging.MkdirAll(dir, 0777)
+	if err != nil {
+		return err
+	}
+	// The staging directory is on the same filesystem as the output, so the files can be renamed into place
+	a.stagingDir, err = staging.MkdirTemp(dir, OUTPUT_STAGING_PATTERN)
+	return err
+}
+
+// Moves the output files from the staging directory into place and removes it. The analysis report, or the bundle it is in, is moved last,
+// so output with an analysis report is complete. With OVERWRITE_FAIL nothing is moved if any of the output files exists.
+// With OVERWRITE_TRUNCATE the report of an earlier analysis and the output files it lists are removed first, so no stale shards,
+// quarantine files or manifests are left next to the new output, and no report describes a mix of old and new files.
+func (a *XMLAnalyzer) finalizeOutput() error {
+	if a.stagingDir == "" {
+		return nil
+	}
+	staging := a.baseOutputFS().(StagingFS)
+	stagingDir := a.stagingDir
+	a.stagingDir = ""
+	defer staging.RemoveAll(stagingDir)
+
+	report := a.GetBaseXMLFileName() + ANALYSYS_FILE_SUFFIX
+	var names []string
+	for _, name := range a.outputFiles {
+		if name != report {
+			names = append(names, name)
+		}
+	}
+	if slices.Contains(a.outputFiles, report) {
+		names = append(names, report)
+	}
+	if a.Overwrite == OVERWRITE_FAIL {
+		for _, name := range names {
+			if outputExists(staging, name) {
+				return fmt.Errorf("%w: %s", ErrOutputExists, name)
+			}
+		}
+	}
+	if a.Overwrite == "" || a.Overwrite == OVERWRITE_TRUNCATE {
+		err := a.removePreviousOutput(staging)
+		if err != nil {
+			return err
+		}
+	}
+	for _, name := range names {
+		err := staging.Rename(filepath.Join(stagingDir, filepath.Base(name)), name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Removes the analysis report of an earlier analysis with the same base name and the output files it lists, the report first.
+// Only files with the base name in the output directory are removed, so a report that lists other files cannot remove them.
+func (a *XMLAnalyzer) removePreviousOutput(staging StagingFS) error {
+	base := a.GetBaseXMLFileName()
+	report := base + ANALYSYS_FILE_SUFFIX
+	data, err := fs.ReadFile(staging, report)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var previous AnalysisReport
+	if err := json.Unmarshal(data, &previous); err != nil {
+		log.Printf("Not removing the output of the earlier analysis, %s is not an analysis report: %s\n", report, err)
+		return nil
+	}
+	err = staging.RemoveAll(report)
+	if err != nil {
+		return err
+	}
+	dir, prefix := filepath.Dir(base), filepath.Base(base)
+	for _, output := range previous.Outputs {
+		name := filepath.Base(output.FileName)
+		if filepath.Dir(output.FileName) != dir || !strings.HasPrefix(name, prefix+"-") && !strings.HasPrefix(name, prefix+".") {
+			continue
+		}
+		err := staging.RemoveAll(output.FileName)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Removes the staging directory with the output of a failed analysis, so it cannot be mistaken for complete output.
+func (a *XMLAnalyzer) discardOutput() {
+	if a.stagingDir == "" {
+		return
+	}
+	err := a.baseOutputFS().(StagingFS).RemoveAll(a.stagingDir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Printf("Failed to remove the staging directory %s: %s\n", a.stagingDir, err)
+	}
+	a.stagingDir = ""
+	a.outputFiles = nil
+}
@@ -0,0 +1,176 @@
+package ryde
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// Returns an analyzer for the valid deposit in an in-memory filesystem, writing to out.
+func newMemAnalyzer(t *testing.T, deposit string, out *MemFS) *XMLAnalyzer {
+	fsys := fstest.MapFS{"deposits/test_2019-10-17_FULL_S1_R0.xml": &fstest.MapFile{Data: []byte(deposit)}}
+	a, err := NewXMLAnalyzerFS(fsys, "deposits/test_2019-10-17_FULL_S1_R0.xml")
+	if err != nil {
+		t.Fatalf("NewXMLAnalyzerFS returned an error: %v", err)
+	}
+	a.OutputFS = out
+	return a
+}
+
+// TestGetBaseXMLFileNameOutputDir tests that OutputDir replaces the directory of the base name.
+func TestGetBaseXMLFileNameOutputDir(t *testing.T) {
+	tests := []struct {
+		fileName  string
+		baseName  string
+		outputDir string
+		expected  string
+	}{
+		{"in/test.xml", "", "", "in/test"},
+		{"in/test.xml", "", "out", "out/test"},
+		{"in/test.xml.gz", "", "out/csv", "out/csv/test"},
+		{"in/test.xml", "other/name", "out", "out/name"},
+	}
+	for _, test := range tests {
+		a := &XMLAnalyzer{XMLFile: XMLFile{FileName: test.fileName}, BaseName: test.baseName, OutputDir: test.outputDir}
+		if got := a.GetBaseXMLFileName(); got != test.expected {
+			t.Errorf("Expected %s for %v, got %s", test.expected, test, got)
+		}
+	}
+}
+
+// TestAnalyzeTagsTruncatesOutput tests that the output of an earlier, bigger deposit is replaced, not overwritten in place.
+func TestAnalyzeTagsTruncatesOutput(t *testing.T) {
+	dir := t.TempDir()
+	f := filepath.Join(dir, "test_2019-10-17_FULL_S1_R0.xml")
+	if err := os.WriteFile(f, []byte(getValidFullDepositXMLString()), 0666); err != nil {
+		t.Fatalf("Failed to write the deposit: %v", err)
+	}
+	domains := filepath.Join(dir, "out", "test_2019-10-17_FULL_S1_R0"+DOMAIN_FILE_SUFFIX)
+	os.Mkdir(filepath.Join(dir, "out"), 0777)
+	if err := os.WriteFile(domains, []byte(strings.Repeat("stale,row\n", 100)), 0666); err != nil {
+		t.Fatalf("Failed to write the stale output: %v", err)
+	}
+	a, err := NewXMLAnalyzer(f)
+	if err != nil {
+		t.Fatalf("NewXMLAnalyzer returned an error: %v", err)
+	}
+	a.OutputDir = filepath.Join(dir, "out")
+	if err := a.AnalyzeTags(); err != nil {
+		t.Fatalf("AnalyzeTags failed with error: %v", err)
+	}
+	data, err := os.ReadFile(domains)
+	if err != nil {
+		t.Fatalf("Failed to read the domain CSV: %v", err)
+	}
+	if strings.Contains(string(data), "stale") || strings.Count(string(data), "\n") != 2 {
+		t.Errorf("Expected 2 fresh domain rows, got %s", data)
+	}
+	entries, _ := os.ReadDir(a.OutputDir)
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".ryde-staging-") {
+			t.Errorf("Expected the staging directory to be removed, found %s", e.Name())
+		}
+	}
+}
+
+// TestAnalyzeTagsRemovesStaleOutput tests that a re-run that writes fewer files removes the files of the earlier run that it does not replace.
+func TestAnalyzeTagsRemovesStaleOutput(t *testing.T) {
+	out := NewMemFS()
+	a := newMemAnalyzer(t, getValidFullDepositXMLString(), out)
+	a.Sinks = []OutputSink{&CSVSink{MaxRows: 1}}
+	if err := a.AnalyzeTags(); err != nil {
+		t.Fatalf("AnalyzeTags failed with error: %v", err)
+	}
+	base := "deposits/test_2019-10-17_FULL_S1_R0"
+	if _, err := out.ReadFile(base + "-domains.001.csv"); err != nil {
+		t.Fatalf("Expected two domain shards: %v", err)
+	}
+	// Files of another deposit and files the report does not list are left alone
+	out.WriteFile("deposits/other"+DOMAIN_FILE_SUFFIX, []byte("other,row\n"))
+	out.WriteFile(base+"-notes.txt", []byte("notes\n"))
+
+	a = newMemAnalyzer(t, getValidFullDepositXMLString(), out)
+	if err := a.AnalyzeTags(); err != nil {
+		t.Fatalf("AnalyzeTags failed with error: %v", err)
+	}
+	listed := map[string]bool{base + ANALYSYS_FILE_SUFFIX: true, "deposits/other" + DOMAIN_FILE_SUFFIX: true, base + "-notes.txt": true}
+	for _, output := range a.Report.Outputs {
+		listed[output.FileName] = true
+	}
+	for _, name := range out.Names() {
+		if !listed[name] {
+			t.Errorf("Expected %s of the earlier run to be removed", name)
+		}
+	}
+	if len(out.Names()) != len(listed) {
+		t.Errorf("Expected the files of the report and the other files, got %v", out.Names())
+	}
+}
+
+// TestAnalyzeTagsOverwritePolicies tests the fail and versioned overwrite policies.
+func TestAnalyzeTagsOverwritePolicies(t *testing.T) {
+	out := NewMemFS()
+	if err := newMemAnalyzer(t, getValidFullDepositXMLString(), out).AnalyzeTags(); err != nil {
+		t.Fatalf("AnalyzeTags failed with error: %v", err)
+	}
+	before := out.Names()
+
+	a := newMemAnalyzer(t, getValidFullDepositXMLString(), out)
+	a.Overwrite = OVERWRITE_FAIL
+	if err := a.AnalyzeTags(); !errors.Is(err, ErrOutputExists) {
+		t.Fatalf("Expected ErrOutputExists, got %v", err)
+	}
+	if after := out.Names(); strings.Join(after, ",") != strings.Join(before, ",") {
+		t.Errorf("Expected the output to be left alone, got %v", after)
+	}
+
+	for _, version := range []string{"v1", "v2"} {
+		a := newMemAnalyzer(t, getValidFullDepositXMLString(), out)
+		a.Overwrite = OVERWRITE_VERSIONED
+		if err := a.AnalyzeTags(); err != nil {
+			t.Fatalf("AnalyzeTags failed with error: %v", err)
+		}
+		expected := "deposits/test_2019-10-17_FULL_S1_R0/" + version + "/test_2019-10-17_FULL_S1_R0"
+		if a.GetBaseXMLFileName() != expected {
+			t.Errorf("Expected base name %s, got %s", expected, a.GetBaseXMLFileName())
+		}
+		if _, err := out.ReadFile(expected + DOMAIN_FILE_SUFFIX); err != nil {
+			t.Errorf("Expected the domain CSV in %s: %v", version, err)
+		}
+		if !strings.HasPrefix(a.Report.Outputs[0].FileName, expected) {
+			t.Errorf("Expected the report to list the versioned output, got %s", a.Report.Outputs[0].FileName)
+		}
+	}
+
+	a = newMemAnalyzer(t, getValidFullDepositXMLString(), out)
+	a.Overwrite = "append"
+	if err := a.AnalyzeTags(); !errors.Is(err, ErrUnsupportedOverwrite) {
+		t.Errorf("Expected ErrUnsupportedOverwrite, got %v", err)
+	}
+}
+
+// TestAnalyzeTagsFailureDiscardsOutput tests that a failed analysis leaves only the analysis report with its error, and keeps earlier output.
+func TestAnalyzeTagsFailureDiscardsOutput(t *testing.T) {
+	deposit := getValidFullDepositXMLString()
+	out := NewMemFS()
+	out.WriteFile("deposits/test_2019-10-17_FULL_S1_R0"+DOMAIN_FILE_SUFFIX, []byte("earlier,output\n"))
+	a := newMemAnalyzer(t, deposit[:strings.Index(deposit, "<rdeHost:host>")], out)
+	err := a.AnalyzeTags()
+	if err == nil {
+		t.Fatalf("Expected an error for a truncated deposit")
+	}
+	names := out.Names()
+	expected := []string{"deposits/test_2019-10-17_FULL_S1_R0" + ANALYSYS_FILE_SUFFIX, "deposits/test_2019-10-17_FULL_S1_R0" + DOMAIN_FILE_SUFFIX}
+	if strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected only the report and the earlier output, got %v", names)
+	}
+	if data, _ := out.ReadFile(expected[1]); string(data) != "earlier,output\n" {
+		t.Errorf("Expected the earlier output to be kept, got %s", data)
+	}
+	if a.Report == nil || a.Report.Error != err.Error() || len(a.Report.Outputs) != 0 {
+		t.Errorf("Expected a report with the error and no outputs, got %+v", a.Report)
+	}
+}
@@ -0,0 +1,209 @@
+package ryde
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+)
+
+// OutputSink receives the records produced while analyzing a deposit.
+// Begin is called before the first record and End after the last one. End is also called when the analysis fails, so the sink can release its resources.
+// Set XMLAnalyzer.Sinks to write the output somewhere else than the default CSV files, e.g. a database, a message queue or memory.
+type OutputSink interface {
+	Begin(a *XMLAnalyzer) error
+	WriteRecord(r Record) error
+	End(a *XMLAnalyzer) error
+}
+
+// ObjectSink is an OutputSink that also receives every decoded domain, host, contact, registrar, NNDN and IDN table reference as a whole,
+// with its statuses, postal info, DS records etc. still nested in it. The object type is domain, host, contact, registrar, nndn or idnTableRef.
+type ObjectSink interface {
+	OutputSink
+	WriteObject(objectType string, object any) error
+}
+
+// CSVSink writes every record type to its own CSV file, named after the XML file with the suffix in CSVFilesAndSuffixes.
+// The files are tracked in XMLAnalyzer.CSVFiles. This is the default sink.
+// The CSV files can be sharded: rotated when they reach MaxRows or MaxBytes, e.g. -domains.000.csv and -domains.001.csv,
+// and partitioned by registrar or by a hash of the object key. The shards are listed in a manifest with SHARD_MANIFEST_FILE_SUFFIX.
+type CSVSink struct {
+	Header      bool // Start every CSV file with a header row with the column names in RecordSchemas.
+	DataPackage bool // Write a Frictionless datapackage.json next to the CSV files that describes their columns, types and keys.
+	// Start a new shard when a shard has MaxRows records, or before it would grow beyond MaxBytes. 0 for no limit.
+	// A record that is bigger than MaxBytes on its own gets a shard of its own.
+	MaxRows  int
+	MaxBytes int64
+	// Partition the records by PARTITION_REGISTRAR or PARTITION_HASH, into PartitionCount hash partitions. Empty for no partitioning.
+	// Records are partitioned together with the object they belong to, e.g. the statuses of a domain with the domain.
+	Partition      string
+	PartitionCount int
+	// The number of shards that are kept open, defaults to CSV_SHARD_MAX_OPEN_FILES. The least recently used shard is closed when another one is needed.
+	MaxOpenFiles int
+
+	a             *XMLAnalyzer
+	current       map[string]*CSVShard // The shard that is written to, keyed by record type and partition.
+	lastPartition map[string]string    // The partition of the last record of every record type.
+	open          []*CSVShard          // The shards that are open.
+	uses          int                  // The number of writes to shards, to find the least recently used one.
+	row           bytes.Buffer         // The encoded record, so its size is known before it is written.
+	rowWriter     *csv.Writer          // Encodes the records into row.
+}
+
+// Begin creates the CSV files and their writers, and writes the header rows if enabled.
+func (s *CSVSink) Begin(a *XMLAnalyzer) error {
+	s.a = a
+	if s.sharded() {
+		return s.beginShards(a)
+	}
+	err := a.CreateCSVFiles()
+	if err != nil {
+		return err
+	}
+	err = a.CreateCSVWriters()
+	if err != nil {
+		// The analyzer only ends sinks that began, so close the files that were created
+		a.CloseCSVFiles()
+		return err
+	}
+	if !s.Header {
+		return nil
+	}
+	for recordType, csvFile := range a.CSVFiles {
+		schema, ok := RecordSchemas[recordType]
+		if !ok {
+			continue
+		}
+		err = csvFile.CsvWriter.Write(schema.FieldNames())
+		if err != nil {
+			a.CloseCSVFiles()
+			return err
+		}
+		csvFile.Header = true
+		a.CSVFiles[recordType] = csvFile
+	}
+	return nil
+}
+
+// WriteRecord writes the record to the CSV file of its type.
+func (s *CSVSink) WriteRecord(r Record) error {
+	if s.sharded() {
+		return s.writeShardedRecord(r)
+	}
+	csvFile, ok := s.a.CSVFiles[r.RecordType()]
+	if !ok || csvFile.CsvWriter == nil {
+		return fmt.Errorf("%w: %s", ErrUnknownRecordType, r.RecordType())
+	}
+	return csvFile.CsvWriter.Write(r.Values())
+}
+
+// End flushes and closes the CSV files, saves their final sizes and line counts, and writes the shard manifest and data package if enabled.
+func (s *CSVSink) End(a *XMLAnalyzer) error {
+	var err error
+	if s.sharded() {
+		err = s.endShards(a)
+	} else {
+		err = a.FlushCSVWriters()
+		if err == nil {
+			err = a.CloseCSVFiles()
+		}
+	}
+	if err != nil {
+		return err
+	}
+	err = a.CountLinesInCSVFilesAndSaveSize()
+	if err != nil {
+		return err
+	}
+	if s.DataPackage {
+		return a.WriteDataPackageFile(s.Header)
+	}
+	return nil
+}
+
+// Returns the output sinks of the analyzer, the CSV sink if none are set.
+func (a *XMLAnalyzer) outputSinks() []OutputSink {
+	if len(a.Sinks) == 0 {
+		return []OutputSink{&CSVSink{}}
+	}
+	return a.Sinks
+}
+
+// Writes the record to all output sinks.
+func (a *XMLAnalyzer) writeRecord(r Record) error {
+	for _, sink := range a.activeSinks {
+		if err := sink.WriteRecord(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Writes the object to all output sinks that accept whole objects.
+func (a *XMLAnalyzer) writeObject(objectType string, object any) error {
+	for _, sink := range a.activeSinks {
+		if objectSink, ok := sink.(ObjectSink); ok {
+			if err := objectSink.WriteObject(objectType, object); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Calls Begin on all output sinks. If a sink fails to begin, the sinks that did begin are ended.
+func (a *XMLAnalyzer) beginSinks() error {
+	a.activeSinks = nil
+	for _, sink := range a.outputSinks() {
+		if err := sink.Begin(a); err != nil {
+			a.endSinks()
+			return err
+		}
+		a.activeSinks = append(a.activeSinks, sink)
+	}
+	return nil
+}
+
+// Calls End on all output sinks that began and returns the first error.
+func (a *XMLAnalyzer) endSinks() error {
+	var firstErr error
+	for _, sink := range a.activeSinks {
+		if err := sink.End(a); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	a.activeSinks = nil
+	return firstErr
+}
+
+// MemorySink keeps all records in memory, e.g. for tests or small deposits.
+type MemorySink struct {
+	Records []Record
+}
+
+// Begin clears the records of a previous analysis.
+func (s *MemorySink) Begin(a *XMLAnalyzer) error {
+	s.Records = nil
+	return nil
+}
+
+// WriteRecord appends the record to Records.
+func (s *MemorySink) WriteRecord(r Record) error {
+	s.Records = append(s.Records, r)
+	return nil
+}
+
+// End does nothing, the records stay available in Records.
+func (s *MemorySink) End(a *XMLAnalyzer) error {
+	return nil
+}
+
+// RecordsOfType returns the records of the given type, in the order they were written.
+func (s *MemorySink) RecordsOfType(recordType string) []Record {
+	var records []Record
+	for _, r := range s.Records {
+		if r.RecordType() == recordType {
+			records = append(records, r)
+		}
+	}
+	return records
+}
@@ -0,0 +1,275 @@
+package ryde
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// A sink that fails to begin, to test that the sinks that did begin are ended.
+type failingSink struct {
+	MemorySink
+}
+
+func (s *failingSink) Begin(a *XMLAnalyzer) error {
+	return errors.New("failed to begin")
+}
+
+// A sink that records whether it was ended.
+type endRecordingSink struct {
+	MemorySink
+	ended int
+}
+
+func (s *endRecordingSink) End(a *XMLAnalyzer) error {
+	s.ended++
+	return nil
+}
+
+// TestAnalyzeTagsSinks tests that all records are written to every sink, alongside the CSV files.
+func TestAnalyzeTagsSinks(t *testing.T) {
+	xmlString := strings.Replace(getValidFullDepositXMLString(), "</rdeDomain:domain>", `<rdeDomain:trnData>
+			<domain:trStatus>pending</domain:trStatus>
+			<domain:reRr>RegistrarX</domain:reRr>
+			<domain:reDate>2000-06-08T22:00:00.0Z</domain:reDate>
+			<domain:acRr>RegistrarY</domain:acRr>
+			<domain:acDate>2000-06-13T22:00:00.0Z</domain:acDate>
+			<domain:exDate>2002-09-08T22:00:00.0Z</domain:exDate>
+		</rdeDomain:trnData>
+		</rdeDomain:domain>`, 1)
+	fsys := fstest.MapFS{"test_2019-10-17_FULL_S1_R0.xml": &fstest.MapFile{Data: []byte(xmlString)}}
+	a, err := NewXMLAnalyzerFS(fsys, "test_2019-10-17_FULL_S1_R0.xml")
+	if err != nil {
+		t.Fatalf("NewXMLAnalyzerFS returned an error: %v", err)
+	}
+	out := NewMemFS()
+	a.OutputFS = out
+	memory := &MemorySink{}
+	a.Sinks = []OutputSink{&CSVSink{}, memory}
+	if err := a.AnalyzeTags(); err != nil {
+		t.Fatalf("AnalyzeTags failed with error: %v", err)
+	}
+
+	for recordType := range CSVFilesAndSuffixes {
+		counter := recordType
+		switch recordType {
+		case "idnLanguage":
+			// IDN table references are counted by the name of their element
+			counter = "idnTableRef"
+		case "uniqueContactID":
+			counter = "uniqueContactIDs"
+		}
+		if got := len(memory.RecordsOfType(recordType)); got != a.Counters[counter] {
+			t.Errorf("Expected %d %s records, got %d", a.Counters[counter], recordType, got)
+		}
+	}
+	if a.Counters["hostStatus"] != 2 || a.Counters["uniqueContactIDs"] != 1 {
+		t.Errorf("Unexpected counters %v", a.Counters)
+	}
+
+	addresses := memory.RecordsOfType("hostAddress")
+	if len(addresses) != 3 || !reflect.DeepEqual(addresses[2], HostAddressRecord{"ns1.example1.example", "2001:DB8:1::1", "v6"}) {
+		t.Errorf("Unexpected host addresses %v", addresses)
+	}
+	transfers := memory.RecordsOfType("domainTransfers")
+	if len(transfers) != 1 || !reflect.DeepEqual(transfers[0].Values(), []string{"example1.example", "pending", "RegistrarX", "2000-06-08T22:00:00.0Z", "RegistrarY", "2000-06-13T22:00:00.0Z", "2002-09-08T22:00:00.0Z"}) {
+		t.Errorf("Unexpected transfers %v", transfers)
+	}
+
+	// The CSV sink wrote the same records
+	data, err := out.ReadFile(a.CSVFiles["domainTransfers"].FileName)
+	if err != nil {
+		t.Fatalf("Failed to read transfers: %v", err)
+	}
+	if string(data) != strings.Join(transfers[0].Values(), ",")+"\n" {
+		t.Errorf("Unexpected transfers CSV %q", data)
+	}
+}
+
+// TestAnalyzeTagsGoldenCSV tests the contents of every CSV file written for a deposit with a transfer and a contact with 4 street lines,
+// with the columns described in the changes to the output in the README.
+func TestAnalyzeTagsGoldenCSV(t *testing.T) {
+	xmlString := strings.Replace(getValidFullDepositXMLString(), "</rdeDomain:domain>", `<rdeDomain:trnData>
+			<domain:trStatus>pending</domain:trStatus>
+			<domain:reRr>RegistrarX</domain:reRr>
+			<domain:reDate>2000-06-08T22:00:00.0Z</domain:reDate>
+			<domain:acRr>RegistrarY</domain:acRr>
+			<domain:acDate>2000-06-13T22:00:00.0Z</domain:acDate>
+			<domain:exDate>2002-09-08T22:00:00.0Z</domain:exDate>
+		</rdeDomain:trnData>
+		</rdeDomain:domain>`, 1)
+	xmlString = strings.Replace(xmlString, "<contact:street>Suite 100</contact:street>", `<contact:street>Suite 100</contact:street>
+			  <contact:street>Building 2</contact:street>
+			  <contact:street>Floor 3</contact:street>`, 1)
+	fsys := fstest.MapFS{"test_2019-10-17_FULL_S1_R0.xml": &fstest.MapFile{Data: []byte(xmlString)}}
+	a, err := NewXMLAnalyzerFS(fsys, "test_2019-10-17_FULL_S1_R0.xml")
+	if err != nil {
+		t.Fatalf("NewXMLAnalyzerFS returned an error: %v", err)
+	}
+	out := NewMemFS()
+	a.OutputFS = out
+	a.Sinks = []OutputSink{&CSVSink{}}
+	if err := a.AnalyzeTags(); err != nil {
+		t.Fatalf("AnalyzeTags failed with error: %v", err)
+	}
+
+	golden := map[string]string{
+		"contactPostalInfo":   "sh8013,int,John Doe,Example Inc.,123 Example Dr.,Suite 100,Building 2,Dulles,VA,20166-6503,US\n",
+		"contactStatus":       "sh8013,linked\nsh8013,clientDeleteProhibited\n",
+		"contact":             "sh8013,Csh8013-TEST,+1.7035555555,+1.7035555556,jdoe@example.example,RegistrarX,RegistrarX,2009-09-13T08:01:00.0Z,RegistrarX,2009-11-26T09:10:00.0Z\n",
+		"domainDnssec":        "",
+		"domainNameservers":   "example1.example,ns1.example.com\nexample1.example,ns1.example1.example\n",
+		"domainStatus":        "example1.example,ok\nexample2.example,ok\nexample2.example,clientUpdateProhibited\n",
+		"domainTransfers":     "example1.example,pending,RegistrarX,2000-06-08T22:00:00.0Z,RegistrarY,2000-06-13T22:00:00.0Z,2002-09-08T22:00:00.0Z\n",
+		"domain":              "example1.example,Dexample1-TEST,,,,jd1234,RegistrarX,RegistrarX,1999-04-03T22:00:00.0Z,2025-04-03T22:00:00.0Z,,\nexample2.example,Dexample2-TEST,,,,jd1234,RegistrarX,RegistrarX,1999-04-03T22:00:00.0Z,2025-04-03T22:00:00.0Z,,\n",
+		"hostAddress":         "ns1.example1.example,192.0.2.2,v4\nns1.example1.example,192.0.2.29,v4\nns1.example1.example,2001:DB8:1::1,v6\n",
+		"hostStatus":          "ns1.example1.example,ok\nns1.example1.example,linked\n",
+		"host":                "ns1.example1.example,Hns1_example_test-TEST,RegistrarX,RegistrarX,1999-05-08T12:10:00.0Z,RegistrarX,2009-10-03T09:34:00.0Z\n",
+		"idnLanguage":         "pt-BR,http://www.iana.org/domains/idn-tables/tables/br_pt-br_1.0.html,http://registro.br/dominio/regras.html\n",
+		"nndn":                "xn--exampl-gva.example,,pt-BR,example1.example,withheld,2005-04-23T11:49:00.0Z\n",
+		"orphanContact":       "",
+		"orphanHost":          "",
+		"registrarPostalInfo": "RegistrarX,int,123 Example Dr.,Suite 100,,Dulles,VA,20166-6503,US\n",
+		"registrar":           "RegistrarX,Registrar X,8,ok,http://whois.example.example,http://www.example.example,2005-04-23T11:49:00.0Z,2009-02-17T17:51:00.0Z,+1.7035555555,+1.7035555556,jdoe@example.example\n",
+		"uniqueContactID":     "sh8013\n",
+	}
+	for recordType := range CSVFilesAndSuffixes {
+		expected, ok := golden[recordType]
+		if !ok {
+			t.Errorf("No golden output for %s", recordType)
+			continue
+		}
+		data, err := out.ReadFile(a.CSVFiles[recordType].FileName)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", recordType, err)
+		}
+		if string(data) != expected {
+			t.Errorf("Expected %s to be %q, got %q", recordType, expected, data)
+		}
+	}
+}
+
+// An output filesystem that fails to open the files with a suffix and keeps track of the number of open files.
+type openFilesFS struct {
+	*MemFS
+	failSuffix string
+	open       int
+}
+
+func (f *openFilesFS) OpenFile(name string, flag int, perm fs.FileMode) (WritableFile, error) {
+	if strings.HasSuffix(name, f.failSuffix) {
+		return nil, errors.New("failed to open " + name)
+	}
+	file, err := f.MemFS.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	f.open++
+	return &openFile{WritableFile: file, fs: f}, nil
+}
+
+type openFile struct {
+	WritableFile
+	fs     *openFilesFS
+	closed bool
+}
+
+func (f *openFile) Close() error {
+	if !f.closed {
+		f.closed = true
+		f.fs.open--
+	}
+	return f.WritableFile.Close()
+}
+
+// TestAnalyzeTagsSinkBeginFailsPartway tests that a sink that fails to create one of its files closes the files it did create.
+func TestAnalyzeTagsSinkBeginFailsPartway(t *testing.T) {
+	tests := []struct {
+		sink       OutputSink
+		failSuffix string
+	}{
+		{&ParquetSink{}, "-orphanHosts" + PARQUET_FILE_EXTENSION},
+		{&CSVSink{}, HOST_ADDRESS_FILE_SUFFIX},
+		{&CSVSink{Header: true}, CONTACT_FILE_SUFFIX},
+	}
+	for _, test := range tests {
+		fsys := fstest.MapFS{"test_2019-10-17_FULL_S1_R0.xml": &fstest.MapFile{Data: []byte(getValidFullDepositXMLString())}}
+		a, err := NewXMLAnalyzerFS(fsys, "test_2019-10-17_FULL_S1_R0.xml")
+		if err != nil {
+			t.Fatalf("NewXMLAnalyzerFS returned an error: %v", err)
+		}
+		out := &openFilesFS{MemFS: NewMemFS(), failSuffix: test.failSuffix}
+		a.OutputFS = out
+		a.Sinks = []OutputSink{test.sink}
+		if err := a.AnalyzeTags(); err == nil || !strings.Contains(err.Error(), test.failSuffix) {
+			t.Fatalf("Expected the error opening %s, got %v", test.failSuffix, err)
+		}
+		if out.open != 0 {
+			t.Errorf("Expected no open files after failing to open %s, got %d", test.failSuffix, out.open)
+		}
+	}
+}
+
+// TestAnalyzeTagsSinkBeginFails tests that the sinks that began are ended when another sink fails to begin.
+func TestAnalyzeTagsSinkBeginFails(t *testing.T) {
+	fsys := fstest.MapFS{"test_2019-10-17_FULL_S1_R0.xml": &fstest.MapFile{Data: []byte(getValidFullDepositXMLString())}}
+	a, err := NewXMLAnalyzerFS(fsys, "test_2019-10-17_FULL_S1_R0.xml")
+	if err != nil {
+		t.Fatalf("NewXMLAnalyzerFS returned an error: %v", err)
+	}
+	a.OutputFS = NewMemFS()
+	first := &endRecordingSink{}
+	a.Sinks = []OutputSink{first, &failingSink{}}
+	if err := a.AnalyzeTags(); err == nil || err.Error() != "failed to begin" {
+		t.Fatalf("Expected the error of the failing sink, got %v", err)
+	}
+	if first.ended != 1 {
+		t.Errorf("Expected the first sink to be ended once, got %d", first.ended)
+	}
+}
+
+// TestAnalyzeTagsReproducibleOutput tests that analyzing the same deposit twice with every sink gives byte-identical output,
+// with the unique contact IDs sorted.
+func TestAnalyzeTagsReproducibleOutput(t *testing.T) {
+	xmlString := strings.Replace(getValidFullDepositXMLString(), `<rdeDomain:contact type="tech">sh8013</rdeDomain:contact>`, `<rdeDomain:contact type="tech">sh8013</rdeDomain:contact>
+		  <rdeDomain:contact type="billing">zz99</rdeDomain:contact>
+		  <rdeDomain:contact type="billing">ab12</rdeDomain:contact>
+		  <rdeDomain:contact type="billing">mm55</rdeDomain:contact>
+		  <rdeDomain:contact type="billing">cd34</rdeDomain:contact>`, 1)
+	var outs []*MemFS
+	for i := 0; i < 3; i++ {
+		fsys := fstest.MapFS{"test_2019-10-17_FULL_S1_R0.xml": &fstest.MapFile{Data: []byte(xmlString)}}
+		a, err := NewXMLAnalyzerFS(fsys, "test_2019-10-17_FULL_S1_R0.xml")
+		if err != nil {
+			t.Fatalf("NewXMLAnalyzerFS returned an error: %v", err)
+		}
+		out := NewMemFS()
+		a.OutputFS = out
+		a.Reproducible = true
+		a.Sinks = []OutputSink{&CSVSink{Header: true, DataPackage: true}, &JSONLinesSink{}, &ParquetSink{}, &SQLSink{Dialect: SQL_DIALECT_SQLITE}}
+		if err := a.AnalyzeTags(); err != nil {
+			t.Fatalf("AnalyzeTags failed with error: %v", err)
+		}
+		if !a.Report.StartedAt.Equal(time.Date(2019, 10, 17, 0, 0, 0, 0, time.UTC)) || a.Report.Durations.TotalMs != 0 {
+			t.Errorf("Expected the watermark as the time and no durations, got %v %v", a.Report.StartedAt, a.Report.Durations)
+		}
+		outs = append(outs, out)
+	}
+	for _, name := range outs[0].Names() {
+		expected, _ := outs[0].ReadFile(name)
+		for _, out := range outs[1:] {
+			if got, _ := out.ReadFile(name); !bytes.Equal(got, expected) {
+				t.Errorf("Expected %s to be the same in every run", name)
+			}
+		}
+	}
+	contactIDs, _ := outs[0].ReadFile("test_2019-10-17_FULL_S1_R0" + UNIQUE_CONTACT_ID_FILE_SUFFIX)
+	if string(contactIDs) != "id\nab12\ncd34\nmm55\nsh8013\nzz99\n" {
+		t.Errorf("Expected the unique contact IDs sorted, got %q", contactIDs)
+	}
+}
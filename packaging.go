@@ -0,0 +1,172 @@
+package ryde
+
+import (
+	"archive/tar"
+	"crypto"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// RyDEPackager packages deposit XML into a RyDE file as described in RFC 8909 section 4 (https://www.rfc-editor.org/rfc/rfc8909#section-4).
+// The XML is put in a tar archive, compressed with the OpenPGP ZIP algorithm and encrypted to the recipients.
+// The RyDE file is signed with a detached signature by the signer. Everything happens in a single streaming pass.
+type RyDEPackager struct {
+	Recipients openpgp.EntityList // The public keys of the escrow agent to encrypt the deposit to.
+	Signer     *openpgp.Entity    // The key to sign the deposit with, its private key must be decrypted.
+	ModTime    time.Time          // The modification time of the tar entry. Defaults to the current time.
+}
+
+// The OpenPGP configuration for RyDE files: ZIP compression as required by RFC 8909 and SHA-256 signatures.
+var rydeOpenPGPConfig = &packet.Config{
+	DefaultCompressionAlgo: packet.CompressionZIP,
+	DefaultHash:            crypto.SHA256,
+}
+
+// Package writes the RyDE file for the deposit XML read from r to ryde and its detached signature to sig.
+// name is the name of the XML file in the tar archive and size its size in bytes, which must be known up front.
+func (p *RyDEPackager) Package(name string, size int64, r io.Reader, ryde, sig io.Writer) error {
+	if len(p.Recipients) == 0 {
+		return ErrNoRecipients
+	}
+	if p.Signer == nil || p.Signer.PrivateKey == nil || p.Signer.PrivateKey.Encrypted {
+		return ErrNoSigner
+	}
+	if size < 0 {
+		return ErrUnknownDepositSize
+	}
+	modTime := p.ModTime
+	if modTime.IsZero() {
+		modTime = time.Now()
+	}
+
+	// Sign the RyDE file as it is written, the signer reads from a pipe in its own goroutine
+	pr, pw := io.Pipe()
+	signed := make(chan error, 1)
+	go func() {
+		err := openpgp.DetachSign(sig, p.Signer, pr, rydeOpenPGPConfig)
+		pr.CloseWithError(err)
+		signed <- err
+	}()
+
+	err := p.encrypt(name, size, modTime, r, io.MultiWriter(ryde, pw))
+	if err != nil {
+		pw.CloseWithError(err)
+		<-signed
+		return err
+	}
+	pw.Close()
+	return <-signed
+}
+
+// Writes the tar archive with the deposit XML, compressed and encrypted, to w.
+func (p *RyDEPackager) encrypt(name string, size int64, modTime time.Time, r io.Reader, w io.Writer) error {
+	plaintext, err := openpgp.Encrypt(w, p.Recipients, nil, &openpgp.FileHints{
+		IsBinary: true,
+		FileName: trimXMLExtension(name) + ".tar",
+		ModTime:  modTime,
+	}, rydeOpenPGPConfig)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(plaintext)
+	err = tw.WriteHeader(&tar.Header{
+		Name:     name,
+		Mode:     0644,
+		Size:     size,
+		ModTime:  modTime,
+		Typeflag: tar.TypeReg,
+		Format:   tar.FormatUSTAR,
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(tw, r); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return plaintext.Close()
+}
+
+// PackageFile packages the deposit XML file into {outBase}.ryde and its signature into {outBase}.sig and returns their names.
+// If outBase is empty the name of the XML file without its extension is used.
+// Both files are written to temporary files next to them that are renamed into place when packaging succeeds, so a failed run leaves no partial RyDE file.
+func (p *RyDEPackager) PackageFile(filename, outBase string) (string, string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", "", err
+	}
+	if outBase == "" {
+		outBase = trimXMLExtension(filename)
+	}
+	rydeFileName := outBase + RYDE_FILE_SUFFIX
+	sigFileName := outBase + SIGNATURE_FILE_SUFFIX
+
+	rydeFile, err := createPackageTemp(rydeFileName)
+	if err != nil {
+		return "", "", err
+	}
+	// Once the temporary files are renamed these do nothing
+	defer os.Remove(rydeFile.Name())
+	defer rydeFile.Close()
+	sigFile, err := createPackageTemp(sigFileName)
+	if err != nil {
+		return "", "", err
+	}
+	defer os.Remove(sigFile.Name())
+	defer sigFile.Close()
+
+	err = p.Package(filepath.Base(filename), info.Size(), f, rydeFile, sigFile)
+	if err != nil {
+		return "", "", err
+	}
+	if err := rydeFile.Close(); err != nil {
+		return "", "", err
+	}
+	if err := sigFile.Close(); err != nil {
+		return "", "", err
+	}
+	// The signature goes first, a signature without a RyDE file cannot be mistaken for a deposit
+	if err := os.Rename(sigFile.Name(), sigFileName); err != nil {
+		return "", "", err
+	}
+	if err := os.Rename(rydeFile.Name(), rydeFileName); err != nil {
+		os.Remove(sigFileName)
+		return "", "", err
+	}
+	return rydeFileName, sigFileName, nil
+}
+
+// Creates a hidden temporary file in the directory of name to write the file with that name to.
+// It gets the permissions of a file created by os.Create with the usual umask, rather than the owner-only permissions of temporary files.
+func createPackageTemp(name string) (*os.File, error) {
+	f, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return f, nil
+}
+
+// Returns name without the .xml extension, if it has one.
+func trimXMLExtension(name string) string {
+	if filepath.Ext(name) == ".xml" {
+		return name[:len(name)-len(".xml")]
+	}
+	return name
+}
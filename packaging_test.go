@@ -0,0 +1,98 @@
+package ryde
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+)
+
+// TestPackageFile tests that a packaged deposit can be decrypted, verified and analyzed.
+func TestPackageFile(t *testing.T) {
+	agent := createTestEntity(t)
+	registry := createTestEntity(t)
+
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "test_2019-10-17_FULL_S1_R0.xml")
+	os.WriteFile(filename, []byte(getValidFullDepositXMLString()), 0666)
+
+	p := RyDEPackager{Recipients: openpgp.EntityList{agent}, Signer: registry}
+	rydeFile, sigFile, err := p.PackageFile(filename, "")
+	if err != nil {
+		t.Fatalf("PackageFile returned an error: %v", err)
+	}
+	if rydeFile != filepath.Join(dir, "test_2019-10-17_FULL_S1_R0.ryde") || sigFile != filepath.Join(dir, "test_2019-10-17_FULL_S1_R0.sig") {
+		t.Fatalf("Unexpected file names %s and %s", rydeFile, sigFile)
+	}
+
+	a, err := NewXMLAnalyzer(rydeFile)
+	if err != nil {
+		t.Fatalf("NewXMLAnalyzer returned an error: %v", err)
+	}
+	a.Keyring = openpgp.EntityList{agent}
+	a.SignatureFile = sigFile
+	a.VerificationKeyring = openpgp.EntityList{registry}
+	if err := a.AnalyzeTags(); err != nil {
+		t.Fatalf("AnalyzeTags failed with error: %v", err)
+	}
+	if !a.XMLFile.Encrypted || !a.Signature.Valid || a.Counters["domain"] != 2 {
+		t.Errorf("Unexpected analysis result %+v %+v %v", a.XMLFile, a.Signature, a.Counters)
+	}
+	if len(a.XMLFile.TarEntries) != 1 || a.XMLFile.TarEntries[0].Name != "test_2019-10-17_FULL_S1_R0.xml" {
+		t.Errorf("Unexpected tar entries %v", a.XMLFile.TarEntries)
+	}
+}
+
+// TestPackageFileErrors tests that packaging that fails leaves no RyDE or signature file behind.
+func TestPackageFileErrors(t *testing.T) {
+	e := createTestEntity(t)
+	tests := []struct {
+		name     string
+		packager RyDEPackager
+		xml      bool // Whether the deposit is an XML file, otherwise it is a directory that fails while it is read.
+	}{
+		{"no signer", RyDEPackager{Recipients: openpgp.EntityList{e}}, true},
+		{"read error", RyDEPackager{Recipients: openpgp.EntityList{e}, Signer: e}, false},
+	}
+	for _, test := range tests {
+		dir := t.TempDir()
+		filename := filepath.Join(dir, "test_2019-10-17_FULL_S1_R0.xml")
+		if test.xml {
+			os.WriteFile(filename, []byte(getValidFullDepositXMLString()), 0666)
+		} else {
+			os.Mkdir(filename, 0777)
+		}
+		if _, _, err := test.packager.PackageFile(filename, ""); err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+		entries, _ := os.ReadDir(dir)
+		if len(entries) != 1 || entries[0].Name() != filepath.Base(filename) {
+			t.Errorf("%s: expected only the deposit to be left, got %v", test.name, entries)
+		}
+	}
+}
+
+// TestPackageErrors tests that packaging fails without recipients, signer or size.
+func TestPackageErrors(t *testing.T) {
+	e := createTestEntity(t)
+	tests := []struct {
+		name     string
+		packager RyDEPackager
+		size     int64
+		expected error
+	}{
+		{"no recipients", RyDEPackager{Signer: e}, 1, ErrNoRecipients},
+		{"no signer", RyDEPackager{Recipients: openpgp.EntityList{e}}, 1, ErrNoSigner},
+		{"unknown size", RyDEPackager{Recipients: openpgp.EntityList{e}, Signer: e}, -1, ErrUnknownDepositSize},
+	}
+	for _, test := range tests {
+		var ryde, sig bytes.Buffer
+		err := test.packager.Package("test.xml", test.size, bytes.NewReader([]byte("x")), &ryde, &sig)
+		if !errors.Is(err, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, err)
+		}
+	}
+}
@@ -0,0 +1,448 @@
+package ryde
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress/zstd"
+)
+
+const (
+	PARQUET_FILE_EXTENSION = ".parquet"
+	PARQUET_ROW_GROUP_ROWS = 256 * 1024 // Large enough for efficient scans of big deposits, small enough to keep a row group of domains in memory
+)
+
+// ParquetDomain is a row of the domains Parquet file. Statuses, nameservers, contacts and DS records are repeated fields.
+type ParquetDomain struct {
+	Name         string                 `parquet:"name"`
+	RoID         string                 `parquet:"roid"`
+	UName        string                 `parquet:"uName,optional"`
+	IdnTableID   string                 `parquet:"idnTableId,optional,dict"`
+	OriginalName string                 `parquet:"originalName,optional"`
+	Status       []string               `parquet:"status,list,dict"`
+	Registrant   string                 `parquet:"registrant,optional"`
+	Contact      []ParquetDomainContact `parquet:"contact,list"`
+	Nameserver   []string               `parquet:"nameserver,list"`
+	ClID         string                 `parquet:"clID,dict"`
+	CrRr         string                 `parquet:"crRr,optional,dict"`
+	CrDate       *time.Time             `parquet:"crDate,optional,timestamp(microsecond)"`
+	ExDate       *time.Time             `parquet:"exDate,optional,timestamp(microsecond)"`
+	UpRr         string                 `parquet:"upRr,optional,dict"`
+	UpDate       *time.Time             `parquet:"upDate,optional,timestamp(microsecond)"`
+	DSData       []ParquetDSData        `parquet:"dsData,list"`
+	Transfer     *ParquetTransfer       `parquet:"transfer,optional"`
+}
+
+// ParquetDomainContact is a contact of a domain and its type: admin, tech or billing.
+type ParquetDomainContact struct {
+	Type string `parquet:"type,dict"`
+	ID   string `parquet:"id"`
+}
+
+// ParquetDSData is a DS record of a domain.
+type ParquetDSData struct {
+	KeyTag     int32  `parquet:"keyTag"`
+	Alg        int32  `parquet:"alg"`
+	DigestType int32  `parquet:"digestType"`
+	Digest     string `parquet:"digest"`
+}
+
+// ParquetTransfer is the pending or last transfer of a domain.
+type ParquetTransfer struct {
+	TrStatus string     `parquet:"trStatus,dict"`
+	ReRr     string     `parquet:"reRr"`
+	ReDate   *time.Time `parquet:"reDate,optional,timestamp(microsecond)"`
+	AcRr     string     `parquet:"acRr"`
+	AcDate   *time.Time `parquet:"acDate,optional,timestamp(microsecond)"`
+	ExDate   *time.Time `parquet:"exDate,optional,timestamp(microsecond)"`
+}
+
+// ParquetHost is a row of the hosts Parquet file.
+type ParquetHost struct {
+	Name    string               `parquet:"name"`
+	RoID    string               `parquet:"roid"`
+	Status  []string             `parquet:"status,list,dict"`
+	Address []ParquetHostAddress `parquet:"address,list"`
+	ClID    string               `parquet:"clID,dict"`
+	CrRr    string               `parquet:"crRr,optional,dict"`
+	CrDate  *time.Time           `parquet:"crDate,optional,timestamp(microsecond)"`
+	UpRr    string               `parquet:"upRr,optional,dict"`
+	UpDate  *time.Time           `parquet:"upDate,optional,timestamp(microsecond)"`
+}
+
+// ParquetHostAddress is an IP address of a host and its version, v4 or v6.
+type ParquetHostAddress struct {
+	Address string `parquet:"address"`
+	Version string `parquet:"version,dict"`
+}
+
+// ParquetContact is a row of the contacts Parquet file.
+type ParquetContact struct {
+	ID         string              `parquet:"id"`
+	RoID       string              `parquet:"roid"`
+	Status     []string            `parquet:"status,list,dict"`
+	PostalInfo []ParquetPostalInfo `parquet:"postalInfo,list"`
+	Voice      string              `parquet:"voice,optional"`
+	Fax        string              `parquet:"fax,optional"`
+	Email      string              `parquet:"email,optional"`
+	ClID       string              `parquet:"clID,dict"`
+	CrRr       string              `parquet:"crRr,optional,dict"`
+	CrDate     *time.Time          `parquet:"crDate,optional,timestamp(microsecond)"`
+	UpRr       string              `parquet:"upRr,optional,dict"`
+	UpDate     *time.Time          `parquet:"upDate,optional,timestamp(microsecond)"`
+}
+
+// ParquetPostalInfo is a postal info (int or loc) of a contact or registrar. Registrars have no name or org.
+type ParquetPostalInfo struct {
+	Type   string   `parquet:"type,dict"`
+	Name   string   `parquet:"name,optional"`
+	Org    string   `parquet:"org,optional"`
+	Street []string `parquet:"street,list"`
+	City   string   `parquet:"city,optional"`
+	SP     string   `parquet:"sp,optional"`
+	PC     string   `parquet:"pc,optional"`
+	CC     string   `parquet:"cc,optional,dict"`
+}
+
+// ParquetRegistrar is a row of the registrars Parquet file.
+type ParquetRegistrar struct {
+	ID         string              `parquet:"id"`
+	Name       string              `parquet:"name"`
+	GurID      int64               `parquet:"gurid,optional"`
+	Status     string              `parquet:"status,optional"`
+	PostalInfo []ParquetPostalInfo `parquet:"postalInfo,list"`
+	Voice      string              `parquet:"voice,optional"`
+	Fax        string              `parquet:"fax,optional"`
+	Email      string              `parquet:"email,optional"`
+	URL        string              `parquet:"url,optional"`
+	WhoisURL   string              `parquet:"whoisUrl,optional"`
+	CrDate     *time.Time          `parquet:"crDate,optional,timestamp(microsecond)"`
+	UpDate     *time.Time          `parquet:"upDate,optional,timestamp(microsecond)"`
+}
+
+// ParquetIDNTableRef is a row of the IDN table references Parquet file.
+type ParquetIDNTableRef struct {
+	ID        string `parquet:"id"`
+	URL       string `parquet:"url,optional"`
+	URLPolicy string `parquet:"urlPolicy,optional"`
+}
+
+// ParquetNNDN is a row of the NNDNs Parquet file.
+type ParquetNNDN struct {
+	AName        string     `parquet:"aName"`
+	UName        string     `parquet:"uName,optional"`
+	IDNTableID   string     `parquet:"idnTableId,optional,dict"`
+	OriginalName string     `parquet:"originalName,optional"`
+	NameState    string     `parquet:"nameState,dict"`
+	CrDate       *time.Time `parquet:"crDate,optional,timestamp(microsecond)"`
+}
+
+// ParquetContactID is a row of the unique and orphaned contact IDs Parquet files.
+type ParquetContactID struct {
+	ID string `parquet:"id"`
+}
+
+// ParquetHostName is a row of the orphaned hosts Parquet file.
+type ParquetHostName struct {
+	Name string `parquet:"name"`
+}
+
+// A Parquet file that is written row by row.
+type parquetFile[T any] struct {
+	file   WritableFile
+	writer *parquet.GenericWriter[T]
+}
+
+// Creates the Parquet file for the record type, named after the XML file with the suffix of the CSV file of the record type and PARQUET_FILE_EXTENSION.
+func createParquetFile[T any](a *XMLAnalyzer, recordType string, options ...parquet.WriterOption) (*parquetFile[T], error) {
+	name := a.GetBaseXMLFileName() + strings.TrimSuffix(CSVFilesAndSuffixes[recordType], ".csv") + PARQUET_FILE_EXTENSION
+	file, err := a.outputFS().OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return nil, err
+	}
+	return &parquetFile[T]{file, parquet.NewGenericWriter[T](file, options...)}, nil
+}
+
+// Writes a row, the writer starts a new row group when the current one is full.
+func (f *parquetFile[T]) write(row T) error {
+	_, err := f.writer.Write([]T{row})
+	return err
+}
+
+// Adds the deposit to the key/value metadata, writes the footer and closes the file.
+func (f *parquetFile[T]) close(d XMLDepositUnMarshall) error {
+	f.writer.SetKeyValueMetadata("ryde.depositId", d.ID)
+	f.writer.SetKeyValueMetadata("ryde.depositType", d.Type)
+	f.writer.SetKeyValueMetadata("ryde.watermark", d.Watermark)
+	err := f.writer.Close()
+	if closeErr := f.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// ParquetSink writes the domains, hosts, contacts, registrars, NNDNs and IDN table references to typed, zstd compressed Parquet files, one per object type,
+// named after the XML file like the CSV files, e.g. -domains.parquet. Statuses, postal info, DS records etc. are repeated fields of their object,
+// dates are timestamps and key tags and algorithms integers. The unique contact IDs and the orphaned contacts and hosts get a file of their own.
+// The Parquet files are written in the same pass as the analysis, a row group is kept in memory until it holds RowGroupRows rows.
+type ParquetSink struct {
+	RowGroupRows int64 // The maximum number of rows in a row group, PARQUET_ROW_GROUP_ROWS if 0.
+
+	domains          *parquetFile[ParquetDomain]
+	hosts            *parquetFile[ParquetHost]
+	contacts         *parquetFile[ParquetContact]
+	registrars       *parquetFile[ParquetRegistrar]
+	idnTableRefs     *parquetFile[ParquetIDNTableRef]
+	nndns            *parquetFile[ParquetNNDN]
+	uniqueContactIDs *parquetFile[ParquetContactID]
+	orphanContacts   *parquetFile[ParquetContactID]
+	orphanHosts      *parquetFile[ParquetHostName]
+}
+
+// Begin creates the Parquet files. If one of them cannot be created, the files created before it are closed.
+func (s *ParquetSink) Begin(a *XMLAnalyzer) error {
+	rowGroupRows := s.RowGroupRows
+	if rowGroupRows <= 0 {
+		rowGroupRows = PARQUET_ROW_GROUP_ROWS
+	}
+	options := []parquet.WriterOption{
+		parquet.MaxRowsPerRowGroup(rowGroupRows),
+		parquet.Compression(&zstd.Codec{Level: zstd.DefaultLevel}),
+		parquet.CreatedBy("ryde", "", ""),
+	}
+	err := s.createFiles(a, options...)
+	if err != nil {
+		// The analyzer only ends sinks that began
+		s.End(a)
+		return err
+	}
+	return nil
+}
+
+// Creates the Parquet files, up to the first one that fails.
+func (s *ParquetSink) createFiles(a *XMLAnalyzer, options ...parquet.WriterOption) error {
+	var err error
+	if s.domains, err = createParquetFile[ParquetDomain](a, "domain", options...); err != nil {
+		return err
+	}
+	if s.hosts, err = createParquetFile[ParquetHost](a, "host", options...); err != nil {
+		return err
+	}
+	if s.contacts, err = createParquetFile[ParquetContact](a, "contact", options...); err != nil {
+		return err
+	}
+	if s.registrars, err = createParquetFile[ParquetRegistrar](a, "registrar", options...); err != nil {
+		return err
+	}
+	if s.idnTableRefs, err = createParquetFile[ParquetIDNTableRef](a, "idnLanguage", options...); err != nil {
+		return err
+	}
+	if s.nndns, err = createParquetFile[ParquetNNDN](a, "nndn", options...); err != nil {
+		return err
+	}
+	if s.uniqueContactIDs, err = createParquetFile[ParquetContactID](a, "uniqueContactID", options...); err != nil {
+		return err
+	}
+	if s.orphanContacts, err = createParquetFile[ParquetContactID](a, "orphanContact", options...); err != nil {
+		return err
+	}
+	s.orphanHosts, err = createParquetFile[ParquetHostName](a, "orphanHost", options...)
+	return err
+}
+
+// WriteRecord writes the unique contact IDs and the orphaned contacts and hosts, the other records are part of the objects written by WriteObject.
+func (s *ParquetSink) WriteRecord(r Record) error {
+	switch r := r.(type) {
+	case UniqueContactIDRecord:
+		return s.uniqueContactIDs.write(ParquetContactID{StandardizeString(r.ID)})
+	case OrphanContactRecord:
+		return s.orphanContacts.write(ParquetContactID{r.ID})
+	case OrphanHostRecord:
+		return s.orphanHosts.write(ParquetHostName{r.Name})
+	}
+	return nil
+}
+
+// WriteObject writes the object as a row of the Parquet file of its type.
+func (s *ParquetSink) WriteObject(objectType string, object any) error {
+	switch o := StandardizeObject(object).(type) {
+	case XMLDomain:
+		return s.domains.write(newParquetDomain(o))
+	case XMLHost:
+		return s.hosts.write(newParquetHost(o))
+	case XMLContact:
+		return s.contacts.write(newParquetContact(o))
+	case XMLRegistrar:
+		return s.registrars.write(newParquetRegistrar(o))
+	case XMLIdnTableReference:
+		return s.idnTableRefs.write(ParquetIDNTableRef{o.ID, o.Url, o.UrlPolicy})
+	case XMLNNDN:
+		return s.nndns.write(ParquetNNDN{o.AName, o.UName, o.IDNTableID, o.OriginalName, o.NameState, depositTime(o.CrDate)})
+	}
+	return nil
+}
+
+// End writes the footers and closes the Parquet files that were created, and returns the first error.
+func (s *ParquetSink) End(a *XMLAnalyzer) error {
+	var firstErr error
+	keep := func(err error) {
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if s.domains != nil {
+		keep(s.domains.close(a.Deposit))
+	}
+	if s.hosts != nil {
+		keep(s.hosts.close(a.Deposit))
+	}
+	if s.contacts != nil {
+		keep(s.contacts.close(a.Deposit))
+	}
+	if s.registrars != nil {
+		keep(s.registrars.close(a.Deposit))
+	}
+	if s.idnTableRefs != nil {
+		keep(s.idnTableRefs.close(a.Deposit))
+	}
+	if s.nndns != nil {
+		keep(s.nndns.close(a.Deposit))
+	}
+	if s.uniqueContactIDs != nil {
+		keep(s.uniqueContactIDs.close(a.Deposit))
+	}
+	if s.orphanContacts != nil {
+		keep(s.orphanContacts.close(a.Deposit))
+	}
+	if s.orphanHosts != nil {
+		keep(s.orphanHosts.close(a.Deposit))
+	}
+	*s = ParquetSink{RowGroupRows: s.RowGroupRows}
+	return firstErr
+}
+
+// Parses a date of the deposit. Returns nil for dates that are empty or not valid RFC 3339, they are stored as null.
+func depositTime(s string) *time.Time {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return nil
+	}
+	t = t.UTC()
+	return &t
+}
+
+func newParquetDomain(d XMLDomain) ParquetDomain {
+	p := ParquetDomain{
+		Name:         d.Name,
+		RoID:         d.RoID,
+		UName:        d.UName,
+		IdnTableID:   d.IdnTableId,
+		OriginalName: d.OriginalName,
+		Registrant:   d.Registrant,
+		ClID:         d.ClID,
+		CrRr:         d.CrRr,
+		CrDate:       depositTime(d.CrDate),
+		ExDate:       depositTime(d.ExDate),
+		UpRr:         d.UpRr,
+		UpDate:       depositTime(d.UpDate),
+	}
+	for _, status := range d.Status {
+		p.Status = append(p.Status, status.S)
+	}
+	for _, contact := range d.Contact {
+		p.Contact = append(p.Contact, ParquetDomainContact{contact.Type, contact.ID})
+	}
+	for _, ns := range d.Ns {
+		p.Nameserver = append(p.Nameserver, ns.HostObjs...)
+	}
+	for _, ds := range d.SecDNS.DSData {
+		p.DSData = append(p.DSData, ParquetDSData{int32(ds.KeyTag), int32(ds.Alg), int32(ds.DigestType), ds.Digest})
+	}
+	if d.TrnData.TrStatus.State != "" {
+		p.Transfer = &ParquetTransfer{
+			TrStatus: d.TrnData.TrStatus.State,
+			ReRr:     d.TrnData.ReRr.RegID,
+			ReDate:   depositTime(d.TrnData.ReDate),
+			AcRr:     d.TrnData.AcRr.RegID,
+			AcDate:   depositTime(d.TrnData.AcDate),
+			ExDate:   depositTime(d.TrnData.ExDate),
+		}
+	}
+	return p
+}
+
+func newParquetHost(h XMLHost) ParquetHost {
+	p := ParquetHost{
+		Name:   h.Name,
+		RoID:   h.RoID,
+		ClID:   h.ClID,
+		CrRr:   h.CrRr,
+		CrDate: depositTime(h.CrDate),
+		UpRr:   h.UpRr,
+		UpDate: depositTime(h.UpDate),
+	}
+	for _, status := range h.Status {
+		p.Status = append(p.Status, status.S)
+	}
+	for _, addr := range h.Addr {
+		p.Address = append(p.Address, ParquetHostAddress{addr.ID, addr.IP})
+	}
+	return p
+}
+
+func newParquetContact(c XMLContact) ParquetContact {
+	p := ParquetContact{
+		ID:     c.ID,
+		RoID:   c.RoID,
+		Voice:  c.Voice,
+		Fax:    c.Fax,
+		Email:  c.Email,
+		ClID:   c.ClID,
+		CrRr:   c.CrRr,
+		CrDate: depositTime(c.CrDate),
+		UpRr:   c.UpRr,
+		UpDate: depositTime(c.UpDate),
+	}
+	for _, status := range c.Status {
+		p.Status = append(p.Status, status.S)
+	}
+	for _, postalInfo := range c.PostalInfo {
+		p.PostalInfo = append(p.PostalInfo, newParquetPostalInfo(postalInfo.Type, postalInfo.Name, postalInfo.Org, postalInfo.Address))
+	}
+	return p
+}
+
+func newParquetRegistrar(r XMLRegistrar) ParquetRegistrar {
+	p := ParquetRegistrar{
+		ID:       r.ID,
+		Name:     r.Name,
+		GurID:    int64(r.GurID),
+		Status:   r.Status,
+		Voice:    r.Voice,
+		Fax:      r.Fax,
+		Email:    r.Email,
+		URL:      r.URL,
+		WhoisURL: r.WhoisInfo.URL,
+		CrDate:   depositTime(r.CrDate),
+		UpDate:   depositTime(r.UpDate),
+	}
+	for _, postalInfo := range r.PostalInfo {
+		p.PostalInfo = append(p.PostalInfo, newParquetPostalInfo(postalInfo.Type, "", "", postalInfo.Address))
+	}
+	return p
+}
+
+func newParquetPostalInfo(postalInfoType, name, org string, addr XMLAddress) ParquetPostalInfo {
+	return ParquetPostalInfo{
+		Type:   postalInfoType,
+		Name:   name,
+		Org:    org,
+		Street: addr.Street,
+		City:   addr.City,
+		SP:     addr.StateProvince,
+		PC:     addr.PostalCode,
+		CC:     addr.CountryCode,
+	}
+}
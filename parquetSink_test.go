@@ -0,0 +1,109 @@
+package ryde
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// Reads all rows of a Parquet file written to the MemFS.
+func readParquetFile[T any](t *testing.T, out *MemFS, name string) []T {
+	t.Helper()
+	data, err := out.ReadFile(name)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", name, err)
+	}
+	rows, err := parquet.Read[T](bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Failed to parse %s: %v", name, err)
+	}
+	return rows
+}
+
+// TestParquetSink tests that the objects are written to typed Parquet files with nested statuses, addresses and DS records.
+func TestParquetSink(t *testing.T) {
+	xmlString := strings.Replace(getValidFullDepositXMLString(), "</rdeDomain:domain>", `<rdeDomain:secDNS>
+			<secDNS:dsData>
+				<secDNS:keyTag>12345</secDNS:keyTag>
+				<secDNS:alg>8</secDNS:alg>
+				<secDNS:digestType>2</secDNS:digestType>
+				<secDNS:digest>49FD46E6C4B45C55D4AC</secDNS:digest>
+			</secDNS:dsData>
+		</rdeDomain:secDNS>
+		</rdeDomain:domain>`, 1)
+	fsys := fstest.MapFS{"test_2019-10-17_FULL_S1_R0.xml": &fstest.MapFile{Data: []byte(xmlString)}}
+	a, err := NewXMLAnalyzerFS(fsys, "test_2019-10-17_FULL_S1_R0.xml")
+	if err != nil {
+		t.Fatalf("NewXMLAnalyzerFS returned an error: %v", err)
+	}
+	out := NewMemFS()
+	a.OutputFS = out
+	a.Sinks = []OutputSink{&ParquetSink{RowGroupRows: 1}}
+	if err := a.AnalyzeTags(); err != nil {
+		t.Fatalf("AnalyzeTags failed with error: %v", err)
+	}
+
+	domains := readParquetFile[ParquetDomain](t, out, "test_2019-10-17_FULL_S1_R0-domains.parquet")
+	if len(domains) != a.Counters["domain"] {
+		t.Fatalf("Expected %d domains, got %d", a.Counters["domain"], len(domains))
+	}
+	crDate := time.Date(1999, 4, 3, 22, 0, 0, 0, time.UTC)
+	if domains[0].Name != "example1.example" || domains[0].CrDate == nil || !domains[0].CrDate.Equal(crDate) || domains[0].UpDate != nil {
+		t.Errorf("Unexpected domain %+v", domains[0])
+	}
+	if !reflect.DeepEqual(domains[0].DSData, []ParquetDSData{{12345, 8, 2, "49FD46E6C4B45C55D4AC"}}) {
+		t.Errorf("Unexpected DS records %v", domains[0].DSData)
+	}
+	if !reflect.DeepEqual(domains[1].Status, []string{"ok", "clientUpdateProhibited"}) || len(domains[1].DSData) != 0 || domains[1].Transfer != nil {
+		t.Errorf("Unexpected domain %+v", domains[1])
+	}
+
+	hosts := readParquetFile[ParquetHost](t, out, "test_2019-10-17_FULL_S1_R0-hosts.parquet")
+	if len(hosts) != 1 || len(hosts[0].Address) != 3 || hosts[0].Address[2] != (ParquetHostAddress{"2001:DB8:1::1", "v6"}) {
+		t.Errorf("Unexpected hosts %+v", hosts)
+	}
+	registrars := readParquetFile[ParquetRegistrar](t, out, "test_2019-10-17_FULL_S1_R0-registrars.parquet")
+	if len(registrars) != 1 || registrars[0].GurID != 8 || registrars[0].WhoisURL != "http://whois.example.example" || registrars[0].PostalInfo[0].Street[0] != "123 Example Dr." {
+		t.Errorf("Unexpected registrars %+v", registrars)
+	}
+	contactIDs := readParquetFile[ParquetContactID](t, out, "test_2019-10-17_FULL_S1_R0-uniqueContactIDs.parquet")
+	if len(contactIDs) != a.Counters["uniqueContactIDs"] {
+		t.Errorf("Expected %d unique contact IDs, got %d", a.Counters["uniqueContactIDs"], len(contactIDs))
+	}
+
+	// Every domain is in a row group of its own and the deposit is in the metadata
+	data, _ := out.ReadFile("test_2019-10-17_FULL_S1_R0-domains.parquet")
+	f, err := parquet.OpenFile(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Failed to open the domains file: %v", err)
+	}
+	if len(f.RowGroups()) != 2 {
+		t.Errorf("Expected 2 row groups, got %d", len(f.RowGroups()))
+	}
+	if id, _ := f.Lookup("ryde.depositId"); id != "20191017001" {
+		t.Errorf("Expected deposit ID 20191017001 in the metadata, got %q", id)
+	}
+}
+
+func TestDepositTime(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected *time.Time
+	}{
+		{"2005-04-23T11:49:00.0Z", &[]time.Time{time.Date(2005, 4, 23, 11, 49, 0, 0, time.UTC)}[0]},
+		{"2005-04-23T13:49:00.123+02:00", &[]time.Time{time.Date(2005, 4, 23, 11, 49, 0, 123000000, time.UTC)}[0]},
+		{"", nil},
+		{"23/04/2005", nil},
+	}
+	for _, tc := range testCases {
+		actual := depositTime(tc.input)
+		if (actual == nil) != (tc.expected == nil) || (actual != nil && !actual.Equal(*tc.expected)) {
+			t.Errorf("depositTime(%q) = %v, expected %v", tc.input, actual, tc.expected)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package ryde
+
+import (
+	"crypto/sha256"
+	"hash"
+	"io"
+	"log"
+)
+
+// Report progress every 10% when the size of the input is known, or every GiB when it is not.
+// Small inputs are read in no time, so we never report more often than every 64 MiB.
+const (
+	progressPercentStep = 10
+	progressBytesStep   = 1 << 30
+	progressMinStep     = 64 << 20
+)
+
+// progressReader is an io.Reader that counts the bytes read from r and logs the progress of the analysis.
+// The bytes are hashed as they are read, so the SHA-256 of the input is known once it has been read to the end.
+type progressReader struct {
+	r     io.Reader
+	name  string    // The name of the input, used in the log messages.
+	total int64     // The expected number of bytes, or 0 if unknown.
+	read  int64     // The number of bytes read so far.
+	next  int64     // The number of bytes at which we log the next progress message.
+	hash  hash.Hash // The SHA-256 of the bytes read so far.
+}
+
+func newProgressReader(r io.Reader, name string, total int64) *progressReader {
+	p := &progressReader{r: r, name: name, total: total, hash: sha256.New()}
+	p.next = p.step()
+	return p
+}
+
+// Returns the number of bytes between progress messages.
+func (p *progressReader) step() int64 {
+	if p.total > 0 {
+		step := p.total * progressPercentStep / 100
+		if step < progressMinStep {
+			return progressMinStep
+		}
+		return step
+	}
+	return progressBytesStep
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.read += int64(n)
+	p.hash.Write(b[:n])
+	if p.read >= p.next {
+		if p.total > 0 {
+			log.Printf("Read %d of %d B (%d%%) of %s\n", p.read, p.total, p.read*100/p.total, p.name)
+		} else {
+			log.Printf("Read %d B of %s\n", p.read, p.name)
+		}
+		for p.next <= p.read {
+			p.next += p.step()
+		}
+	}
+	return n, err
+}
+
+// countingReader is an io.Reader that counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.n += int64(n)
+	return n, err
+}
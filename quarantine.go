@@ -0,0 +1,167 @@
+package ryde
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// QuarantinedObject represents an object that could not be decoded while analyzing in tolerant mode.
+type QuarantinedObject struct {
+	Object   string         `json:"object"`   // The local name of the element that failed to decode.
+	Position SourcePosition `json:"position"` // The location of the element in the XML source.
+	Error    string         `json:"error"`    // The error that occurred while decoding the element.
+	Raw      string         `json:"raw"`      // The raw XML of the element, as far as it could be read.
+}
+
+// rawRecorder is an io.Reader that keeps a copy of the bytes read from r so the raw XML of an element can be retrieved by its offsets.
+// Bytes before the most recent call to discard are dropped, so memory use is bounded by the size of the element being decoded plus the read-ahead of the decoder.
+type rawRecorder struct {
+	r    io.Reader
+	buf  []byte
+	base int64 // The offset of buf[0] in the stream
+}
+
+func (rr *rawRecorder) Read(p []byte) (int, error) {
+	n, err := rr.r.Read(p)
+	rr.buf = append(rr.buf, p[:n]...)
+	return n, err
+}
+
+// Drops the recorded bytes before offset.
+func (rr *rawRecorder) discard(offset int64) {
+	if offset <= rr.base {
+		return
+	}
+	cut := offset - rr.base
+	if cut > int64(len(rr.buf)) {
+		cut = int64(len(rr.buf))
+	}
+	rr.buf = rr.buf[:copy(rr.buf, rr.buf[cut:])]
+	rr.base += cut
+}
+
+// Returns a copy of the recorded bytes between the start and end offsets.
+func (rr *rawRecorder) slice(start, end int64) []byte {
+	if start < rr.base {
+		start = rr.base
+	}
+	if end > rr.base+int64(len(rr.buf)) {
+		end = rr.base + int64(len(rr.buf))
+	}
+	if end <= start {
+		return nil
+	}
+	return bytes.Clone(rr.buf[start-rr.base : end-rr.base])
+}
+
+// Reads the tokens of the element that starts with se, up to and including its matching end element, and returns its raw XML.
+// pos must be the position of se in the XML source.
+func (a *XMLAnalyzer) readRawElement(pos SourcePosition) ([]byte, error) {
+	a.XMLFile.recorder.discard(pos.Offset)
+	depth := 1
+	for depth > 0 {
+		t, err := a.XMLFile.Decoder.Token()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return a.XMLFile.recorder.slice(pos.Offset, a.XMLFile.Decoder.InputOffset()), err
+		}
+		switch t.(type) {
+		case xml.StartElement:
+			depth++
+		case xml.EndElement:
+			depth--
+		}
+	}
+	return a.XMLFile.recorder.slice(pos.Offset, a.XMLFile.Decoder.InputOffset()), nil
+}
+
+// Decodes the element that starts with se into v.
+// In strict mode this decodes directly from the XML decoder. In tolerant mode the raw XML of the element is read first and decoded separately,
+// so an element that fails to decode can be quarantined and the analysis can continue with the next element.
+// ErrObjectQuarantined is returned when the element was quarantined.
+func (a *XMLAnalyzer) decodeObject(v any, se *xml.StartElement, pos SourcePosition) error {
+	if !a.Tolerant {
+		return a.XMLFile.Decoder.DecodeElement(v, se)
+	}
+	raw, err := a.readRawElement(pos)
+	if err != nil {
+		// The XML itself is broken, the decoder cannot recover from this so we quarantine what we have and return the error
+		if qErr := a.quarantine(se.Name.Local, pos, raw, err); qErr != nil {
+			return qErr
+		}
+		return err
+	}
+	if err := xml.Unmarshal(raw, v); err != nil {
+		if qErr := a.quarantine(se.Name.Local, pos, raw, err); qErr != nil {
+			return qErr
+		}
+		return ErrObjectQuarantined
+	}
+	return nil
+}
+
+// Writes an element that could not be decoded to the quarantine file and counts it.
+func (a *XMLAnalyzer) quarantine(object string, pos SourcePosition, raw []byte, decodeErr error) error {
+	a.Counters["quarantined"]++
+	if counter := elementCounter(object); counter != "" {
+		if a.quarantinedObjects == nil {
+			a.quarantinedObjects = make(map[string]int)
+		}
+		a.quarantinedObjects[counter]++
+	}
+	if a.quarantineEncoder == nil {
+		return nil
+	}
+	return a.quarantineEncoder.Encode(QuarantinedObject{
+		Object:   object,
+		Position: pos,
+		Error:    decodeErr.Error(),
+		Raw:      string(raw),
+	})
+}
+
+// Creates the quarantine file for tolerant mode.
+func (a *XMLAnalyzer) CreateQuarantineFile() error {
+	f, err := a.outputFS().OpenFile(a.GetBaseXMLFileName()+QUARANTINE_FILE_SUFFIX, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	a.quarantineFile = f
+	a.quarantineEncoder = json.NewEncoder(f)
+	return nil
+}
+
+// Closes the quarantine file.
+func (a *XMLAnalyzer) CloseQuarantineFile() error {
+	if a.quarantineFile == nil {
+		return nil
+	}
+	err := a.quarantineFile.Close()
+	a.quarantineFile = nil
+	a.quarantineEncoder = nil
+	return err
+}
+
+// Returns an error summarizing the quarantined objects and the error that stopped the analysis, if any.
+func (a *XMLAnalyzer) tolerantSummary(fatalErr error) error {
+	n := a.Counters["quarantined"]
+	if fatalErr != nil {
+		return fmt.Errorf("%w: %d objects quarantined, analysis stopped at unrecoverable error: %s", ErrObjectsQuarantined, n, fatalErr)
+	}
+	if n > 0 {
+		return fmt.Errorf("%w: %d objects quarantined", ErrObjectsQuarantined, n)
+	}
+	return nil
+}
+
+// isQuarantined reports whether err signals that the object was quarantined and the analysis can continue.
+func isQuarantined(err error) bool {
+	return errors.Is(err, ErrObjectQuarantined)
+}
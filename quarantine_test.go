@@ -0,0 +1,156 @@
+package ryde
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+// Returns a filename to a testfile containing the valid XML deposit with the given replacements applied. Or returns an error
+func createXMLDepositTestFileWithReplacements(replacements ...string) (string, error) {
+	f, err := os.CreateTemp("", "*test.xml")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	_, err = f.WriteString(strings.NewReplacer(replacements...).Replace(getValidFullDepositXMLString()))
+	if err != nil {
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// TestAnalyzeTagsStrictModeFailsOnMalformedObject tests that strict mode, the default, aborts on an object that fails to decode.
+func TestAnalyzeTagsStrictModeFailsOnMalformedObject(t *testing.T) {
+	f, err := createXMLDepositTestFileWithReplacements("<rdeRegistrar:gurid>8</rdeRegistrar:gurid>", "<rdeRegistrar:gurid>eight</rdeRegistrar:gurid>")
+	if err != nil {
+		t.Fatalf("Failed to create temporary file: %v", err)
+	}
+	defer os.Remove(f)
+	a, err := NewXMLAnalyzer(f)
+	if err != nil {
+		t.Fatalf("NewXMLAnalyzer returned an error: %s", err)
+	}
+	err = a.AnalyzeTags()
+	if err == nil {
+		t.Fatal("Expected AnalyzeTags to return an error in strict mode")
+	}
+}
+
+// TestAnalyzeTagsTolerantMode tests that objects that fail to decode are quarantined and the analysis continues.
+func TestAnalyzeTagsTolerantMode(t *testing.T) {
+	f, err := createXMLDepositTestFileWithReplacements(
+		"<rdeRegistrar:gurid>8</rdeRegistrar:gurid>", "<rdeRegistrar:gurid>eight</rdeRegistrar:gurid>",
+		"<rdeDomain:name>example1.example</rdeDomain:name>", "<rdeDomain:name>example1.example</rdeDomain:name><rdeDomain:secDNS><secDNS:dsData><secDNS:keyTag>x</secDNS:keyTag></secDNS:dsData></rdeDomain:secDNS>",
+	)
+	if err != nil {
+		t.Fatalf("Failed to create temporary file: %v", err)
+	}
+	defer os.Remove(f)
+	a, err := NewXMLAnalyzer(f)
+	if err != nil {
+		t.Fatalf("NewXMLAnalyzer returned an error: %s", err)
+	}
+	a.Tolerant = true
+	err = a.AnalyzeTags()
+	if !errors.Is(err, ErrObjectsQuarantined) {
+		t.Fatalf("Expected ErrObjectsQuarantined, got %v", err)
+	}
+	if a.Counters["quarantined"] != 2 {
+		t.Errorf("Expected 2 quarantined objects, got %d", a.Counters["quarantined"])
+	}
+	// The other objects should still have been processed
+	if a.Counters["domain"] != 2 || a.Counters["host"] != 1 || a.Counters["nndn"] != 1 {
+		t.Errorf("Expected the analysis to continue past quarantined objects, got counters %v", a.Counters)
+	}
+
+	// The quarantined domain is not in the output, so it is missing from the header reconciliation
+	var mismatches []Finding
+	for _, f := range a.Findings {
+		if f.RuleID == RULE_HEADER_COUNT_MISMATCH {
+			mismatches = append(mismatches, f)
+		}
+	}
+	if len(mismatches) != 2 || mismatches[0].Message != "header count for domain is 2, but the deposit contains 1 and 1 quarantined" || mismatches[1].Message != "header count for registrar is 1, but the deposit contains 0 and 1 quarantined" {
+		t.Errorf("Expected header count mismatches for the quarantined domain and registrar, got %v", mismatches)
+	}
+	for _, result := range a.Report.Reconciliation {
+		if result.Object == "domain" && (result.Found != 1 || result.Quarantined != 1 || result.Match) {
+			t.Errorf("Unexpected reconciliation of the domains %+v", result)
+		}
+	}
+
+	qf, err := os.Open(a.GetBaseXMLFileName() + QUARANTINE_FILE_SUFFIX)
+	if err != nil {
+		t.Fatalf("Failed to open quarantine file: %v", err)
+	}
+	defer qf.Close()
+	defer os.Remove(qf.Name())
+	var objects []QuarantinedObject
+	scanner := bufio.NewScanner(qf)
+	for scanner.Scan() {
+		var q QuarantinedObject
+		if err := json.Unmarshal(scanner.Bytes(), &q); err != nil {
+			t.Fatalf("Failed to decode quarantined object: %v", err)
+		}
+		objects = append(objects, q)
+	}
+	if len(objects) != 2 {
+		t.Fatalf("Expected 2 quarantined objects in the file, got %d", len(objects))
+	}
+	if objects[0].Object != "domain" || !strings.HasPrefix(objects[0].Raw, "<rdeDomain:domain>") || !strings.HasSuffix(objects[0].Raw, "</rdeDomain:domain>") {
+		t.Errorf("Unexpected quarantined domain %v", objects[0])
+	}
+	if objects[1].Object != "registrar" || !strings.Contains(objects[1].Raw, "eight") || objects[1].Error == "" {
+		t.Errorf("Unexpected quarantined registrar %v", objects[1])
+	}
+	xmlString, _ := os.ReadFile(f)
+	if objects[1].Position.Offset != int64(strings.Index(string(xmlString), "<rdeRegistrar:registrar>")) {
+		t.Errorf("Unexpected offset %d for quarantined registrar", objects[1].Position.Offset)
+	}
+}
+
+// TestAnalyzeTagsTolerantModeSyntaxError tests that broken XML stops the analysis in tolerant mode, but the output is still written.
+func TestAnalyzeTagsTolerantModeSyntaxError(t *testing.T) {
+	f, err := createXMLDepositTestFileWithReplacements("<rdeHost:name>ns1.example1.example</rdeHost:name>", "<rdeHost:name>ns1.example1.example</rdeHost:nam>")
+	if err != nil {
+		t.Fatalf("Failed to create temporary file: %v", err)
+	}
+	defer os.Remove(f)
+	a, err := NewXMLAnalyzer(f)
+	if err != nil {
+		t.Fatalf("NewXMLAnalyzer returned an error: %s", err)
+	}
+	a.Tolerant = true
+	err = a.AnalyzeTags()
+	if !errors.Is(err, ErrObjectsQuarantined) {
+		t.Fatalf("Expected ErrObjectsQuarantined, got %v", err)
+	}
+	if a.Counters["quarantined"] != 1 || a.Counters["domain"] != 2 {
+		t.Errorf("Unexpected counters %v", a.Counters)
+	}
+	if _, err := os.Stat(a.GetBaseXMLFileName() + DOMAIN_FILE_SUFFIX); err != nil {
+		t.Errorf("Expected the domain file to be written: %v", err)
+	}
+}
+
+// TestRawRecorder tests that the recorder returns the bytes between offsets and drops bytes that are no longer needed.
+func TestRawRecorder(t *testing.T) {
+	rr := &rawRecorder{r: strings.NewReader("0123456789")}
+	buf := make([]byte, 6)
+	rr.Read(buf)
+	if got := string(rr.slice(2, 5)); got != "234" {
+		t.Errorf("slice(2, 5) = %q, want %q", got, "234")
+	}
+	rr.discard(4)
+	rr.Read(buf)
+	if got := string(rr.slice(2, 8)); got != "4567" {
+		t.Errorf("slice(2, 8) after discard = %q, want %q", got, "4567")
+	}
+	if len(rr.buf) != 6 || rr.base != 4 {
+		t.Errorf("Expected 6 recorded bytes from offset 4, got %d from %d", len(rr.buf), rr.base)
+	}
+}
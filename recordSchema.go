@@ -0,0 +1,248 @@
+package ryde
+
+// RecordField describes a column of a record type.
+type RecordField struct {
+	Name        string // The name of the column, used in the CSV header row.
+	Type        string // The Frictionless type of the column: string, integer or datetime.
+	Description string // A short description of the column.
+}
+
+// RecordForeignKey describes a reference from columns of a record type to the primary key of another record type.
+// References hold for FULL deposits; a DIFF deposit only contains the objects that changed, so the referenced object may be missing.
+type RecordForeignKey struct {
+	Fields          []string // The referencing columns.
+	Reference       string   // The referenced record type.
+	ReferenceFields []string // The referenced columns.
+}
+
+// RecordSchema describes the columns and keys of a record type.
+type RecordSchema struct {
+	Description string
+	Fields      []RecordField
+	PrimaryKey  []string
+	ForeignKeys []RecordForeignKey
+}
+
+// Returns the names of the columns in the schema.
+func (s RecordSchema) FieldNames() []string {
+	names := make([]string, len(s.Fields))
+	for i, f := range s.Fields {
+		names[i] = f.Name
+	}
+	return names
+}
+
+// Shorthands for the column definitions below.
+func stringField(name, description string) RecordField {
+	return RecordField{name, "string", description}
+}
+
+func integerField(name, description string) RecordField {
+	return RecordField{name, "integer", description}
+}
+
+func datetimeField(name, description string) RecordField {
+	return RecordField{name, "datetime", description}
+}
+
+// Returns the street columns of postal info records.
+func streetFields() []RecordField {
+	return []RecordField{
+		stringField("street1", "The first street line of the address"),
+		stringField("street2", "The second street line of the address"),
+		stringField("street3", "The third street line of the address"),
+	}
+}
+
+// Returns the city, state or province, postal code and country code columns of postal info records.
+func addressFields() []RecordField {
+	return []RecordField{
+		stringField("city", "The city of the address"),
+		stringField("sp", "The state or province of the address"),
+		stringField("pc", "The postal code of the address"),
+		stringField("cc", "The two letter country code of the address"),
+	}
+}
+
+// RecordSchemas describes the columns of every record type, keyed by record type. The columns are in the order of Record.Values.
+var RecordSchemas = map[string]RecordSchema{
+	"domain": {
+		Description: "Domain names",
+		Fields: []RecordField{
+			stringField("name", "The fully qualified domain name, the A-label for IDNs"),
+			stringField("roid", "The repository object ID"),
+			stringField("uName", "The U-label of an IDN"),
+			stringField("idnTableId", "The IDN table used for the IDN"),
+			stringField("originalName", "The domain name this IDN variant was derived from"),
+			stringField("registrant", "The ID of the registrant contact"),
+			stringField("clID", "The ID of the sponsoring registrar"),
+			stringField("crRr", "The ID of the registrar that created the domain"),
+			datetimeField("crDate", "The creation date"),
+			datetimeField("exDate", "The expiration date"),
+			stringField("upRr", "The ID of the registrar that last updated the domain"),
+			datetimeField("upDate", "The date of the last update"),
+		},
+		PrimaryKey: []string{"name"},
+		ForeignKeys: []RecordForeignKey{
+			{[]string{"registrant"}, "contact", []string{"id"}},
+			{[]string{"clID"}, "registrar", []string{"id"}},
+		},
+	},
+	"domainStatus": {
+		Description: "Statuses of the domain names",
+		Fields:      []RecordField{stringField("domain", "The domain name"), stringField("status", "The EPP status")},
+		PrimaryKey:  []string{"domain", "status"},
+		ForeignKeys: []RecordForeignKey{{[]string{"domain"}, "domain", []string{"name"}}},
+	},
+	"domainNameservers": {
+		Description: "Nameservers of the domain names",
+		Fields:      []RecordField{stringField("domain", "The domain name"), stringField("nameserver", "The name of the host the domain is delegated to")},
+		PrimaryKey:  []string{"domain", "nameserver"},
+		ForeignKeys: []RecordForeignKey{{[]string{"domain"}, "domain", []string{"name"}}},
+	},
+	"domainDnssec": {
+		Description: "DS records of the domain names",
+		Fields: []RecordField{
+			stringField("domain", "The domain name"),
+			integerField("keyTag", "The key tag of the DNSKEY"),
+			integerField("alg", "The algorithm of the DNSKEY"),
+			integerField("digestType", "The digest type"),
+			stringField("digest", "The digest of the DNSKEY"),
+		},
+		ForeignKeys: []RecordForeignKey{{[]string{"domain"}, "domain", []string{"name"}}},
+	},
+	"domainTransfers": {
+		Description: "Pending or last transfers of the domain names",
+		Fields: []RecordField{
+			stringField("domain", "The domain name"),
+			stringField("trStatus", "The state of the transfer"),
+			stringField("reRr", "The ID of the registrar that requested the transfer"),
+			datetimeField("reDate", "The date the transfer was requested"),
+			stringField("acRr", "The ID of the registrar that should act upon the request"),
+			datetimeField("acDate", "The date the transfer must be acted upon"),
+			datetimeField("exDate", "The expiration date if the transfer changes it"),
+		},
+		PrimaryKey:  []string{"domain"},
+		ForeignKeys: []RecordForeignKey{{[]string{"domain"}, "domain", []string{"name"}}},
+	},
+	"host": {
+		Description: "Hosts",
+		Fields: []RecordField{
+			stringField("name", "The fully qualified host name"),
+			stringField("roid", "The repository object ID"),
+			stringField("clID", "The ID of the sponsoring registrar"),
+			stringField("crRr", "The ID of the registrar that created the host"),
+			datetimeField("crDate", "The creation date"),
+			stringField("upRr", "The ID of the registrar that last updated the host"),
+			datetimeField("upDate", "The date of the last update"),
+		},
+		PrimaryKey:  []string{"name"},
+		ForeignKeys: []RecordForeignKey{{[]string{"clID"}, "registrar", []string{"id"}}},
+	},
+	"hostStatus": {
+		Description: "Statuses of the hosts",
+		Fields:      []RecordField{stringField("host", "The host name"), stringField("status", "The EPP status")},
+		PrimaryKey:  []string{"host", "status"},
+		ForeignKeys: []RecordForeignKey{{[]string{"host"}, "host", []string{"name"}}},
+	},
+	"hostAddress": {
+		Description: "IP addresses of the hosts",
+		Fields:      []RecordField{stringField("host", "The host name"), stringField("address", "The IP address"), stringField("version", "The IP version: v4 or v6")},
+		PrimaryKey:  []string{"host", "address"},
+		ForeignKeys: []RecordForeignKey{{[]string{"host"}, "host", []string{"name"}}},
+	},
+	"contact": {
+		Description: "Contacts",
+		Fields: []RecordField{
+			stringField("id", "The contact ID"),
+			stringField("roid", "The repository object ID"),
+			stringField("voice", "The phone number"),
+			stringField("fax", "The fax number"),
+			stringField("email", "The email address"),
+			stringField("clID", "The ID of the sponsoring registrar"),
+			stringField("crRr", "The ID of the registrar that created the contact"),
+			datetimeField("crDate", "The creation date"),
+			stringField("upRr", "The ID of the registrar that last updated the contact"),
+			datetimeField("upDate", "The date of the last update"),
+		},
+		PrimaryKey:  []string{"id"},
+		ForeignKeys: []RecordForeignKey{{[]string{"clID"}, "registrar", []string{"id"}}},
+	},
+	"contactStatus": {
+		Description: "Statuses of the contacts",
+		Fields:      []RecordField{stringField("contact", "The contact ID"), stringField("status", "The EPP status")},
+		PrimaryKey:  []string{"contact", "status"},
+		ForeignKeys: []RecordForeignKey{{[]string{"contact"}, "contact", []string{"id"}}},
+	},
+	"contactPostalInfo": {
+		Description: "Postal info of the contacts",
+		Fields: append(append([]RecordField{
+			stringField("contact", "The contact ID"),
+			stringField("type", "The type of postal info: int or loc"),
+			stringField("name", "The name of the contact"),
+			stringField("org", "The organization of the contact"),
+		}, streetFields()...), addressFields()...),
+		PrimaryKey:  []string{"contact", "type"},
+		ForeignKeys: []RecordForeignKey{{[]string{"contact"}, "contact", []string{"id"}}},
+	},
+	"registrar": {
+		Description: "Registrars",
+		Fields: []RecordField{
+			stringField("id", "The registrar ID"),
+			stringField("name", "The name of the registrar"),
+			integerField("gurid", "The IANA registrar ID"),
+			stringField("status", "The status of the registrar"),
+			stringField("whoisUrl", "The URL of the whois server of the registrar"),
+			stringField("url", "The URL of the registrar"),
+			datetimeField("crDate", "The creation date"),
+			datetimeField("upDate", "The date of the last update"),
+			stringField("voice", "The phone number"),
+			stringField("fax", "The fax number"),
+			stringField("email", "The email address"),
+		},
+		PrimaryKey: []string{"id"},
+	},
+	"registrarPostalInfo": {
+		Description: "Postal info of the registrars",
+		Fields: append(append([]RecordField{
+			stringField("registrar", "The registrar ID"),
+			stringField("type", "The type of postal info: int or loc"),
+		}, streetFields()...), addressFields()...),
+		PrimaryKey:  []string{"registrar", "type"},
+		ForeignKeys: []RecordForeignKey{{[]string{"registrar"}, "registrar", []string{"id"}}},
+	},
+	"idnLanguage": {
+		Description: "IDN table references",
+		Fields:      []RecordField{stringField("id", "The IDN table ID"), stringField("url", "The URL of the IDN table"), stringField("urlPolicy", "The URL of the IDN policy")},
+		PrimaryKey:  []string{"id"},
+	},
+	"nndn": {
+		Description: "NNDNs: names that are not domain names, e.g. blocked or withheld names",
+		Fields: []RecordField{
+			stringField("aName", "The A-label of the name"),
+			stringField("uName", "The U-label of the name"),
+			stringField("idnTableId", "The IDN table used for the name"),
+			stringField("originalName", "The domain name this name was derived from"),
+			stringField("nameState", "The state of the name: blocked or withheld"),
+			datetimeField("crDate", "The creation date"),
+		},
+		PrimaryKey: []string{"aName"},
+	},
+	"uniqueContactID": {
+		Description: "IDs of the contacts that are referenced by domains",
+		Fields:      []RecordField{stringField("id", "The contact ID")},
+		PrimaryKey:  []string{"id"},
+		ForeignKeys: []RecordForeignKey{{[]string{"id"}, "contact", []string{"id"}}},
+	},
+	"orphanContact": {
+		Description: "IDs of the contacts that no domain references",
+		Fields:      []RecordField{stringField("id", "The contact ID")},
+		PrimaryKey:  []string{"id"},
+		ForeignKeys: []RecordForeignKey{{[]string{"id"}, "contact", []string{"id"}}},
+	},
+	"orphanHost": {
+		Description: "Names of the hosts that no domain delegates to",
+		Fields:      []RecordField{stringField("name", "The host name")},
+		PrimaryKey:  []string{"name"},
+	},
+}
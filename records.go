@@ -0,0 +1,207 @@
+package ryde
+
+import "strconv"
+
+// Record is a typed row of output produced while analyzing a deposit, e.g. a domain or one of its statuses.
+// Output sinks receive every record through OutputSink.WriteRecord.
+type Record interface {
+	// RecordType returns the type of the record, e.g. domain or domainStatus. It is the key of the record's file in CSVFilesAndSuffixes.
+	RecordType() string
+	// Values returns the standardized values of the record in column order.
+	Values() []string
+}
+
+// Returns the street lines of an address padded or truncated to 3 lines, so postal info records always have the same number of columns.
+func streetLines(street []string) [3]string {
+	var lines [3]string
+	copy(lines[:], street)
+	return lines
+}
+
+// DomainRecord holds the attributes of a domain.
+type DomainRecord struct {
+	Name, RoID, UName, IdnTableID, OriginalName, Registrant, ClID, CrRr, CrDate, ExDate, UpRr, UpDate string
+}
+
+func (DomainRecord) RecordType() string { return "domain" }
+func (r DomainRecord) Values() []string {
+	return StandardizeStringSlice([]string{r.Name, r.RoID, r.UName, r.IdnTableID, r.OriginalName, r.Registrant, r.ClID, r.CrRr, r.CrDate, r.ExDate, r.UpRr, r.UpDate})
+}
+
+// DomainStatusRecord holds a status of a domain.
+type DomainStatusRecord struct {
+	Domain, Status string
+}
+
+func (DomainStatusRecord) RecordType() string { return "domainStatus" }
+func (r DomainStatusRecord) Values() []string {
+	return StandardizeStringSlice([]string{r.Domain, r.Status})
+}
+
+// DomainNameserverRecord holds a nameserver of a domain.
+type DomainNameserverRecord struct {
+	Domain, Nameserver string
+}
+
+func (DomainNameserverRecord) RecordType() string { return "domainNameservers" }
+func (r DomainNameserverRecord) Values() []string {
+	return StandardizeStringSlice([]string{r.Domain, r.Nameserver})
+}
+
+// DomainDnssecRecord holds a DS record of a domain.
+type DomainDnssecRecord struct {
+	Domain                  string
+	KeyTag, Alg, DigestType int
+	Digest                  string
+}
+
+func (DomainDnssecRecord) RecordType() string { return "domainDnssec" }
+func (r DomainDnssecRecord) Values() []string {
+	return StandardizeStringSlice([]string{r.Domain, strconv.Itoa(r.KeyTag), strconv.Itoa(r.Alg), strconv.Itoa(r.DigestType), r.Digest})
+}
+
+// DomainTransferRecord holds the pending or last transfer of a domain.
+type DomainTransferRecord struct {
+	Domain, State, ReRr, ReDate, AcRr, AcDate, ExDate string
+}
+
+func (DomainTransferRecord) RecordType() string { return "domainTransfers" }
+func (r DomainTransferRecord) Values() []string {
+	return StandardizeStringSlice([]string{r.Domain, r.State, r.ReRr, r.ReDate, r.AcRr, r.AcDate, r.ExDate})
+}
+
+// HostRecord holds the attributes of a host.
+type HostRecord struct {
+	Name, RoID, ClID, CrRr, CrDate, UpRr, UpDate string
+}
+
+func (HostRecord) RecordType() string { return "host" }
+func (r HostRecord) Values() []string {
+	return StandardizeStringSlice([]string{r.Name, r.RoID, r.ClID, r.CrRr, r.CrDate, r.UpRr, r.UpDate})
+}
+
+// HostStatusRecord holds a status of a host.
+type HostStatusRecord struct {
+	Host, Status string
+}
+
+func (HostStatusRecord) RecordType() string { return "hostStatus" }
+func (r HostStatusRecord) Values() []string {
+	return StandardizeStringSlice([]string{r.Host, r.Status})
+}
+
+// HostAddressRecord holds an IP address of a host and its version, v4 or v6.
+type HostAddressRecord struct {
+	Host, Address, Version string
+}
+
+func (HostAddressRecord) RecordType() string { return "hostAddress" }
+func (r HostAddressRecord) Values() []string {
+	return StandardizeStringSlice([]string{r.Host, r.Address, r.Version})
+}
+
+// ContactRecord holds the attributes of a contact.
+type ContactRecord struct {
+	ID, RoID, Voice, Fax, Email, ClID, CrRr, CrDate, UpRr, UpDate string
+}
+
+func (ContactRecord) RecordType() string { return "contact" }
+func (r ContactRecord) Values() []string {
+	return StandardizeStringSlice([]string{r.ID, r.RoID, r.Voice, r.Fax, r.Email, r.ClID, r.CrRr, r.CrDate, r.UpRr, r.UpDate})
+}
+
+// ContactStatusRecord holds a status of a contact.
+type ContactStatusRecord struct {
+	Contact, Status string
+}
+
+func (ContactStatusRecord) RecordType() string { return "contactStatus" }
+func (r ContactStatusRecord) Values() []string {
+	return StandardizeStringSlice([]string{r.Contact, r.Status})
+}
+
+// ContactPostalInfoRecord holds a postal info (int or loc) of a contact.
+type ContactPostalInfoRecord struct {
+	Contact, Type, Name, Org                     string
+	Street                                       [3]string
+	City, StateProvince, PostalCode, CountryCode string
+}
+
+func (ContactPostalInfoRecord) RecordType() string { return "contactPostalInfo" }
+func (r ContactPostalInfoRecord) Values() []string {
+	return StandardizeStringSlice([]string{r.Contact, r.Type, r.Name, r.Org, r.Street[0], r.Street[1], r.Street[2], r.City, r.StateProvince, r.PostalCode, r.CountryCode})
+}
+
+// RegistrarRecord holds the attributes of a registrar.
+type RegistrarRecord struct {
+	ID, Name                                                 string
+	GurID                                                    int
+	Status, WhoisURL, URL, CrDate, UpDate, Voice, Fax, Email string
+}
+
+func (RegistrarRecord) RecordType() string { return "registrar" }
+func (r RegistrarRecord) Values() []string {
+	return StandardizeStringSlice([]string{r.ID, r.Name, strconv.Itoa(r.GurID), r.Status, r.WhoisURL, r.URL, r.CrDate, r.UpDate, r.Voice, r.Fax, r.Email})
+}
+
+// RegistrarPostalInfoRecord holds a postal info (int or loc) of a registrar.
+type RegistrarPostalInfoRecord struct {
+	Registrar, Type                              string
+	Street                                       [3]string
+	City, StateProvince, PostalCode, CountryCode string
+}
+
+func (RegistrarPostalInfoRecord) RecordType() string { return "registrarPostalInfo" }
+func (r RegistrarPostalInfoRecord) Values() []string {
+	return StandardizeStringSlice([]string{r.Registrar, r.Type, r.Street[0], r.Street[1], r.Street[2], r.City, r.StateProvince, r.PostalCode, r.CountryCode})
+}
+
+// IDNTableRefRecord holds an IDN table reference.
+type IDNTableRefRecord struct {
+	ID, URL, URLPolicy string
+}
+
+func (IDNTableRefRecord) RecordType() string { return "idnLanguage" }
+func (r IDNTableRefRecord) Values() []string {
+	return StandardizeStringSlice([]string{r.ID, r.URL, r.URLPolicy})
+}
+
+// NNDNRecord holds a NNDN (a name that is not a domain name, e.g. a blocked or withheld name).
+type NNDNRecord struct {
+	AName, UName, IDNTableID, OriginalName, NameState, CrDate string
+}
+
+func (NNDNRecord) RecordType() string { return "nndn" }
+func (r NNDNRecord) Values() []string {
+	return StandardizeStringSlice([]string{r.AName, r.UName, r.IDNTableID, r.OriginalName, r.NameState, r.CrDate})
+}
+
+// UniqueContactIDRecord holds the ID of a contact that is referenced by at least one domain.
+type UniqueContactIDRecord struct {
+	ID string
+}
+
+func (UniqueContactIDRecord) RecordType() string { return "uniqueContactID" }
+func (r UniqueContactIDRecord) Values() []string {
+	return StandardizeStringSlice([]string{r.ID})
+}
+
+// OrphanContactRecord holds the ID of a contact that no domain references.
+type OrphanContactRecord struct {
+	ID string
+}
+
+func (OrphanContactRecord) RecordType() string { return "orphanContact" }
+func (r OrphanContactRecord) Values() []string {
+	return []string{r.ID}
+}
+
+// OrphanHostRecord holds the name of a host that no domain delegates to.
+type OrphanHostRecord struct {
+	Name string
+}
+
+func (OrphanHostRecord) RecordType() string { return "orphanHost" }
+func (r OrphanHostRecord) Values() []string {
+	return []string{r.Name}
+}
@@ -0,0 +1,95 @@
+package ryde
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The deposit types that can be used in a RyDE file name.
+const (
+	DEPOSIT_TYPE_FULL = "FULL"
+	DEPOSIT_TYPE_DIFF = "DIFF"
+	DEPOSIT_TYPE_INCR = "INCR"
+)
+
+// The layout of the date in a RyDE file name.
+const rydeFileNameDateLayout = "2006-01-02"
+
+// Matches {tld}_{YYYY-MM-DD}_{FULL|DIFF|INCR}_S{seq}_R{resend}. IDN TLDs are written as A-labels.
+var rydeFileNameRegex = regexp.MustCompile(`^([a-z0-9-]+)_(\d{4}-\d{2}-\d{2})_(FULL|DIFF|INCR)_S([1-9]\d*)_R(\d+)$`)
+
+// RyDEFileName represents the name of a deposit file following the ICANN naming convention {tld}_{YYYY-MM-DD}_{type}_S{seq}_R{resend}.{ext}
+// as described in the ICANN Registry Interfaces specification (https://www.icann.org/en/system/files/files/rri-specification-01aug23-en.pdf).
+type RyDEFileName struct {
+	TLD      string    // The TLD of the deposit, IDN TLDs as A-label.
+	Date     time.Time // The date of the watermark of the deposit.
+	Type     string    // The deposit type: FULL, DIFF or INCR.
+	Sequence int       // The sequence number of the file when a deposit is split over multiple files, starting at 1.
+	Resend   int       // The number of times the deposit was resent, starting at 0.
+}
+
+// ParseRyDEFileName parses a RyDE file name. Any directory and extensions, e.g. .ryde, .sig or .xml, are ignored.
+func ParseRyDEFileName(name string) (RyDEFileName, error) {
+	base := filepath.Base(name)
+	if i := strings.Index(base, "."); i >= 0 {
+		base = base[:i]
+	}
+	m := rydeFileNameRegex.FindStringSubmatch(base)
+	if m == nil {
+		return RyDEFileName{}, fmt.Errorf("%w: %s", ErrInvalidRyDEFileName, name)
+	}
+	date, err := time.Parse(rydeFileNameDateLayout, m[2])
+	if err != nil {
+		return RyDEFileName{}, fmt.Errorf("%w: %s has an invalid date: %s", ErrInvalidRyDEFileName, name, err)
+	}
+	// The regex guarantees these are numbers, but they can still be out of range
+	seq, err := strconv.Atoi(m[4])
+	if err != nil {
+		return RyDEFileName{}, fmt.Errorf("%w: %s has an invalid sequence number: %s", ErrInvalidRyDEFileName, name, err)
+	}
+	resend, err := strconv.Atoi(m[5])
+	if err != nil {
+		return RyDEFileName{}, fmt.Errorf("%w: %s has an invalid resend number: %s", ErrInvalidRyDEFileName, name, err)
+	}
+	return RyDEFileName{
+		TLD:      m[1],
+		Date:     date,
+		Type:     m[3],
+		Sequence: seq,
+		Resend:   resend,
+	}, nil
+}
+
+// String returns the RyDE file name without extension, e.g. example_2019-10-17_FULL_S1_R0.
+func (n RyDEFileName) String() string {
+	return fmt.Sprintf("%s_%s_%s_S%d_R%d", n.TLD, n.Date.Format(rydeFileNameDateLayout), n.Type, n.Sequence, n.Resend)
+}
+
+// Checks the name of the deposit file against the deposit and the header and adds a finding for each mismatch.
+// A file name that does not follow the naming convention is reported as well.
+func (a *XMLAnalyzer) checkFileName() {
+	fileName := filepath.Base(a.XMLFile.FileName)
+	name, err := ParseRyDEFileName(fileName)
+	if err != nil {
+		a.addBuiltinFinding(RULE_FILE_NAME_INVALID, "file", fileName, "", err.Error(), SourcePosition{})
+		return
+	}
+	if !strings.EqualFold(name.Type, a.Deposit.Type) {
+		a.addBuiltinFinding(RULE_FILE_NAME_TYPE_MISMATCH, "deposit", a.Deposit.ID, "type", fmt.Sprintf("file name has type %s, but the deposit has type %s", name.Type, a.Deposit.Type), a.depositPosition)
+	}
+	if name.Resend != a.Deposit.Resend {
+		a.addBuiltinFinding(RULE_FILE_NAME_RESEND_MISMATCH, "deposit", a.Deposit.ID, "resend", fmt.Sprintf("file name has resend %d, but the deposit has resend %d", name.Resend, a.Deposit.Resend), a.depositPosition)
+	}
+	watermark, err := time.Parse(time.RFC3339, a.Deposit.Watermark)
+	if err != nil || watermark.UTC().Format(rydeFileNameDateLayout) != name.Date.Format(rydeFileNameDateLayout) {
+		a.addBuiltinFinding(RULE_FILE_NAME_DATE_MISMATCH, "deposit", a.Deposit.ID, "watermark", fmt.Sprintf("file name has date %s, but the deposit has watermark %s", name.Date.Format(rydeFileNameDateLayout), a.Deposit.Watermark), a.depositPosition)
+	}
+	// Only one of the parts of a split deposit needs to have the header
+	if (a.part == nil || a.Header.TLD != "") && !strings.EqualFold(name.TLD, a.Header.TLD) {
+		a.addBuiltinFinding(RULE_FILE_NAME_TLD_MISMATCH, "header", a.Header.TLD, "tld", fmt.Sprintf("file name has TLD %s, but the header has TLD %s", name.TLD, a.Header.TLD), a.headerPosition)
+	}
+}
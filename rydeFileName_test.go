@@ -0,0 +1,134 @@
+package ryde
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestParseRyDEFileName tests parsing valid and invalid RyDE file names.
+func TestParseRyDEFileName(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected RyDEFileName
+		valid    bool
+	}{
+		{"example_2019-10-17_FULL_S1_R0.ryde", RyDEFileName{"example", time.Date(2019, 10, 17, 0, 0, 0, 0, time.UTC), "FULL", 1, 0}, true},
+		{"/deposits/xn--mgbh0fb_2024-02-29_DIFF_S12_R3.sig", RyDEFileName{"xn--mgbh0fb", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC), "DIFF", 12, 3}, true},
+		{"example_2019-10-17_INCR_S1_R0.xml.gz", RyDEFileName{"example", time.Date(2019, 10, 17, 0, 0, 0, 0, time.UTC), "INCR", 1, 0}, true},
+		{"example_2019-10-17_FULL_S1_R0", RyDEFileName{"example", time.Date(2019, 10, 17, 0, 0, 0, 0, time.UTC), "FULL", 1, 0}, true},
+		{"example_2019-10-17_full_S1_R0.ryde", RyDEFileName{}, false},
+		{"example_2019-10-17_FULL_S0_R0.ryde", RyDEFileName{}, false},
+		{"example_2019-02-30_FULL_S1_R0.ryde", RyDEFileName{}, false},
+		{"example_20191017_FULL_S1_R0.ryde", RyDEFileName{}, false},
+		{"example_2019-10-17_FULL_S1.ryde", RyDEFileName{}, false},
+		{"deposit.xml", RyDEFileName{}, false},
+	}
+	for _, test := range tests {
+		got, err := ParseRyDEFileName(test.name)
+		if !test.valid {
+			if !errors.Is(err, ErrInvalidRyDEFileName) {
+				t.Errorf("ParseRyDEFileName(%q) expected ErrInvalidRyDEFileName, got %v", test.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseRyDEFileName(%q) returned an error: %v", test.name, err)
+			continue
+		}
+		if got != test.expected {
+			t.Errorf("ParseRyDEFileName(%q) = %+v, want %+v", test.name, got, test.expected)
+		}
+	}
+}
+
+// TestRyDEFileNameString tests that a RyDE file name is formatted as it is parsed.
+func TestRyDEFileNameString(t *testing.T) {
+	for _, name := range []string{"example_2019-10-17_FULL_S1_R0", "xn--mgbh0fb_2024-02-29_DIFF_S12_R3"} {
+		parsed, err := ParseRyDEFileName(name)
+		if err != nil {
+			t.Fatalf("ParseRyDEFileName(%q) returned an error: %v", name, err)
+		}
+		if parsed.String() != name {
+			t.Errorf("Expected %s, got %s", name, parsed.String())
+		}
+	}
+}
+
+// TestAnalyzeTagsFileName tests that the file name is checked against the deposit and the header.
+func TestAnalyzeTagsFileName(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected []string
+	}{
+		{"test_2019-10-17_FULL_S1_R0.xml", nil},
+		{"test_2019-10-17_DIFF_S1_R0.xml", []string{RULE_FILE_NAME_TYPE_MISMATCH}},
+		{"test_2019-10-17_FULL_S1_R1.xml", []string{RULE_FILE_NAME_RESEND_MISMATCH}},
+		{"test_2019-10-18_FULL_S1_R0.xml", []string{RULE_FILE_NAME_DATE_MISMATCH}},
+		{"other_2019-10-16_DIFF_S1_R2.xml", []string{RULE_FILE_NAME_TYPE_MISMATCH, RULE_FILE_NAME_RESEND_MISMATCH, RULE_FILE_NAME_DATE_MISMATCH, RULE_FILE_NAME_TLD_MISMATCH}},
+		{"deposit.xml", []string{RULE_FILE_NAME_INVALID}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), test.name)
+			if err := os.WriteFile(filename, []byte(getValidFullDepositXMLString()), 0666); err != nil {
+				t.Fatalf("Failed to write deposit: %v", err)
+			}
+			a, err := NewXMLAnalyzer(filename)
+			if err != nil {
+				t.Fatalf("NewXMLAnalyzer returned an error: %v", err)
+			}
+			a.CheckFileName = true
+			if err := a.AnalyzeTags(); err != nil {
+				t.Fatalf("AnalyzeTags failed with error: %v", err)
+			}
+			var got []string
+			for _, f := range a.Findings {
+				if f.RuleID != RULE_HEADER_COUNT_MISMATCH {
+					got = append(got, f.RuleID)
+				}
+			}
+			if len(got) != len(test.expected) {
+				t.Fatalf("Expected findings %v, got %v", test.expected, a.Findings)
+			}
+			for i := range got {
+				if got[i] != test.expected[i] {
+					t.Errorf("Expected findings %v, got %v", test.expected, got)
+				}
+			}
+		})
+	}
+}
+
+// TestAnalyzeTagsFileNameNotChecked tests that the file name is only checked when asked for, and never for streams.
+func TestAnalyzeTagsFileNameNotChecked(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "deposit.xml")
+	if err := os.WriteFile(filename, []byte(getValidFullDepositXMLString()), 0666); err != nil {
+		t.Fatalf("Failed to write deposit: %v", err)
+	}
+	a, err := NewXMLAnalyzer(filename)
+	if err != nil {
+		t.Fatalf("NewXMLAnalyzer returned an error: %v", err)
+	}
+	if err := a.AnalyzeTags(); err != nil {
+		t.Fatalf("AnalyzeTags failed with error: %v", err)
+	}
+	if len(a.Findings) != 0 {
+		t.Errorf("Expected no findings without CheckFileName, got %v", a.Findings)
+	}
+
+	a, err = NewXMLAnalyzerFromReader(strings.NewReader(getValidFullDepositXMLString()), filepath.Join(t.TempDir(), "out"), 0)
+	if err != nil {
+		t.Fatalf("NewXMLAnalyzerFromReader returned an error: %v", err)
+	}
+	a.CheckFileName = true
+	if err := a.AnalyzeTags(); err != nil {
+		t.Fatalf("AnalyzeTags failed with error: %v", err)
+	}
+	if len(a.Findings) != 0 {
+		t.Errorf("Expected no findings for a stream, got %v", a.Findings)
+	}
+}
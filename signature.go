@@ -0,0 +1,142 @@
+package ryde
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// SignatureResult holds the result of verifying the detached OpenPGP signature of a deposit.
+type SignatureResult struct {
+	SignatureFile string    `json:"signatureFile"`         // The name of the detached signature file.
+	KeyID         string    `json:"keyId"`                 // The ID of the key that made the signature.
+	Fingerprint   string    `json:"fingerprint,omitempty"` // The fingerprint of the key that made the signature, if it is in the keyring.
+	Time          time.Time `json:"time"`                  // The time the signature was made.
+	Valid         bool      `json:"valid"`                 // Whether the signature is valid for the deposit.
+	Error         string    `json:"error,omitempty"`       // Why the signature is not valid.
+}
+
+// Returned by the reader the signature is verified from once the verification has finished, so writes to it do not block.
+var errSignatureVerified = errors.New("signature verified")
+
+// signatureVerifier is an io.Reader that verifies a detached signature over the bytes read from r.
+// The bytes are passed to openpgp.VerifyDetachedSignature through a pipe, so the deposit is verified in the same pass that analyzes it.
+type signatureVerifier struct {
+	r      io.Reader
+	pw     *io.PipeWriter
+	done   chan struct{}
+	sig    *packet.Signature
+	signer *openpgp.Entity
+	err    error
+}
+
+// Starts verifying the detached signature read from signature over the bytes read from r with the public keys in keyring.
+func newSignatureVerifier(r io.Reader, keyring openpgp.KeyRing, signature io.Reader) *signatureVerifier {
+	pr, pw := io.Pipe()
+	v := &signatureVerifier{r: r, pw: pw, done: make(chan struct{})}
+	go func() {
+		defer close(v.done)
+		v.sig, v.signer, v.err = openpgp.VerifyDetachedSignature(keyring, pr, signature, nil)
+		pr.CloseWithError(errSignatureVerified)
+	}()
+	return v
+}
+
+func (v *signatureVerifier) Read(p []byte) (int, error) {
+	n, err := v.r.Read(p)
+	if n > 0 {
+		// The verification can finish before all bytes are read, e.g. when the signer is unknown, the result is known by then so we ignore the error
+		v.pw.Write(p[:n])
+	}
+	return n, err
+}
+
+// Reads the rest of r and returns the signature and the entity that made it once the verification has finished.
+func (v *signatureVerifier) finish() (*packet.Signature, *openpgp.Entity, error) {
+	if _, err := io.Copy(io.Discard, v); err != nil {
+		v.pw.CloseWithError(err)
+		<-v.done
+		return nil, nil, err
+	}
+	v.pw.Close()
+	<-v.done
+	return v.sig, v.signer, v.err
+}
+
+// Aborts the verification, e.g. when the analysis failed before the deposit was read entirely.
+func (v *signatureVerifier) abort() {
+	v.pw.CloseWithError(io.ErrUnexpectedEOF)
+	<-v.done
+}
+
+// Reads the detached signature from a.SignatureFile, armored or binary, and returns its binary packets.
+func (a *XMLAnalyzer) readSignatureFile() ([]byte, error) {
+	data, err := os.ReadFile(a.SignatureFile)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, []byte("-----BEGIN")) {
+		return data, nil
+	}
+	block, err := armor.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding armored signature: %s", err)
+	}
+	return io.ReadAll(block.Body)
+}
+
+// Wraps the XML reader so the detached signature in a.SignatureFile is verified over the raw bytes of the deposit as they are read.
+// The reader is returned as is if no signature file is configured.
+func (a *XMLAnalyzer) verifyingXMLReader(r io.Reader) (io.Reader, error) {
+	if a.SignatureFile == "" {
+		return r, nil
+	}
+	if len(a.VerificationKeyring) == 0 {
+		return nil, ErrNoVerificationKeyring
+	}
+	signature, err := a.readSignatureFile()
+	if err != nil {
+		return nil, err
+	}
+	// Save the signer and time of the signature up front, so we can report them even if the signature turns out to be invalid
+	a.Signature = &SignatureResult{SignatureFile: a.SignatureFile}
+	p, err := packet.Read(bytes.NewReader(signature))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSignature, err)
+	}
+	sig, ok := p.(*packet.Signature)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s does not contain a signature", ErrInvalidSignature, a.SignatureFile)
+	}
+	a.Signature.Time = sig.CreationTime
+	if sig.IssuerKeyId != nil {
+		a.Signature.KeyID = fmt.Sprintf("%016X", *sig.IssuerKeyId)
+	}
+	a.XMLFile.verifier = newSignatureVerifier(r, a.VerificationKeyring, bytes.NewReader(signature))
+	return a.XMLFile.verifier, nil
+}
+
+// Finishes the signature verification by reading the rest of the deposit, records the result in a.Signature and returns ErrInvalidSignature if the signature is not valid.
+func (a *XMLAnalyzer) verifySignature() error {
+	if a.XMLFile.verifier == nil {
+		return nil
+	}
+	_, signer, err := a.XMLFile.verifier.finish()
+	a.XMLFile.verifier = nil
+	if signer != nil {
+		a.Signature.Fingerprint = fmt.Sprintf("%X", signer.PrimaryKey.Fingerprint)
+	}
+	if err != nil {
+		a.Signature.Error = err.Error()
+		return fmt.Errorf("%w: %s", ErrInvalidSignature, err)
+	}
+	a.Signature.Valid = true
+	return nil
+}
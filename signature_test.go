@@ -0,0 +1,82 @@
+package ryde
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+)
+
+// TestAnalyzeTagsSignature tests that the detached signature of a deposit is verified while it is analyzed.
+func TestAnalyzeTagsSignature(t *testing.T) {
+	signer := createTestEntity(t)
+	other := createTestEntity(t)
+	deposit := []byte(getValidFullDepositXMLString())
+
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "test_2019-10-17_FULL_S1_R0.xml")
+	os.WriteFile(filename, deposit, 0666)
+
+	var binarySig, armoredSig bytes.Buffer
+	if err := openpgp.DetachSign(&binarySig, signer, bytes.NewReader(deposit), nil); err != nil {
+		t.Fatalf("Failed to sign deposit: %v", err)
+	}
+	if err := openpgp.ArmoredDetachSign(&armoredSig, signer, bytes.NewReader(deposit), nil); err != nil {
+		t.Fatalf("Failed to sign deposit: %v", err)
+	}
+	var tamperedSig bytes.Buffer
+	openpgp.DetachSign(&tamperedSig, signer, bytes.NewReader(append(deposit, ' ')), nil)
+
+	tests := []struct {
+		name      string
+		signature []byte
+		keyring   openpgp.EntityList
+		valid     bool
+	}{
+		{"binary", binarySig.Bytes(), openpgp.EntityList{signer}, true},
+		{"armored", armoredSig.Bytes(), openpgp.EntityList{other, signer}, true},
+		{"tampered", tamperedSig.Bytes(), openpgp.EntityList{signer}, false},
+		{"unknown signer", binarySig.Bytes(), openpgp.EntityList{other}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sigFile := filepath.Join(dir, "test_2019-10-17_FULL_S1_R0.sig")
+			os.WriteFile(sigFile, test.signature, 0666)
+
+			a, err := NewXMLAnalyzer(filename)
+			if err != nil {
+				t.Fatalf("NewXMLAnalyzer returned an error: %v", err)
+			}
+			a.SignatureFile = sigFile
+			a.VerificationKeyring = test.keyring
+			err = a.AnalyzeTags()
+			if test.valid && err != nil {
+				t.Fatalf("AnalyzeTags failed with error: %v", err)
+			}
+			if !test.valid && !errors.Is(err, ErrInvalidSignature) {
+				t.Fatalf("Expected ErrInvalidSignature, got %v", err)
+			}
+			if a.Signature == nil || a.Signature.Valid != test.valid || a.Signature.KeyID != signer.PrimaryKey.KeyIdString() || a.Signature.Time.IsZero() {
+				t.Fatalf("Unexpected signature result %+v", a.Signature)
+			}
+			if test.valid && a.Signature.Fingerprint == "" {
+				t.Errorf("Expected the fingerprint of the signer, got %+v", a.Signature)
+			}
+		})
+	}
+}
+
+// TestAnalyzeTagsSignatureWithoutKeyring tests that a signature file without a keyring is rejected.
+func TestAnalyzeTagsSignatureWithoutKeyring(t *testing.T) {
+	a, err := NewXMLAnalyzerFromReader(bytes.NewReader([]byte(getValidFullDepositXMLString())), filepath.Join(t.TempDir(), "test"), 0)
+	if err != nil {
+		t.Fatalf("NewXMLAnalyzerFromReader returned an error: %v", err)
+	}
+	a.SignatureFile = "test.sig"
+	if err := a.AnalyzeTags(); !errors.Is(err, ErrNoVerificationKeyring) {
+		t.Fatalf("Expected ErrNoVerificationKeyring, got %v", err)
+	}
+}
@@ -0,0 +1,239 @@
+package ryde
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+// SplitDeposit is a deposit that is split across files with sequence numbers S1..Sn, that share a deposit ID.
+// The parts are analyzed one after the other as one logical deposit: every part writes its own output files,
+// contacts and hosts are tracked across all parts and the header counts are reconciled with the counters of all parts.
+// The result for the deposit as a whole is written to a SplitDepositReport next to the output of the first part.
+type SplitDeposit struct {
+	Parts          []*XMLAnalyzer       `json:"parts"`          // The analyzers for the parts, ordered by sequence number. Configure them before calling Analyze.
+	Deposit        XMLDepositUnMarshall `json:"deposit"`        // The deposit info, which is the same for all parts.
+	Header         XMLHeaderUnMarshall  `json:"header"`         // The header of the deposit, found in one or more of the parts.
+	Counters       map[string]int       `json:"counters"`       // The counters of all parts added up.
+	Reconciliation []HeaderCountResult  `json:"reconciliation"` // The header counts compared with the counters of all parts.
+	Findings       []Finding            `json:"findings"`       // The findings of all parts and of the checks on the deposit as a whole.
+	Report         *SplitDepositReport  `json:"report"`         // The report of the deposit as a whole, set by Analyze when all parts were analyzed.
+}
+
+// SplitDepositReport is the report of a split deposit as a whole, written as JSON to the file with SPLIT_DEPOSIT_FILE_SUFFIX next to the output of
+// the first part. The findings are also written as SARIF to the file with SPLIT_DEPOSIT_SARIF_SUFFIX. Every part has its own analysis report.
+type SplitDepositReport struct {
+	Tool           ReportTool           `json:"tool"`
+	Parts          []string             `json:"parts"` // The file names of the parts, ordered by sequence number.
+	Deposit        XMLDepositUnMarshall `json:"deposit"`
+	Header         XMLHeaderUnMarshall  `json:"header"`
+	Counters       map[string]int       `json:"counters"`       // The counters of all parts added up.
+	Reconciliation []HeaderCountResult  `json:"reconciliation"` // The header counts compared with the counters of all parts, empty if no part has a header.
+	Findings       []Finding            `json:"findings"`       // The findings of the checks on the deposit as a whole, the findings of a part are in its own output.
+}
+
+// Keeps track of the state that is shared by the parts of a split deposit.
+type splitPart struct {
+	references *objectReferences // The contacts and hosts, and references to them, of all parts analyzed so far.
+	last       bool              // Whether this is the last part, which reports the unique contact IDs and orphans of the whole deposit.
+	first      *XMLAnalyzer      // The first part, nil when analyzing the first part. The other parts must have the same deposit ID, type and watermark.
+	headerPart *XMLAnalyzer      // The first part with a header, nil if none of the parts before had one. The other headers must be the same.
+	checked    bool              // Whether the deposit of this part has been checked against the first part.
+}
+
+// NewSplitDeposit creates a SplitDeposit for the given files, which must be named following the RyDE naming convention.
+// It returns an error if the files are not the parts S1..Sn of the same deposit.
+func NewSplitDeposit(filenames ...string) (*SplitDeposit, error) {
+	return NewSplitDepositFS(OSFS{}, filenames...)
+}
+
+// NewSplitDepositFS creates a SplitDeposit for the given files in fsys, which must be named following the RyDE naming convention.
+// It returns an error if the files are not the parts S1..Sn of the same deposit.
+func NewSplitDepositFS(fsys fs.FS, filenames ...string) (*SplitDeposit, error) {
+	if len(filenames) == 0 {
+		return nil, ErrIncompleteSplitDeposit
+	}
+	names := make([]RyDEFileName, len(filenames))
+	for i, filename := range filenames {
+		name, err := ParseRyDEFileName(filename)
+		if err != nil {
+			return nil, err
+		}
+		names[i] = name
+	}
+	// Order the files by sequence number
+	order := make([]int, len(filenames))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return names[order[i]].Sequence < names[order[j]].Sequence })
+
+	first := names[order[0]]
+	s := &SplitDeposit{}
+	for i, idx := range order {
+		name := names[idx]
+		if name.TLD != first.TLD || !name.Date.Equal(first.Date) || name.Type != first.Type || name.Resend != first.Resend {
+			return nil, fmt.Errorf("%w: %s and %s are not parts of the same deposit", ErrSplitDepositMismatch, filenames[order[0]], filenames[idx])
+		}
+		if name.Sequence != i+1 {
+			return nil, fmt.Errorf("%w: expected part S%d, got %s", ErrIncompleteSplitDeposit, i+1, filenames[idx])
+		}
+		a, err := NewXMLAnalyzerFS(fsys, filenames[idx])
+		if err != nil {
+			return nil, err
+		}
+		s.Parts = append(s.Parts, a)
+	}
+	return s, nil
+}
+
+// Analyze analyzes all parts in order, aggregates their counters and findings and writes the SplitDepositReport.
+// It returns ErrSplitDepositMismatch if a part does not have the same deposit ID, type and watermark as the first part.
+func (s *SplitDeposit) Analyze() error {
+	shared := newObjectReferences()
+	s.Counters = make(map[string]int)
+	s.Findings = nil
+	s.Reconciliation = nil
+	s.Report = nil
+	if len(s.Parts) == 0 {
+		return ErrIncompleteSplitDeposit
+	}
+	// Like the analysis report of a part, the report of an earlier analysis is only replaced if the overwrite policy allows it
+	if first := s.Parts[0]; first.Overwrite == OVERWRITE_FAIL && outputExists(first.baseOutputFS(), first.GetBaseXMLFileName()+SPLIT_DEPOSIT_FILE_SUFFIX) {
+		return fmt.Errorf("%w: %s", ErrOutputExists, first.GetBaseXMLFileName()+SPLIT_DEPOSIT_FILE_SUFFIX)
+	}
+	var first, headerPart *XMLAnalyzer
+	quarantined := make(map[string]int)
+	for i, a := range s.Parts {
+		log.Printf("Analyzing part %d of %d\n", i+1, len(s.Parts))
+		// The parts are checked against the parts before them while they are analyzed, so a part of another deposit fails before its output is written
+		a.part = &splitPart{references: shared, last: i == len(s.Parts)-1, first: first, headerPart: headerPart}
+		err := a.AnalyzeTags()
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			first = a
+			s.Deposit = a.Deposit
+		}
+		if a.Header.TLD != "" && headerPart == nil {
+			headerPart = a
+		}
+		for k, v := range a.Counters {
+			s.Counters[k] += v
+		}
+		for k, v := range a.quarantinedObjects {
+			quarantined[k] += v
+		}
+		s.Findings = append(s.Findings, a.Findings...)
+	}
+	whole := &XMLAnalyzer{Deposit: s.Deposit, Counters: s.Counters, quarantinedObjects: quarantined}
+	if headerPart != nil {
+		s.Header = headerPart.Header
+		// Reconcile the header counts with the objects in all parts, the position points to the header in the part it was found in
+		whole.Header = s.Header
+		whole.headerPosition = headerPart.headerPosition
+		whole.XMLFile = headerPart.XMLFile
+		whole.reconcileHeaderCounts()
+		s.Reconciliation = whole.headerCountResults()
+		s.Findings = append(s.Findings, whole.Findings...)
+	}
+	return s.writeReport(whole)
+}
+
+// Writes the SplitDepositReport and the SARIF log of its findings next to the output of the first part.
+// whole is the analyzer of the deposit as a whole, with the findings of the checks on the deposit as a whole.
+func (s *SplitDeposit) writeReport(whole *XMLAnalyzer) error {
+	report := &SplitDepositReport{
+		Tool:           ReportTool{"ryde", ToolVersion()},
+		Parts:          []string{},
+		Deposit:        s.Deposit,
+		Header:         s.Header,
+		Counters:       s.Counters,
+		Reconciliation: s.Reconciliation,
+		Findings:       whole.Findings,
+	}
+	for _, a := range s.Parts {
+		report.Parts = append(report.Parts, a.XMLFile.FileName)
+	}
+	if report.Reconciliation == nil {
+		report.Reconciliation = []HeaderCountResult{}
+	}
+	if report.Findings == nil {
+		report.Findings = []Finding{}
+	}
+	s.Report = report
+
+	first := s.Parts[0]
+	base := first.GetBaseXMLFileName()
+	err := writeSplitDepositFile(first, base+SPLIT_DEPOSIT_FILE_SUFFIX, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	})
+	if err != nil {
+		return err
+	}
+	return writeSplitDepositFile(first, base+SPLIT_DEPOSIT_SARIF_SUFFIX, whole.WriteFindingsSARIF)
+}
+
+// Writes a file of the split deposit with write to the output filesystem of the first part a, following its overwrite policy.
+func writeSplitDepositFile(a *XMLAnalyzer, name string, write func(io.Writer) error) error {
+	flag := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if a.Overwrite == OVERWRITE_FAIL {
+		flag |= os.O_EXCL
+	}
+	file, err := a.baseOutputFS().OpenFile(name, flag, 0666)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	err = write(file)
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// Checks that a part of a split deposit has the same deposit ID, type and watermark as the first part.
+// This is done once, before the first object of the part is written, or at the end of a part without objects.
+func (a *XMLAnalyzer) checkSplitPart() error {
+	if a.part == nil || a.part.first == nil || a.part.checked {
+		return nil
+	}
+	a.part.checked = true
+	first := a.part.first.Deposit
+	if a.Deposit.ID != first.ID || !strings.EqualFold(a.Deposit.Type, first.Type) || a.Deposit.Watermark != first.Watermark {
+		return fmt.Errorf("%w: %s has deposit %s %s %s, expected %s %s %s", ErrSplitDepositMismatch, a.XMLFile.FileName, a.Deposit.ID, a.Deposit.Type, a.Deposit.Watermark, first.ID, first.Type, first.Watermark)
+	}
+	return nil
+}
+
+// Checks that the header of a part of a split deposit is the same as the header of the parts before it, as soon as it is read.
+func (a *XMLAnalyzer) checkSplitHeader() error {
+	if a.part == nil || a.part.headerPart == nil {
+		return nil
+	}
+	if !headersEqual(a.Header, a.part.headerPart.Header) {
+		return fmt.Errorf("%w: %s and %s have different headers", ErrSplitDepositMismatch, a.part.headerPart.XMLFile.FileName, a.XMLFile.FileName)
+	}
+	return nil
+}
+
+// Checks if two headers have the same TLD and counts.
+func headersEqual(a, b XMLHeaderUnMarshall) bool {
+	if a.TLD != b.TLD || a.Registrar != b.Registrar || a.PPSP != b.PPSP || len(a.Count) != len(b.Count) {
+		return false
+	}
+	for i := range a.Count {
+		if a.Count[i] != b.Count[i] {
+			return false
+		}
+	}
+	return true
+}
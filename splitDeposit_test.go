@@ -0,0 +1,222 @@
+package ryde
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// Splits the valid test deposit in two parts: the header and domains, and the other objects.
+func createSplitDepositTestFS(names ...string) fstest.MapFS {
+	xmlString := getValidFullDepositXMLString()
+	header := strings.Index(xmlString, "<rdeHeader:header>")
+	hosts := strings.Index(xmlString, "<rdeHost:host>")
+	end := strings.Index(xmlString, "</rde:contents>")
+	parts := []string{
+		xmlString[:hosts] + xmlString[end:],
+		xmlString[:header] + xmlString[hosts:],
+	}
+	fsys := fstest.MapFS{}
+	for i, name := range names {
+		fsys[name] = &fstest.MapFile{Data: []byte(parts[i%len(parts)])}
+	}
+	return fsys
+}
+
+// TestSplitDeposit tests that the parts of a split deposit are analyzed as one deposit.
+func TestSplitDeposit(t *testing.T) {
+	names := []string{"test_2019-10-17_FULL_S2_R0.xml", "test_2019-10-17_FULL_S1_R0.xml"}
+	fsys := createSplitDepositTestFS(names[1], names[0])
+	s, err := NewSplitDepositFS(fsys, names...)
+	if err != nil {
+		t.Fatalf("NewSplitDepositFS returned an error: %v", err)
+	}
+	if s.Parts[0].XMLFile.FileName != names[1] || s.Parts[1].XMLFile.FileName != names[0] {
+		t.Fatalf("Expected the parts to be ordered by sequence number")
+	}
+	for _, part := range s.Parts {
+		part.OutputFS = NewMemFS()
+	}
+	if err := s.Analyze(); err != nil {
+		t.Fatalf("Analyze failed with error: %v", err)
+	}
+	if s.Deposit.ID != "20191017001" || s.Header.TLD != "test" {
+		t.Errorf("Unexpected deposit %v and header %v", s.Deposit, s.Header)
+	}
+	if s.Counters["domain"] != 2 || s.Counters["host"] != 1 || s.Counters["contact"] != 1 || s.Counters["orphanContact"] != 0 || s.Counters["orphanHost"] != 0 {
+		t.Errorf("Unexpected counters %v", s.Counters)
+	}
+	if s.Parts[0].Counters["domain"] != 2 || s.Parts[1].Counters["domain"] != 0 {
+		t.Errorf("Expected the domains to be counted in the first part, got %v and %v", s.Parts[0].Counters, s.Parts[1].Counters)
+	}
+	for _, f := range s.Findings {
+		if f.RuleID == RULE_HEADER_COUNT_MISMATCH {
+			t.Errorf("Unexpected finding %v", f)
+		}
+	}
+}
+
+// TestSplitDepositReport tests that a header count that does not match the objects in all parts ends up in the report of the deposit as a whole.
+func TestSplitDepositReport(t *testing.T) {
+	names := []string{"test_2019-10-17_FULL_S1_R0.xml", "test_2019-10-17_FULL_S2_R0.xml"}
+	fsys := createSplitDepositTestFS(names...)
+	fsys[names[0]].Data = []byte(strings.Replace(string(fsys[names[0]].Data), `rdeHost-1.0">1`, `rdeHost-1.0">2`, 1))
+	s, err := NewSplitDepositFS(fsys, names...)
+	if err != nil {
+		t.Fatalf("NewSplitDepositFS returned an error: %v", err)
+	}
+	out := NewMemFS()
+	for _, part := range s.Parts {
+		part.OutputFS = out
+		part.Overwrite = OVERWRITE_FAIL
+	}
+	if err := s.Analyze(); err != nil {
+		t.Fatalf("Analyze failed with error: %v", err)
+	}
+
+	data, err := out.ReadFile("test_2019-10-17_FULL_S1_R0" + SPLIT_DEPOSIT_FILE_SUFFIX)
+	if err != nil {
+		t.Fatalf("Failed to read the deposit report: %v", err)
+	}
+	var report SplitDepositReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatalf("Failed to decode the deposit report: %v", err)
+	}
+	if len(report.Parts) != 2 || report.Parts[1] != names[1] || report.Deposit.ID != "20191017001" || report.Counters["host"] != 1 || report.Counters["domain"] != 2 {
+		t.Errorf("Unexpected deposit report %+v", report)
+	}
+	if len(report.Findings) != 1 || report.Findings[0].RuleID != RULE_HEADER_COUNT_MISMATCH || report.Findings[0].Message != "header count for host is 2, but the deposit contains 1" {
+		t.Errorf("Expected the host count mismatch in the deposit report, got %v", report.Findings)
+	}
+	for _, result := range report.Reconciliation {
+		if result.Match != (result.Object != "host") {
+			t.Errorf("Unexpected reconciliation %+v", result)
+		}
+	}
+	// The parts leave the reconciliation to the deposit report
+	for _, part := range s.Parts {
+		if len(part.Report.Reconciliation) != 0 {
+			t.Errorf("Expected no reconciliation in the report of %s, got %v", part.XMLFile.FileName, part.Report.Reconciliation)
+		}
+	}
+
+	data, err = out.ReadFile("test_2019-10-17_FULL_S1_R0" + SPLIT_DEPOSIT_SARIF_SUFFIX)
+	if err != nil {
+		t.Fatalf("Failed to read the deposit SARIF log: %v", err)
+	}
+	var sarif sarifLog
+	if err := json.Unmarshal(data, &sarif); err != nil {
+		t.Fatalf("Failed to decode the deposit SARIF log: %v", err)
+	}
+	if results := sarif.Runs[0].Results; len(results) != 1 || results[0].RuleID != RULE_HEADER_COUNT_MISMATCH || results[0].Locations[0].PhysicalLocation.ArtifactLocation.URI != names[0] {
+		t.Errorf("Expected the host count mismatch in the header of the first part, got %+v", results)
+	}
+
+	// The report of an earlier analysis is not replaced with OVERWRITE_FAIL
+	s, _ = NewSplitDepositFS(fsys, names...)
+	for _, part := range s.Parts {
+		part.OutputFS = out
+		part.Overwrite = OVERWRITE_FAIL
+	}
+	if err := s.Analyze(); !errors.Is(err, ErrOutputExists) {
+		t.Errorf("Expected ErrOutputExists, got %v", err)
+	}
+}
+
+// TestSplitDepositErrors tests that incomplete and mismatched split deposits are rejected.
+func TestSplitDepositErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    []string
+		expected error
+	}{
+		{"no files", nil, ErrIncompleteSplitDeposit},
+		{"missing S1", []string{"test_2019-10-17_FULL_S2_R0.xml"}, ErrIncompleteSplitDeposit},
+		{"gap", []string{"test_2019-10-17_FULL_S1_R0.xml", "test_2019-10-17_FULL_S3_R0.xml"}, ErrIncompleteSplitDeposit},
+		{"duplicate", []string{"test_2019-10-17_FULL_S1_R0.xml", "test_2019-10-17_FULL_S1_R0.xml.gz"}, ErrIncompleteSplitDeposit},
+		{"other date", []string{"test_2019-10-17_FULL_S1_R0.xml", "test_2019-10-18_FULL_S2_R0.xml"}, ErrSplitDepositMismatch},
+		{"other type", []string{"test_2019-10-17_FULL_S1_R0.xml", "test_2019-10-17_DIFF_S2_R0.xml"}, ErrSplitDepositMismatch},
+		{"invalid name", []string{"deposit.xml"}, ErrInvalidRyDEFileName},
+	}
+	for _, test := range tests {
+		_, err := NewSplitDepositFS(createSplitDepositTestFS(test.files...), test.files...)
+		if !errors.Is(err, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, err)
+		}
+	}
+}
+
+// TestSplitDepositDifferentDeposits tests that parts with a different deposit ID are rejected.
+func TestSplitDepositDifferentDeposits(t *testing.T) {
+	names := []string{"test_2019-10-17_FULL_S1_R0.xml", "test_2019-10-17_FULL_S2_R0.xml"}
+	fsys := createSplitDepositTestFS(names...)
+	fsys[names[1]].Data = []byte(strings.Replace(string(fsys[names[1]].Data), `id="20191017001"`, `id="20191017002"`, 1))
+	s, err := NewSplitDepositFS(fsys, names...)
+	if err != nil {
+		t.Fatalf("NewSplitDepositFS returned an error: %v", err)
+	}
+	out := NewMemFS()
+	for _, part := range s.Parts {
+		part.OutputFS = out
+	}
+	if err := s.Analyze(); !errors.Is(err, ErrSplitDepositMismatch) {
+		t.Fatalf("Expected ErrSplitDepositMismatch, got %v", err)
+	}
+	// The part is rejected before its objects are written, so only the report with the error is left of it
+	for _, name := range out.Names() {
+		if strings.HasPrefix(name, "test_2019-10-17_FULL_S2_R0") && name != "test_2019-10-17_FULL_S2_R0"+ANALYSYS_FILE_SUFFIX {
+			t.Errorf("Unexpected output %s of the rejected part", name)
+		}
+	}
+}
+
+// TestSplitDepositUniqueContactIDs tests that contacts referenced in several parts are counted and written once, by the last part.
+func TestSplitDepositUniqueContactIDs(t *testing.T) {
+	xmlString := getValidFullDepositXMLString()
+	domains := xmlString[:strings.Index(xmlString, "<rdeHost:host>")] + xmlString[strings.Index(xmlString, "</rde:contents>"):]
+	names := []string{"test_2019-10-17_FULL_S1_R0.xml", "test_2019-10-17_FULL_S2_R0.xml"}
+	fsys := fstest.MapFS{names[0]: {Data: []byte(domains)}, names[1]: {Data: []byte(domains)}}
+	s, err := NewSplitDepositFS(fsys, names...)
+	if err != nil {
+		t.Fatalf("NewSplitDepositFS returned an error: %v", err)
+	}
+	out := NewMemFS()
+	for _, part := range s.Parts {
+		part.OutputFS = out
+	}
+	if err := s.Analyze(); err != nil {
+		t.Fatalf("Analyze failed with error: %v", err)
+	}
+	if s.Counters["uniqueContactIDs"] != 1 || s.Parts[0].Counters["uniqueContactIDs"] != 0 {
+		t.Errorf("Expected 1 unique contact ID, counted by the last part, got %v and %v", s.Counters, s.Parts[0].Counters)
+	}
+	if data, err := out.ReadFile("test_2019-10-17_FULL_S1_R0" + UNIQUE_CONTACT_ID_FILE_SUFFIX); err == nil && len(data) > 0 {
+		t.Errorf("Expected no unique contact IDs in the first part, got %q", data)
+	}
+	if data, _ := out.ReadFile("test_2019-10-17_FULL_S2_R0" + UNIQUE_CONTACT_ID_FILE_SUFFIX); strings.Count(string(data), "\n") != 1 {
+		t.Errorf("Expected 1 unique contact ID in the last part, got %q", data)
+	}
+}
+
+// TestSplitDepositFileNames tests that the file names of the parts are checked without a TLD mismatch for the parts without a header.
+func TestSplitDepositFileNames(t *testing.T) {
+	names := []string{"test_2019-10-17_FULL_S1_R0.xml", "test_2019-10-17_FULL_S2_R0.xml"}
+	s, err := NewSplitDepositFS(createSplitDepositTestFS(names...), names...)
+	if err != nil {
+		t.Fatalf("NewSplitDepositFS returned an error: %v", err)
+	}
+	for _, part := range s.Parts {
+		part.OutputFS = NewMemFS()
+		part.CheckFileName = true
+	}
+	if err := s.Analyze(); err != nil {
+		t.Fatalf("Analyze failed with error: %v", err)
+	}
+	for _, f := range s.Findings {
+		if f.RuleID != RULE_HEADER_COUNT_MISMATCH {
+			t.Errorf("Unexpected finding %v", f)
+		}
+	}
+}
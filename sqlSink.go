@@ -0,0 +1,328 @@
+package ryde
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	SQL_DIALECT_POSTGRES = "postgres"
+	SQL_DIALECT_SQLITE   = "sqlite"
+	SQL_FILE_SUFFIX      = ".sql"
+	SQL_INSERT_BATCH     = 500           // The number of rows in a SQLite INSERT statement
+	SQL_SPOOL_PREFIX     = ".sql-spool-" // The prefix of the spool files in the staging directory
+)
+
+// SQLSink writes the records to one self-contained SQL file, named after the XML file with SQL_FILE_SUFFIX, that psql or sqlite3 can replay.
+// The file starts with the CREATE TABLE statements for every record type in RecordSchemas, with their primary and foreign keys,
+// followed by a PostgreSQL COPY block or batched SQLite INSERT statements per table, all in one transaction.
+// The tables are created and filled in the order of their foreign keys, so referenced rows are loaded first. DIFF deposits get no foreign keys,
+// because the referenced objects may not be in the deposit. Empty values are NULL and dates that are not valid RFC 3339 too.
+// Because all rows of a table have to be written together, they are spooled to files in the staging directory of the output filesystem
+// until the analysis ends. If the output filesystem is not a StagingFS they are held in memory.
+type SQLSink struct {
+	Dialect string // SQL_DIALECT_POSTGRES or SQL_DIALECT_SQLITE
+
+	spools map[string]*sqlSpool
+}
+
+// The rows of a table, encoded for the dialect, in a spool file in the staging directory or in memory.
+type sqlSpool struct {
+	name string        // The name of the spool file in the output filesystem, empty if the rows are in buf.
+	file WritableFile  // The spool file, nil if the rows are in buf.
+	buf  *bytes.Buffer // The rows, if there is no staging directory.
+	w    *bufio.Writer
+	rows int
+}
+
+// Begin checks the dialect and creates a spool file per table.
+func (s *SQLSink) Begin(a *XMLAnalyzer) error {
+	if s.Dialect != SQL_DIALECT_POSTGRES && s.Dialect != SQL_DIALECT_SQLITE {
+		return fmt.Errorf("%w: %q", ErrUnsupportedSQLDialect, s.Dialect)
+	}
+	s.spools = map[string]*sqlSpool{}
+	for recordType := range RecordSchemas {
+		if a.stagingDir == "" {
+			buf := &bytes.Buffer{}
+			s.spools[recordType] = &sqlSpool{buf: buf, w: bufio.NewWriter(buf)}
+			continue
+		}
+		// The spool files are not output files, so they are written to the staging directory without tracking them
+		name := filepath.Join(a.stagingDir, SQL_SPOOL_PREFIX+recordType+SQL_FILE_SUFFIX)
+		f, err := a.baseOutputFS().OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+		if err != nil {
+			s.removeSpools(a)
+			return err
+		}
+		s.spools[recordType] = &sqlSpool{name: name, file: f, w: bufio.NewWriter(f)}
+	}
+	return nil
+}
+
+// WriteRecord encodes the record and appends it to the spool of its table.
+func (s *SQLSink) WriteRecord(r Record) error {
+	spool, ok := s.spools[r.RecordType()]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownRecordType, r.RecordType())
+	}
+	schema := RecordSchemas[r.RecordType()]
+	values := r.Values()
+	var err error
+	if s.Dialect == SQL_DIALECT_POSTGRES {
+		_, err = io.WriteString(spool.w, postgresCopyRow(schema, values))
+	} else {
+		// Every SQL_INSERT_BATCH rows start a new INSERT statement
+		sep := ",\n"
+		if spool.rows%SQL_INSERT_BATCH == 0 {
+			sep = ";\n" + sqlInsert(r.RecordType(), schema)
+			if spool.rows == 0 {
+				sep = sqlInsert(r.RecordType(), schema)
+			}
+		}
+		_, err = io.WriteString(spool.w, sep+sqliteValues(schema, values))
+	}
+	spool.rows++
+	return err
+}
+
+// End writes the SQL file: the DDL followed by the spooled rows of every table. The spool files are removed.
+func (s *SQLSink) End(a *XMLAnalyzer) error {
+	defer s.removeSpools(a)
+	for _, spool := range s.spools {
+		if err := spool.w.Flush(); err != nil {
+			return err
+		}
+		if spool.file != nil {
+			err := spool.file.Close()
+			spool.file = nil
+			if err != nil {
+				return err
+			}
+		}
+	}
+	file, err := a.outputFS().OpenFile(a.GetBaseXMLFileName()+SQL_FILE_SUFFIX, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	w := bufio.NewWriter(file)
+
+	fmt.Fprintf(w, "-- RDE deposit %s (%s) with watermark %s\n", sqlComment(a.Deposit.ID), sqlComment(a.Deposit.Type), sqlComment(a.Deposit.Watermark))
+	if s.Dialect == SQL_DIALECT_POSTGRES {
+		fmt.Fprint(w, "SET client_encoding = 'UTF8';\n")
+	}
+	fmt.Fprint(w, "BEGIN;\n\n")
+	order := sqlTableOrder()
+	foreignKeys := !strings.EqualFold(a.Deposit.Type, "DIFF")
+	for _, recordType := range order {
+		fmt.Fprint(w, sqlCreateTable(s.Dialect, recordType, RecordSchemas[recordType], foreignKeys), "\n")
+	}
+	for _, recordType := range order {
+		spool := s.spools[recordType]
+		if spool.rows == 0 {
+			continue
+		}
+		if s.Dialect == SQL_DIALECT_POSTGRES {
+			fmt.Fprintf(w, "COPY %s (%s) FROM stdin;\n", sqlIdentifier(recordType), sqlColumnList(RecordSchemas[recordType]))
+		}
+		if err := spool.copyTo(w, a.baseOutputFS()); err != nil {
+			return err
+		}
+		if s.Dialect == SQL_DIALECT_POSTGRES {
+			fmt.Fprint(w, "\\.\n\n")
+		} else {
+			fmt.Fprint(w, ";\n\n")
+		}
+	}
+	fmt.Fprint(w, "COMMIT;\n")
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// Copies the spooled rows to w.
+func (spool *sqlSpool) copyTo(w io.Writer, fsys fs.FS) error {
+	if spool.buf != nil {
+		_, err := spool.buf.WriteTo(w)
+		return err
+	}
+	f, err := fsys.Open(spool.name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// Closes and removes the spool files.
+func (s *SQLSink) removeSpools(a *XMLAnalyzer) {
+	for _, spool := range s.spools {
+		if spool.file != nil {
+			spool.file.Close()
+		}
+		if spool.name != "" {
+			a.baseOutputFS().(StagingFS).RemoveAll(spool.name)
+		}
+	}
+	s.spools = nil
+}
+
+// Returns the record types in the order their tables have to be created and filled: a table comes after the tables its foreign keys reference.
+// Tables that do not depend on each other are sorted by name.
+func sqlTableOrder() []string {
+	var remaining []string
+	for recordType := range RecordSchemas {
+		remaining = append(remaining, recordType)
+	}
+	sort.Strings(remaining)
+	var order []string
+	done := map[string]bool{}
+	for len(remaining) > 0 {
+		var next []string
+		for _, recordType := range remaining {
+			ready := true
+			for _, fk := range RecordSchemas[recordType].ForeignKeys {
+				if fk.Reference != recordType && !done[fk.Reference] {
+					ready = false
+				}
+			}
+			if ready {
+				order = append(order, recordType)
+				done[recordType] = true
+			} else {
+				next = append(next, recordType)
+			}
+		}
+		if len(next) == len(remaining) {
+			// A cycle, which RecordSchemas does not have, the rest goes in by name
+			return append(order, next...)
+		}
+		remaining = next
+	}
+	return order
+}
+
+// Returns the CREATE TABLE statement of a record type.
+func sqlCreateTable(dialect, recordType string, schema RecordSchema, foreignKeys bool) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "CREATE TABLE %s (\n", sqlIdentifier(recordType))
+	var lines []string
+	for _, f := range schema.Fields {
+		line := "  " + sqlIdentifier(f.Name) + " " + sqlColumnType(dialect, f.Type)
+		if slices.Contains(schema.PrimaryKey, f.Name) {
+			line += " NOT NULL"
+		}
+		lines = append(lines, line)
+	}
+	if len(schema.PrimaryKey) > 0 {
+		lines = append(lines, "  PRIMARY KEY ("+sqlIdentifierList(schema.PrimaryKey)+")")
+	}
+	if foreignKeys {
+		for _, fk := range schema.ForeignKeys {
+			lines = append(lines, fmt.Sprintf("  FOREIGN KEY (%s) REFERENCES %s (%s)", sqlIdentifierList(fk.Fields), sqlIdentifier(fk.Reference), sqlIdentifierList(fk.ReferenceFields)))
+		}
+	}
+	b.WriteString(strings.Join(lines, ",\n"))
+	b.WriteString("\n);\n")
+	return b.String()
+}
+
+// Returns the column type for a RecordField type.
+func sqlColumnType(dialect, fieldType string) string {
+	switch fieldType {
+	case "integer":
+		return "INTEGER"
+	case "datetime":
+		if dialect == SQL_DIALECT_POSTGRES {
+			return "TIMESTAMPTZ"
+		}
+	}
+	return "TEXT"
+}
+
+// Returns the start of a SQLite INSERT statement for the table.
+func sqlInsert(recordType string, schema RecordSchema) string {
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES\n", sqlIdentifier(recordType), sqlColumnList(schema))
+}
+
+// Returns the quoted column names of the schema.
+func sqlColumnList(schema RecordSchema) string {
+	return sqlIdentifierList(schema.FieldNames())
+}
+
+func sqlIdentifierList(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = sqlIdentifier(name)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// Quotes an identifier, so names such as type keep their case and are not taken for keywords.
+func sqlIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// Keeps a value on one line of a comment.
+func sqlComment(s string) string {
+	return strings.NewReplacer("\n", " ", "\r", " ").Replace(s)
+}
+
+// Returns the value to store for a column, and false if it is NULL: empty values and dates that cannot be parsed.
+// Dates are normalized to RFC 3339 in UTC.
+func sqlValue(f RecordField, value string) (string, bool) {
+	if value == "" {
+		return "", false
+	}
+	if f.Type == "datetime" {
+		t := depositTime(value)
+		if t == nil {
+			return "", false
+		}
+		return t.Format(time.RFC3339Nano), true
+	}
+	return value, true
+}
+
+// Returns a row of a PostgreSQL COPY block in text format.
+func postgresCopyRow(schema RecordSchema, values []string) string {
+	escaper := strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+	fields := make([]string, len(values))
+	for i, value := range values {
+		v, ok := sqlValue(schema.Fields[i], value)
+		if !ok {
+			fields[i] = `\N`
+			continue
+		}
+		fields[i] = escaper.Replace(v)
+	}
+	return strings.Join(fields, "\t") + "\n"
+}
+
+// Returns a row of a SQLite INSERT statement.
+func sqliteValues(schema RecordSchema, values []string) string {
+	fields := make([]string, len(values))
+	for i, value := range values {
+		v, ok := sqlValue(schema.Fields[i], value)
+		switch {
+		case !ok:
+			fields[i] = "NULL"
+		case schema.Fields[i].Type == "integer":
+			fields[i] = v
+		default:
+			fields[i] = "'" + strings.ReplaceAll(v, "'", "''") + "'"
+		}
+	}
+	return "(" + strings.Join(fields, ", ") + ")"
+}
@@ -0,0 +1,144 @@
+package ryde
+
+import (
+	"errors"
+	"io/fs"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// Analyzes the valid deposit with an SQLSink and returns the SQL file.
+func analyzeToSQL(t *testing.T, dialect, depositType string) string {
+	t.Helper()
+	return analyzeToSQLFS(t, NewMemFS(), dialect, depositType)
+}
+
+// Analyzes the valid deposit with an SQLSink writing to out and returns the SQL file.
+func analyzeToSQLFS(t *testing.T, out WritableFS, dialect, depositType string) string {
+	t.Helper()
+	// The rows are spooled through the output filesystem, so temporary files on disk cannot be created
+	t.Setenv("TMPDIR", filepath.Join(t.TempDir(), "missing"))
+	xmlString := strings.Replace(getValidFullDepositXMLString(), `type="FULL"`, `type="`+depositType+`"`, 1)
+	fsys := fstest.MapFS{"test_2019-10-17_FULL_S1_R0.xml": &fstest.MapFile{Data: []byte(xmlString)}}
+	a, err := NewXMLAnalyzerFS(fsys, "test_2019-10-17_FULL_S1_R0.xml")
+	if err != nil {
+		t.Fatalf("NewXMLAnalyzerFS returned an error: %v", err)
+	}
+	a.OutputFS = out
+	a.Sinks = []OutputSink{&SQLSink{Dialect: dialect}}
+	if err := a.AnalyzeTags(); err != nil {
+		t.Fatalf("AnalyzeTags failed with error: %v", err)
+	}
+	names, err := fs.Glob(out, "*")
+	if err != nil {
+		t.Fatalf("Failed to list the output files: %v", err)
+	}
+	for _, name := range names {
+		if strings.HasPrefix(name, ".") {
+			t.Errorf("Expected the spool files and staging directory to be removed, found %s", name)
+		}
+	}
+	data, err := fs.ReadFile(out, "test_2019-10-17_FULL_S1_R0"+SQL_FILE_SUFFIX)
+	if err != nil {
+		t.Fatalf("Failed to read the SQL file: %v", err)
+	}
+	return string(data)
+}
+
+// An output filesystem that is not a StagingFS, so the output is written in place.
+type inPlaceFS struct {
+	WritableFS
+}
+
+// TestSQLSinkWithoutStaging tests that the rows are spooled in memory if the output filesystem has no staging directory.
+func TestSQLSinkWithoutStaging(t *testing.T) {
+	for _, dialect := range []string{SQL_DIALECT_POSTGRES, SQL_DIALECT_SQLITE} {
+		staged := analyzeToSQL(t, dialect, "FULL")
+		inPlace := analyzeToSQLFS(t, inPlaceFS{NewMemFS()}, dialect, "FULL")
+		if inPlace != staged {
+			t.Errorf("Expected the same %s SQL with and without staging, got:\n%s\nand:\n%s", dialect, staged, inPlace)
+		}
+	}
+}
+
+func TestSQLSinkPostgres(t *testing.T) {
+	sql := analyzeToSQL(t, SQL_DIALECT_POSTGRES, "FULL")
+	for _, expected := range []string{
+		"BEGIN;\n",
+		"CREATE TABLE \"domainStatus\" (\n  \"domain\" TEXT NOT NULL,\n  \"status\" TEXT NOT NULL,\n  PRIMARY KEY (\"domain\", \"status\"),\n  FOREIGN KEY (\"domain\") REFERENCES \"domain\" (\"name\")\n);\n",
+		"  \"crDate\" TIMESTAMPTZ,\n",
+		"COPY \"domainStatus\" (\"domain\", \"status\") FROM stdin;\nexample1.example\tok\nexample2.example\tok\nexample2.example\tclientUpdateProhibited\n\\.\n",
+		"example1.example\tDexample1-TEST\t\\N\t\\N\t\\N\tjd1234\tRegistrarX\tRegistrarX\t1999-04-03T22:00:00Z\t2025-04-03T22:00:00Z\t\\N\t\\N\n",
+		"COMMIT;\n",
+	} {
+		if !strings.Contains(sql, expected) {
+			t.Errorf("Expected the SQL to contain %q, got:\n%s", expected, sql)
+		}
+	}
+	// Referenced tables are created before the tables that reference them
+	if strings.Index(sql, `CREATE TABLE "registrar"`) > strings.Index(sql, `CREATE TABLE "domain"`) || strings.Index(sql, `CREATE TABLE "domain"`) > strings.Index(sql, `CREATE TABLE "domainStatus"`) {
+		t.Errorf("Tables are not in foreign key order:\n%s", sql)
+	}
+}
+
+func TestSQLSinkDiffHasNoForeignKeys(t *testing.T) {
+	sql := analyzeToSQL(t, SQL_DIALECT_POSTGRES, "DIFF")
+	if strings.Contains(sql, "FOREIGN KEY") {
+		t.Errorf("Expected no foreign keys for a DIFF deposit")
+	}
+}
+
+// TestSQLSinkSQLite replays the SQL file with sqlite3 if it is installed.
+func TestSQLSinkSQLite(t *testing.T) {
+	sql := analyzeToSQL(t, SQL_DIALECT_SQLITE, "FULL")
+	if !strings.Contains(sql, "INSERT INTO \"hostAddress\" (\"host\", \"address\", \"version\") VALUES\n('ns1.example1.example', '192.0.2.2', 'v4'),\n") {
+		t.Errorf("Unexpected SQL:\n%s", sql)
+	}
+	sqlite3, err := exec.LookPath("sqlite3")
+	if err != nil {
+		t.Skip("sqlite3 is not installed")
+	}
+	db := filepath.Join(t.TempDir(), "deposit.db")
+	cmd := exec.Command(sqlite3, "-bail", db)
+	// The registrant of the domains in the test deposit is not in it, which the foreign key check reports
+	cmd.Stdin = strings.NewReader(sql + "SELECT count(*) FROM \"domainStatus\";\nPRAGMA foreign_key_check;\n")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("sqlite3 failed with error %v: %s", err, output)
+	}
+	if strings.TrimSpace(string(output)) != "3\ndomain|1|contact|1\ndomain|2|contact|1" {
+		t.Errorf("Expected 3 domain statuses and 2 domains with a missing registrant, got %q", output)
+	}
+}
+
+func TestSQLValues(t *testing.T) {
+	schema := RecordSchema{Fields: []RecordField{stringField("a", ""), integerField("b", ""), datetimeField("c", "")}}
+	testCases := []struct {
+		values   []string
+		postgres string
+		sqlite   string
+	}{
+		{[]string{"it's", "8", "2005-04-23T13:49:00.5+02:00"}, "it's\t8\t2005-04-23T11:49:00.5Z\n", "('it''s', 8, '2005-04-23T11:49:00.5Z')"},
+		{[]string{"", "", "not a date"}, "\\N\t\\N\t\\N\n", "(NULL, NULL, NULL)"},
+		{[]string{"tab\there\\", "0", ""}, "tab\\there\\\\\t0\t\\N\n", "('tab\there\\', 0, NULL)"},
+	}
+	for _, tc := range testCases {
+		if actual := postgresCopyRow(schema, tc.values); actual != tc.postgres {
+			t.Errorf("postgresCopyRow(%q) = %q, expected %q", tc.values, actual, tc.postgres)
+		}
+		if actual := sqliteValues(schema, tc.values); actual != tc.sqlite {
+			t.Errorf("sqliteValues(%q) = %q, expected %q", tc.values, actual, tc.sqlite)
+		}
+	}
+}
+
+func TestSQLSinkUnsupportedDialect(t *testing.T) {
+	a := &XMLAnalyzer{}
+	s := &SQLSink{Dialect: "oracle"}
+	if err := s.Begin(a); !errors.Is(err, ErrUnsupportedSQLDialect) {
+		t.Errorf("Expected ErrUnsupportedSQLDialect, got %v", err)
+	}
+}
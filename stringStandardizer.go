@@ -1,6 +1,7 @@
 package ryde
 
 import (
+	"reflect"
 	"strings"
 )
 
@@ -18,3 +19,52 @@ func StandardizeStringSlice(s []string) []string {
 	}
 	return s
 }
+
+// Returns a copy of the object with StandardizeString run on all its strings, including those in nested structs and slices.
+// The object itself is not modified.
+func StandardizeObject(object any) any {
+	if object == nil {
+		return nil
+	}
+	return standardizeValue(reflect.ValueOf(object)).Interface()
+}
+
+// Returns a standardized copy of v.
+func standardizeValue(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.String:
+		return reflect.ValueOf(StandardizeString(v.String())).Convert(v.Type())
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if c.Field(i).CanSet() {
+				c.Field(i).Set(standardizeValue(v.Field(i)))
+			}
+		}
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(standardizeValue(v.Index(i)))
+		}
+		return c
+	case reflect.Array:
+		c := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(standardizeValue(v.Index(i)))
+		}
+		return c
+	case reflect.Pointer:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type().Elem())
+		c.Elem().Set(standardizeValue(v.Elem()))
+		return c
+	}
+	return v
+}
@@ -40,3 +40,30 @@ func TestStandardizeStringSlice(t *testing.T) {
 		}
 	}
 }
+
+func TestStandardizeObject(t *testing.T) {
+	host := XMLHost{
+		Name:   " ns1.example.example\n\t",
+		Status: []XMLHostStatus{{"\tok "}},
+		Addr:   []XMLHostAddr{{"v4", "\n  192.0.2.1\n"}},
+	}
+	want := XMLHost{
+		Name:   "ns1.example.example",
+		Status: []XMLHostStatus{{"ok"}},
+		Addr:   []XMLHostAddr{{"v4", "192.0.2.1"}},
+	}
+	got := StandardizeObject(host)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("StandardizeObject(%q) = %q, want %q", host, got, want)
+	}
+	// The original is left alone
+	if host.Addr[0].ID != "\n  192.0.2.1\n" {
+		t.Errorf("StandardizeObject modified the original: %q", host.Addr[0].ID)
+	}
+	if got := StandardizeObject(&XMLNNDN{AName: " a.example "}); got.(*XMLNNDN).AName != "a.example" {
+		t.Errorf("StandardizeObject of a pointer = %v", got)
+	}
+	if got := StandardizeObject(nil); got != nil {
+		t.Errorf("StandardizeObject(nil) = %v, want nil", got)
+	}
+}
@@ -0,0 +1,119 @@
+package ryde
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"io"
+	"path"
+	"time"
+)
+
+// The default pattern used to find the deposit XML in a tar archive, matched against the base name of the entries.
+const DEFAULT_TAR_ENTRY_PATTERN = "*.xml"
+
+// TarEntry holds the metadata of a tar archive entry that was analyzed.
+type TarEntry struct {
+	Name    string    `json:"name"`    // The name of the entry in the archive.
+	Size    int64     `json:"size"`    // The size of the entry in bytes.
+	ModTime time.Time `json:"modTime"` // The modification time of the entry.
+}
+
+// IsTar checks if the stream in br is a tar archive by peeking at the ustar magic in the first header, without consuming it.
+func IsTar(br *bufio.Reader) (bool, error) {
+	head, err := br.Peek(512)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return false, err
+	}
+	if len(head) < 262 {
+		return false, nil
+	}
+	// Both the POSIX "ustar\x00" and the GNU "ustar " magic start with ustar
+	return bytes.HasPrefix(head[257:], []byte("ustar")), nil
+}
+
+// tarXMLReader is an io.Reader that reads the contents of the entries of a tar archive that match pattern, one after the other.
+// The entries are never extracted to disk.
+type tarXMLReader struct {
+	tr      *tar.Reader
+	pattern string
+	current bool              // Whether we are reading the contents of a matching entry.
+	onEntry func(*tar.Header) // Called for every matching entry before its contents are read.
+}
+
+func (t *tarXMLReader) Read(b []byte) (int, error) {
+	for {
+		if t.current {
+			n, err := t.tr.Read(b)
+			if err == io.EOF {
+				t.current = false
+				if n > 0 {
+					return n, nil
+				}
+				continue
+			}
+			return n, err
+		}
+		if err := t.next(); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// Advances to the next regular file entry whose base name matches the pattern.
+func (t *tarXMLReader) next() error {
+	for {
+		hdr, err := t.tr.Next()
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		matched, err := path.Match(t.pattern, path.Base(hdr.Name))
+		if err != nil {
+			return err
+		}
+		if matched {
+			t.current = true
+			t.onEntry(hdr)
+			return nil
+		}
+	}
+}
+
+// Checks if the XML reader is a tar archive and if so, returns a reader over the contents of the entries that match a.TarEntryPattern.
+// The metadata of these entries is recorded in a.XMLFile.TarEntries.
+func (a *XMLAnalyzer) untarXMLReader(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	isTar, err := IsTar(br)
+	if err != nil {
+		return nil, err
+	}
+	if !isTar {
+		return br, nil
+	}
+	pattern := a.TarEntryPattern
+	if pattern == "" {
+		pattern = DEFAULT_TAR_ENTRY_PATTERN
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	a.XMLFile.TarEntries = []TarEntry{}
+	tr := &tarXMLReader{
+		tr:      tar.NewReader(br),
+		pattern: pattern,
+		onEntry: func(hdr *tar.Header) {
+			a.XMLFile.TarEntries = append(a.XMLFile.TarEntries, TarEntry{Name: hdr.Name, Size: hdr.Size, ModTime: hdr.ModTime.UTC()})
+		},
+	}
+	// Make sure the archive contains a deposit before we hand it to the decoder
+	if err := tr.next(); err != nil {
+		if err == io.EOF {
+			return nil, ErrNoXMLInTar
+		}
+		return nil, err
+	}
+	return tr, nil
+}
@@ -0,0 +1,111 @@
+package ryde
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Returns a tar archive with the given entries, in order.
+func createTestTar(t *testing.T, entries map[string]string, order []string) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, name := range order {
+		hdr := &tar.Header{
+			Name:     name,
+			Mode:     0644,
+			Size:     int64(len(entries[name])),
+			ModTime:  time.Date(2019, 10, 17, 1, 2, 3, 0, time.UTC),
+			Typeflag: tar.TypeReg,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("Failed to write tar header: %v", err)
+		}
+		if _, err := tw.Write([]byte(entries[name])); err != nil {
+			t.Fatalf("Failed to write tar entry: %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("Failed to close tar writer: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// TestAnalyzeTagsTar tests that the deposit XML is found in a tar archive and analyzed without extracting it.
+func TestAnalyzeTagsTar(t *testing.T) {
+	deposit := getValidFullDepositXMLString()
+	data := createTestTar(t, map[string]string{
+		"README.txt":                            "not a deposit",
+		"test_2019-10-17_FULL_S1_R0.xml":        deposit,
+		"test_2019-10-17_FULL_S1_R0-domain.csv": "example1.example,Dexample1-TEST",
+	}, []string{"README.txt", "test_2019-10-17_FULL_S1_R0.xml", "test_2019-10-17_FULL_S1_R0-domain.csv"})
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write(data)
+	zw.Close()
+
+	for name, content := range map[string][]byte{"deposit.tar": data, "deposit.tar.gz": gz.Bytes()} {
+		t.Run(name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), name)
+			if err := os.WriteFile(filename, content, 0666); err != nil {
+				t.Fatalf("Failed to write tar file: %v", err)
+			}
+			a, err := NewXMLAnalyzer(filename)
+			if err != nil {
+				t.Fatalf("NewXMLAnalyzer returned an error: %s", err)
+			}
+			err = a.AnalyzeTags()
+			if err != nil {
+				t.Fatalf("AnalyzeTags failed with error: %v", err)
+			}
+			if a.Counters["domain"] != 2 || a.Deposit.ID != "20191017001" {
+				t.Errorf("Unexpected analysis result %v %v", a.Counters, a.Deposit)
+			}
+			if len(a.XMLFile.TarEntries) != 1 {
+				t.Fatalf("Expected 1 tar entry, got %v", a.XMLFile.TarEntries)
+			}
+			entry := a.XMLFile.TarEntries[0]
+			if entry.Name != "test_2019-10-17_FULL_S1_R0.xml" || entry.Size != int64(len(deposit)) || !entry.ModTime.Equal(time.Date(2019, 10, 17, 1, 2, 3, 0, time.UTC)) {
+				t.Errorf("Unexpected tar entry %v", entry)
+			}
+		})
+	}
+}
+
+// TestAnalyzeTagsTarWithoutDeposit tests that an error is returned when no entry matches the deposit XML pattern.
+func TestAnalyzeTagsTarWithoutDeposit(t *testing.T) {
+	data := createTestTar(t, map[string]string{"README.txt": "not a deposit"}, []string{"README.txt"})
+	a, err := NewXMLAnalyzerFromReader(bytes.NewReader(data), filepath.Join(t.TempDir(), "out"), 0)
+	if err != nil {
+		t.Fatalf("NewXMLAnalyzerFromReader returned an error: %s", err)
+	}
+	err = a.AnalyzeTags()
+	if err != ErrNoXMLInTar {
+		t.Errorf("Expected ErrNoXMLInTar, got %v", err)
+	}
+}
+
+// TestAnalyzeTagsTarEntryPattern tests that the entry pattern can be configured.
+func TestAnalyzeTagsTarEntryPattern(t *testing.T) {
+	data := createTestTar(t, map[string]string{
+		"other.xml":       "<other/>",
+		"deposit/rde.dat": getValidFullDepositXMLString(),
+	}, []string{"other.xml", "deposit/rde.dat"})
+	a, err := NewXMLAnalyzerFromReader(bytes.NewReader(data), filepath.Join(t.TempDir(), "out"), 0)
+	if err != nil {
+		t.Fatalf("NewXMLAnalyzerFromReader returned an error: %s", err)
+	}
+	a.TarEntryPattern = "*.dat"
+	err = a.AnalyzeTags()
+	if err != nil {
+		t.Fatalf("AnalyzeTags failed with error: %v", err)
+	}
+	if len(a.XMLFile.TarEntries) != 1 || a.XMLFile.TarEntries[0].Name != "deposit/rde.dat" || a.Counters["domain"] != 2 {
+		t.Errorf("Unexpected analysis result %v %v", a.XMLFile.TarEntries, a.Counters)
+	}
+}
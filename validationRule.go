@@ -0,0 +1,144 @@
+package ryde
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+)
+
+// ValidationRule is a user defined rule that is evaluated against every decoded object of the type in Object.
+// Expr is written in the expr language (https://expr-lang.org) and must evaluate to true for an object to pass.
+// The fields of the decoded object (XMLDomain, XMLHost, XMLContact or XMLRegistrar) are available by their Go name, e.g. len(Ns) <= 13.
+// Expressions are sandboxed: they can only read the object they are evaluated against and have no access to the filesystem, network or environment.
+type ValidationRule struct {
+	ID       string      `json:"id"`       // A stable identifier for the rule, reported with every finding.
+	Object   string      `json:"object"`   // The object type the rule applies to: domain, host, contact or registrar.
+	Severity string      `json:"severity"` // The severity of a violation: error, warning or info.
+	Message  string      `json:"message"`  // The message reported when an object violates the rule.
+	Field    string      `json:"field"`    // Optional path of the field the rule checks, e.g. Ns or SecDNS.DSData. Reported with every finding.
+	Expr     string      `json:"expr"`     // The expression that must evaluate to true for an object to pass.
+	program  *vm.Program `json:"-"`
+}
+
+// Maps the object names that can be used in a ValidationRule to the type the expression is compiled against.
+var validationRuleEnvs = map[string]any{
+	"domain":    XMLDomain{},
+	"host":      XMLHost{},
+	"contact":   XMLContact{},
+	"registrar": XMLRegistrar{},
+}
+
+// Maximum number of nodes in a rule expression, this keeps rules small and cheap to evaluate on every object.
+const maxValidationRuleNodes = 1000
+
+// LoadValidationRules reads a JSON rules file and returns the compiled rules.
+func LoadValidationRules(filename string) ([]ValidationRule, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseValidationRules(f)
+}
+
+// ParseValidationRules reads a JSON array of rules from r, validates and compiles them.
+// It returns an error if any of the rules is invalid or its expression does not compile to a boolean.
+func ParseValidationRules(r io.Reader) ([]ValidationRule, error) {
+	var rules []ValidationRule
+	if err := json.NewDecoder(r).Decode(&rules); err != nil {
+		return nil, fmt.Errorf("error decoding validation rules: %s", err)
+	}
+	ids := make(map[string]bool)
+	for i := range rules {
+		if rules[i].ID == "" {
+			return nil, ErrMissingRuleID
+		}
+		if ids[rules[i].ID] {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateRuleID, rules[i].ID)
+		}
+		ids[rules[i].ID] = true
+		if err := rules[i].Compile(); err != nil {
+			return nil, err
+		}
+	}
+	return rules, nil
+}
+
+// Compile validates the rule and compiles its expression against the type of its Object.
+func (r *ValidationRule) Compile() error {
+	env, ok := validationRuleEnvs[r.Object]
+	if !ok {
+		return fmt.Errorf("%w: rule %s has object %q", ErrInvalidRuleObject, r.ID, r.Object)
+	}
+	if !IsValidSeverity(r.Severity) {
+		return fmt.Errorf("%w: rule %s has severity %q", ErrInvalidRuleSeverity, r.ID, r.Severity)
+	}
+	program, err := expr.Compile(r.Expr, expr.Env(env), expr.AsBool(), expr.MaxNodes(maxValidationRuleNodes))
+	if err != nil {
+		return fmt.Errorf("error compiling rule %s: %s", r.ID, err)
+	}
+	r.program = program
+	return nil
+}
+
+// Evaluate runs the rule against v and returns true if v passes the rule.
+func (r *ValidationRule) Evaluate(v any) (bool, error) {
+	if r.program == nil {
+		if err := r.Compile(); err != nil {
+			return false, err
+		}
+	}
+	out, err := expr.Run(r.program, v)
+	if err != nil {
+		return false, err
+	}
+	return out.(bool), nil
+}
+
+// IsValidSeverity checks if the given string is a valid finding severity.
+// A valid severity is either "error", "warning" or "info".
+func IsValidSeverity(s string) bool {
+	return s == SEVERITY_ERROR || s == SEVERITY_WARNING || s == SEVERITY_INFO
+}
+
+// Evaluates all rules for the given object type against v and returns a Finding for each rule that does not pass.
+// A rule that fails to evaluate is reported as an error finding rather than aborting the analysis.
+// pos is the location of the object in the XML source and is reported with the findings.
+func (a *XMLAnalyzer) ruleFindings(object, key string, v any, pos SourcePosition) []Finding {
+	var findings []Finding
+	for i := range a.Rules {
+		rule := &a.Rules[i]
+		if rule.Object != object {
+			continue
+		}
+		passed, err := rule.Evaluate(v)
+		if err != nil {
+			findings = append(findings, Finding{
+				RuleID:   rule.ID,
+				Severity: SEVERITY_ERROR,
+				Object:   object,
+				Key:      key,
+				Field:    rule.Field,
+				Message:  fmt.Sprintf("error evaluating rule: %s", err),
+				Position: pos,
+			})
+			continue
+		}
+		if !passed {
+			findings = append(findings, Finding{
+				RuleID:   rule.ID,
+				Severity: rule.Severity,
+				Object:   object,
+				Key:      key,
+				Field:    rule.Field,
+				Message:  rule.Message,
+				Position: pos,
+			})
+		}
+	}
+	return findings
+}
@@ -0,0 +1,131 @@
+package ryde
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestParseValidationRules tests that rules files are decoded and validated, and that invalid rules are rejected.
+func TestParseValidationRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr error
+		wantLen int
+	}{
+		{
+			name:    "valid rules",
+			input:   `[{"id":"NS001","object":"domain","severity":"error","message":"too many nameservers","expr":"len(Ns) <= 13"},{"id":"CC001","object":"contact","severity":"warning","message":"forbidden country","expr":"none(PostalInfo, .Address.CountryCode in ['XX'])"}]`,
+			wantLen: 2,
+		},
+		{
+			name:    "missing id",
+			input:   `[{"object":"domain","severity":"error","expr":"true"}]`,
+			wantErr: ErrMissingRuleID,
+		},
+		{
+			name:    "duplicate id",
+			input:   `[{"id":"A","object":"domain","severity":"error","expr":"true"},{"id":"A","object":"host","severity":"error","expr":"true"}]`,
+			wantErr: ErrDuplicateRuleID,
+		},
+		{
+			name:    "invalid object",
+			input:   `[{"id":"A","object":"nndn","severity":"error","expr":"true"}]`,
+			wantErr: ErrInvalidRuleObject,
+		},
+		{
+			name:    "invalid severity",
+			input:   `[{"id":"A","object":"domain","severity":"fatal","expr":"true"}]`,
+			wantErr: ErrInvalidRuleSeverity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := ParseValidationRules(strings.NewReader(tt.input))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParseValidationRules() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(rules) != tt.wantLen {
+				t.Errorf("ParseValidationRules() returned %d rules, want %d", len(rules), tt.wantLen)
+			}
+		})
+	}
+}
+
+// TestParseValidationRulesCompileErrors tests that expressions that do not compile, or do not return a boolean, are rejected.
+func TestParseValidationRulesCompileErrors(t *testing.T) {
+	inputs := []string{
+		`[{"id":"A","object":"domain","severity":"error","expr":"len(Ns) <="}]`,
+		`[{"id":"A","object":"domain","severity":"error","expr":"DoesNotExist == 1"}]`,
+		`[{"id":"A","object":"domain","severity":"error","expr":"len(Ns)"}]`,
+	}
+	for _, input := range inputs {
+		if _, err := ParseValidationRules(strings.NewReader(input)); err == nil {
+			t.Errorf("Expected ParseValidationRules(%s) to return an error", input)
+		}
+	}
+}
+
+// TestValidationRuleEvaluate tests the evaluation of rules against decoded objects.
+func TestValidationRuleEvaluate(t *testing.T) {
+	dom := XMLDomain{
+		Name:   "example.example",
+		Ns:     []XMLDomainHost{{HostObjs: []string{"ns1.example.com", "ns2.example.com"}}},
+		SecDNS: XMLSecDNS{},
+		ClID:   "RegistrarX",
+	}
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"sum(Ns, len(.HostObjs)) <= 2", true},
+		{"sum(Ns, len(.HostObjs)) <= 1", false},
+		{"ClID != 'RegistrarX' || len(SecDNS.DSData) > 0", false},
+		{"Name endsWith '.example'", true},
+	}
+	for _, tt := range tests {
+		rule := ValidationRule{ID: "T", Object: "domain", Severity: SEVERITY_ERROR, Expr: tt.expr}
+		got, err := rule.Evaluate(dom)
+		if err != nil {
+			t.Fatalf("Evaluate(%q) returned an error: %s", tt.expr, err)
+		}
+		if got != tt.want {
+			t.Errorf("Evaluate(%q) = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+// TestAnalyzeTagsWithRules tests that rule violations are added to the findings of the analyzer.
+func TestAnalyzeTagsWithRules(t *testing.T) {
+	f, err := createValidXMLDepositTestFile()
+	if err != nil {
+		t.Fatalf("Failed to create temporary file: %v", err)
+	}
+	defer os.Remove(f)
+	a, err := NewXMLAnalyzer(f)
+	if err != nil {
+		t.Fatalf("NewXMLAnalyzer returned an error: %s", err)
+	}
+	a.Rules, err = ParseValidationRules(strings.NewReader(`[
+		{"id":"DNSSEC001","object":"domain","severity":"warning","message":"RegistrarX domains must be signed","expr":"ClID != 'RegistrarX' || len(SecDNS.DSData) > 0"},
+		{"id":"HOST001","object":"host","severity":"error","message":"hosts need an address","expr":"len(Addr) > 0"}
+	]`))
+	if err != nil {
+		t.Fatalf("ParseValidationRules returned an error: %s", err)
+	}
+	err = a.AnalyzeTags()
+	if err != nil {
+		t.Fatalf("AnalyzeTags failed with error: %v", err)
+	}
+	if len(a.Findings) != 2 {
+		t.Fatalf("Expected 2 findings, got %d: %v", len(a.Findings), a.Findings)
+	}
+	for _, finding := range a.Findings {
+		if finding.RuleID != "DNSSEC001" || finding.Severity != SEVERITY_WARNING || finding.Object != "domain" {
+			t.Errorf("Unexpected finding %v", finding)
+		}
+	}
+}
@@ -35,6 +35,7 @@ var (
 		"idnLanguage":         IDN_FILE_SUFFIX,
 		"nndn":                NNDN_FILE_SUFFIX,
 		"uniqueContactID":     UNIQUE_CONTACT_ID_FILE_SUFFIX,
-		"analysis":            ANALYSYS_FILE_SUFFIX,
+		"orphanContact":       ORPHAN_CONTACT_FILE_SUFFIX,
+		"orphanHost":          ORPHAN_HOST_FILE_SUFFIX,
 	}
 )
@@ -3,14 +3,21 @@ package ryde
 import (
 	"bytes"
 	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
 	"os"
-	"strconv"
+	"path/filepath"
+	"sort"
 	"strings"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
 )
 
 // Defines an struct to hold all assets and information about the XML file being analyzed
@@ -20,43 +27,147 @@ type XMLAnalyzer struct {
 	Deposit  XMLDepositUnMarshall `json:"deposit"`  // The struct for containing the UnMarshalled Deposit info
 	Header   XMLHeaderUnMarshall  `json:"header"`   // The struct for containing the UnMarshalled Header info
 	Counters map[string]int       `json:"counters"` // Holds counters about the number of objects we encountered during analysis. This should match the numbers in the header as well as the number of lines in the CSV files.
+	Rules    []ValidationRule     `json:"-"`        // User defined validation rules that are evaluated against every decoded object.
+	Findings []Finding            `json:"findings"` // The findings produced by the built-in checks and validation rules during analysis.
+	Tolerant bool                 `json:"tolerant"` // In tolerant mode objects that fail to decode are quarantined instead of aborting the analysis. Strict mode is the default.
+	BaseName string               `json:"baseName"` // The base name for the output files. Defaults to the XML file name without its extension.
+	// The pattern used to find the deposit XML entries when the input is a tar archive, matched against the base name of the entries. Defaults to *.xml.
+	TarEntryPattern string `json:"tarEntryPattern,omitempty"`
+	// The private keys used to decrypt OpenPGP encrypted (.ryde) deposits.
+	Keyring openpgp.EntityList `json:"-"`
+	// The detached OpenPGP signature of the deposit and the public keys to verify it with. The signature is verified while the deposit is analyzed.
+	SignatureFile       string             `json:"signatureFile,omitempty"`
+	VerificationKeyring openpgp.EntityList `json:"-"`
+	// The result of verifying the signature in SignatureFile.
+	Signature *SignatureResult `json:"signature,omitempty"`
+	// The filesystem the XML file is read from and the filesystem the output files are written to. Both default to the host filesystem (OSFS).
+	InputFS  fs.FS      `json:"-"`
+	OutputFS WritableFS `json:"-"`
+	// The directory the output files are written to. Defaults to the directory of BaseName, or of the XML file.
+	OutputDir string `json:"outputDir,omitempty"`
+	// What to do with the output of an earlier analysis: OVERWRITE_TRUNCATE (the default), OVERWRITE_FAIL or OVERWRITE_VERSIONED.
+	Overwrite string `json:"overwrite,omitempty"`
+	// Reproducible sets the times in the analysis report to the watermark of the deposit and the durations to zero,
+	// so analyzing the same deposit twice gives byte-identical output.
+	Reproducible bool `json:"reproducible,omitempty"`
+	// CheckFileName checks the name of the deposit file against the RyDE naming convention, the deposit and the header.
+	// It is not checked for deposits read from a stream, which have no file name.
+	CheckFileName bool `json:"checkFileName,omitempty"`
+	// Bundle writes all output files into one archive with a MANIFEST.json instead of loose files: BUNDLE_TAR_GZ or BUNDLE_ZIP. Empty for loose files.
+	Bundle string `json:"bundle,omitempty"`
+	// The sinks the records are written to. Defaults to a CSVSink.
+	Sinks []OutputSink `json:"-"`
+	// The report of the last analysis, written to the file with ANALYSYS_FILE_SUFFIX.
+	Report *AnalysisReport `json:"-"`
+
+	headerPosition     SourcePosition    // The location of the header in the XML source, used to report header findings.
+	depositPosition    SourcePosition    // The location of the deposit element in the XML source, used to report deposit findings.
+	quarantineFile     WritableFile      // The file quarantined objects are written to in tolerant mode.
+	quarantineEncoder  *json.Encoder     // The encoder that writes quarantined objects to the quarantine file.
+	quarantinedObjects map[string]int    // The number of quarantined objects per counter, which the header reconciliation does not count as found.
+	references         *objectReferences // Keeps track of contacts and hosts and the references to them, used to report orphans.
+	part               *splitPart        // Set when analyzing a part of a SplitDeposit.
+	activeSinks        []OutputSink      // The sinks that began and have not ended yet.
+	outputFiles        []string          // The names of the output files written during analysis, in the order they were created.
+	decodedAt          time.Time         // The time the last token of the deposit was decoded.
+	outputBase         string            // The base name of the output files of the last analysis, resolved from OutputDir and Overwrite.
+	stagingDir         string            // The directory the output is written to until the analysis succeeds, empty if it is written in place.
 }
 
 // CSVFile represents a CSV file with its metadata and read/write functionality.
 type CSVFile struct {
-	FileName       string      `json:"fileName"`  // The name of the CSV file.
-	FileSize       int64       `json:"fileSize"`  // The size of the CSV file in bytes.
-	LineCount      int         `json:"lineCount"` // The number of lines in the CSV file.
-	fileDescriptor *os.File    `json:"-"`         // The file descriptor for the CSV file.
-	CsvWriter      *csv.Writer `json:"-"`         // The CSV writer for the CSV file.
+	FileName       string       `json:"fileName"`         // The name of the CSV file, empty if the CSV file is sharded.
+	FileSize       int64        `json:"fileSize"`         // The size of the CSV file in bytes, or the total size of its shards.
+	LineCount      int          `json:"lineCount"`        // The number of lines in the CSV file, or in all its shards, including the header rows.
+	Header         bool         `json:"header"`           // Whether the first line of the CSV file, or of every shard, is a header row.
+	Shards         []*CSVShard  `json:"shards,omitempty"` // The files the CSV file is split across when CSVSink shards the output.
+	fileDescriptor WritableFile `json:"-"`                // The file descriptor for the CSV file.
+	CsvWriter      *csv.Writer  `json:"-"`                // The CSV writer for the CSV file.
 }
 
 // XMLFile represents an XML file with its name and size.
+// The XML can be read from a file on disk or from any io.Reader, in which case FileSize is the size hint that was provided, if any.
 type XMLFile struct {
-	FileName string       `json:"fileName"` // The name of the XML file.
-	FileSize int64        `json:"fileSize"` // The size of the XML file in bytes.
-	osFile   *os.File     `json:"-"`
-	Decoder  *xml.Decoder `json:"-"`
+	FileName  string `json:"fileName"`  // The name of the XML file, or a description of the stream it is read from.
+	FileSize  int64  `json:"fileSize"`  // The size of the XML file in bytes, or the size hint for a stream. 0 if unknown.
+	BytesRead int64  `json:"bytesRead"` // The number of bytes read from the XML file or stream during analysis.
+	// The hex encoded SHA-256 of the XML file or stream as it was read, before decryption or decompression. Empty if it was not read to the end.
+	SHA256 string `json:"sha256,omitempty"`
+	// The compression of the XML file, detected from its magic bytes: none, gzip, bzip2, xz or zstd.
+	Compression string `json:"compression"`
+	// The number of uncompressed bytes read during analysis. FileSize and BytesRead are the compressed sizes.
+	UncompressedBytes int64 `json:"uncompressedBytes"`
+	// The entries that were analyzed when the input is a tar archive, in the order they were read.
+	TarEntries []TarEntry `json:"tarEntries,omitempty"`
+	// The character encoding of the XML as declared, or as detected from its byte order mark. The XML is converted to UTF-8 for analysis.
+	Encoding string `json:"encoding"`
+	// Whether the XML file is an OpenPGP encrypted message, and the ID of the key it was decrypted with.
+	Encrypted       bool               `json:"encrypted"`
+	DecryptionKeyID string             `json:"decryptionKeyId,omitempty"`
+	file            fs.File            // The open XML file, nil for streams.
+	stream          io.Reader          // The stream to read from instead of a file, set by NewXMLAnalyzerFromReader.
+	reader          *progressReader    // The reader the decoder reads from, counts the bytes read and logs progress.
+	Decoder         *xml.Decoder       `json:"-"`
+	transcoded      bool               // Whether the XML was converted to UTF-8 or had its byte order mark removed, so the decoder offsets are not file offsets.
+	recorder        *rawRecorder       // Records the raw XML read by the decoder in tolerant mode.
+	decompressor    io.Closer          // Releases the resources of the decompressor.
+	uncompressed    *countingReader    // Counts the uncompressed bytes read by the decoder.
+	decrypted       io.Reader          // The decrypted OpenPGP message, read to the end to verify its integrity.
+	verifier        *signatureVerifier // Verifies the detached signature over the raw bytes of the XML file.
 }
 
 // NewXMLAnalyzer creates a new instance of XMLAnalyzer and returns a pointer to it.
 // It takes a filename string as input and returns an error if the file cannot be opened or its size cannot be determined.
 // The function opens the file, checks its size, and saves the filename and size to the XMLFile field of the XMLAnalyzer struct.
 func NewXMLAnalyzer(filename string) (*XMLAnalyzer, error) {
-	if !strings.HasSuffix(filename, ".xml") {
+	return NewXMLAnalyzerFS(OSFS{}, filename)
+}
+
+// NewXMLAnalyzerFS creates a new instance of XMLAnalyzer that reads the XML file from fsys, and returns a pointer to it.
+// This allows deposits to be analyzed from embedded files, zip files or in-memory filesystems.
+// The output files are written to the host filesystem, set OutputFS to write them elsewhere.
+func NewXMLAnalyzerFS(fsys fs.FS, filename string) (*XMLAnalyzer, error) {
+	if !IsValidDepositFileName(filename) {
 		return nil, ErrInvalidDepositFileName
 	}
-	a := XMLAnalyzer{}
+	a := XMLAnalyzer{InputFS: fsys}
 	// Try and open the file
-	f, err := os.Open(filename)
+	f, err := fsys.Open(filename)
 	if err != nil {
 		return nil, err
 	}
 	defer f.Close()
 	// Check and save the file size
-	fi, _ := f.Stat() // We can ignore the error here because we know the file exists
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
 	a.XMLFile.FileSize = fi.Size()
 	a.XMLFile.FileName = filename
+	a.init()
+	return &a, nil
+}
+
+// NewXMLAnalyzerFromReader creates a new instance of XMLAnalyzer that analyzes the XML read from r, and returns a pointer to it.
+// This allows deposits to be streamed from stdin, pipes, network responses or decryption streams without writing them to disk.
+// baseName is used to name the output files and is required, as there is no file name to derive it from.
+// sizeHint is the expected size of the stream in bytes and is only used to report progress, use 0 if unknown.
+// A stream can only be read once, so AnalyzeTags should be called without calling AnalyzeDepositTag first.
+func NewXMLAnalyzerFromReader(r io.Reader, baseName string, sizeHint int64) (*XMLAnalyzer, error) {
+	if baseName == "" {
+		return nil, ErrMissingBaseName
+	}
+	a := XMLAnalyzer{}
+	a.XMLFile.FileName = baseName
+	a.XMLFile.FileSize = sizeHint
+	a.XMLFile.stream = r
+	a.BaseName = baseName
+	a.init()
+	return &a, nil
+}
+
+// Initializes the CSV files and counters of a new XMLAnalyzer.
+func (a *XMLAnalyzer) init() {
 	a.CSVFiles = make(map[string]CSVFile)
 	// Initialize the counters
 	c := make(map[string]int)
@@ -64,38 +175,138 @@ func NewXMLAnalyzer(filename string) (*XMLAnalyzer, error) {
 		c[k] = 0
 	}
 	a.Counters = c
-	return &a, nil
 }
 
-// Opens the XMLFile and saves the os.File pointer to the XMLFile.osFile field.
+// Opens the XMLFile from the InputFS and saves the file to the XMLFile.file field.
+// If the analyzer reads from a stream, the stream is used instead. A stream can only be opened once.
 func (a *XMLAnalyzer) OpenXMLFile() error {
-	reader, err := os.Open(a.XMLFile.FileName)
+	if a.XMLFile.stream != nil {
+		if a.XMLFile.BytesRead > 0 || a.XMLFile.reader != nil {
+			return ErrStreamAlreadyRead
+		}
+		a.XMLFile.reader = newProgressReader(a.XMLFile.stream, a.XMLFile.FileName, a.XMLFile.FileSize)
+		return nil
+	}
+	reader, err := a.inputFS().Open(a.XMLFile.FileName)
 	if err != nil {
 		return err
 	}
-	a.XMLFile.osFile = reader
+	a.XMLFile.file = reader
+	a.XMLFile.reader = newProgressReader(reader, a.XMLFile.FileName, a.XMLFile.FileSize)
 	return nil
 }
 
-// Closes the XMLFile.osFile and removes the pointers from the XMLFile.osFile and XMLFile.Decoder fields.
-func (a *XMLAnalyzer) CloseXMLFile() error {
-	err := a.XMLFile.osFile.Close()
-	if err != nil {
-		// TODO: Should we return an error here or just continue?
+// Reads the rest of the XML file, so the SHA-256 of all of it is known, and saves the hash in XMLFile.SHA256.
+func (a *XMLAnalyzer) hashXMLFile() error {
+	if _, err := io.Copy(io.Discard, a.XMLFile.reader); err != nil {
 		return err
 	}
-	a.XMLFile.osFile = nil
+	a.XMLFile.SHA256 = hex.EncodeToString(a.XMLFile.reader.hash.Sum(nil))
+	return nil
+}
+
+// Closes the XMLFile.file and removes the pointers from the XMLFile.file and XMLFile.Decoder fields.
+// Streams are not closed, they are owned by the caller of NewXMLAnalyzerFromReader.
+func (a *XMLAnalyzer) CloseXMLFile() error {
+	if a.XMLFile.reader != nil {
+		a.XMLFile.BytesRead = a.XMLFile.reader.read
+	}
+	if a.XMLFile.uncompressed != nil {
+		a.XMLFile.UncompressedBytes = a.XMLFile.uncompressed.n
+	}
+	if a.XMLFile.decompressor != nil {
+		a.XMLFile.decompressor.Close()
+	}
+	if a.XMLFile.stream == nil {
+		if a.XMLFile.file == nil {
+			return fs.ErrClosed
+		}
+		err := a.XMLFile.file.Close()
+		if err != nil {
+			// TODO: Should we return an error here or just continue?
+			return err
+		}
+	}
+	a.XMLFile.file = nil
+	a.XMLFile.reader = nil
 	a.XMLFile.Decoder = nil
+	a.XMLFile.recorder = nil
+	a.XMLFile.decompressor = nil
+	a.XMLFile.uncompressed = nil
+	a.XMLFile.decrypted = nil
+	if a.XMLFile.verifier != nil {
+		// The analysis stopped before the signature was verified
+		a.XMLFile.verifier.abort()
+		a.XMLFile.verifier = nil
+	}
 	return nil
 }
 
+// Returns the filesystem the XML file is read from, the host filesystem if InputFS is not set.
+func (a *XMLAnalyzer) inputFS() fs.FS {
+	if a.InputFS == nil {
+		return OSFS{}
+	}
+	return a.InputFS
+}
+
+// Returns the filesystem the output files are written to, the host filesystem if OutputFS is not set.
+// While the analysis runs the files are written to the staging directory, if there is one.
+// The files that are opened for writing are recorded for the analysis report.
+func (a *XMLAnalyzer) outputFS() WritableFS {
+	fsys := a.baseOutputFS()
+	if a.stagingDir != "" {
+		fsys = stagedFS{fsys, a.stagingDir}
+	}
+	return trackingFS{fsys, a}
+}
+
+// Returns OutputFS, or the host filesystem if it is not set.
+func (a *XMLAnalyzer) baseOutputFS() WritableFS {
+	if a.OutputFS == nil {
+		return OSFS{}
+	}
+	return a.OutputFS
+}
+
 // Returns an XML decoder for the XMLFile.
 func (a *XMLAnalyzer) CreateXMLDecoder() error {
-	if a.XMLFile.osFile == nil {
+	if a.XMLFile.reader == nil {
 		// TODO: Should we return an error here or open the file?
 		return ErrNoXMLReader
 	}
-	a.XMLFile.Decoder = xml.NewDecoder(a.XMLFile.osFile)
+	// Verify the signature of the XML as we go if we have one
+	r, err := a.verifyingXMLReader(a.XMLFile.reader)
+	if err != nil {
+		return err
+	}
+	// Decrypt the XML as we go if it is an OpenPGP message
+	r, err = a.decryptXMLReader(r)
+	if err != nil {
+		return err
+	}
+	// Decompress the XML as we go if it is compressed
+	r, err = a.decompressXMLReader(r)
+	if err != nil {
+		return err
+	}
+	// Read the deposit XML from the archive if it is a tar archive
+	r, err = a.untarXMLReader(r)
+	if err != nil {
+		return err
+	}
+	// Convert the XML to UTF-8 if it is in another encoding
+	r, err = a.transcodeXMLReader(r)
+	if err != nil {
+		return err
+	}
+	// In tolerant mode we record the raw XML, so we can quarantine objects that fail to decode
+	if a.Tolerant {
+		a.XMLFile.recorder = &rawRecorder{r: r}
+		r = a.XMLFile.recorder
+	}
+	a.XMLFile.Decoder = xml.NewDecoder(r)
+	a.XMLFile.Decoder.CharsetReader = passThroughCharsetReader
 	return nil
 }
 
@@ -149,7 +360,42 @@ func (a *XMLAnalyzer) AnalyzeDepositTag() error {
 
 // Analyze each tag and handle it according to the type of object contained in the tag.
 // Decode the tags we are iterested in and stream the data to the appropriate CSV file.
+// When the analysis is done, successfully or not, the analysis report is saved in Report and written to its file.
+// The output is written to a staging directory that is moved into place when the analysis succeeds, or finishes with quarantined objects.
+// When it fails the output is removed and only the analysis report, with the error, is written.
 func (a *XMLAnalyzer) AnalyzeTags() error {
+	startedAt := time.Now()
+	a.outputFiles = nil
+	err := a.prepareOutput()
+	if err != nil {
+		return err
+	}
+	err = a.analyzeTags()
+	if err != nil && !errors.Is(err, ErrObjectsQuarantined) {
+		a.discardOutput()
+		a.writeAnalysisReport(startedAt, err)
+		return err
+	}
+	reportErr := a.writeAnalysisReport(startedAt, err)
+	if reportErr != nil {
+		a.discardOutput()
+		return reportErr
+	}
+	reportErr = a.writeBundle()
+	if reportErr != nil {
+		a.discardOutput()
+		return reportErr
+	}
+	reportErr = a.finalizeOutput()
+	if reportErr != nil {
+		a.discardOutput()
+		return reportErr
+	}
+	return err
+}
+
+// Does the analysis of AnalyzeTags, without the report.
+func (a *XMLAnalyzer) analyzeTags() error {
 	log.Printf("Analyzing %s (%d B)\n", a.XMLFile.FileName, a.XMLFile.FileSize)
 
 	err := a.OpenXMLFile()
@@ -163,330 +409,476 @@ func (a *XMLAnalyzer) AnalyzeTags() error {
 	}
 	defer a.CloseXMLFile()
 
-	err = a.CreateCSVFiles()
+	err = a.beginSinks()
 	if err != nil {
 		return err
 	}
+	// End the sinks if the analysis fails, so they can release their resources. On success they are ended below.
+	defer a.endSinks()
 
-	err = a.CreateCSVWriters()
+	if a.Tolerant {
+		err = a.CreateQuarantineFile()
+		if err != nil {
+			return err
+		}
+		defer a.CloseQuarantineFile()
+	}
+
+	// Keep track of the contacts and hosts and the domains referencing them, so we can report orphans.
+	a.references = newObjectReferences()
+	if a.part != nil {
+		// The parts of a split deposit share their references, so objects can be referenced from other parts
+		a.references = a.part.references
+	}
+
+	// In tolerant mode we keep track of the error that stopped the analysis, so we can still write the output before reporting it
+	fatalErr, err := a.analyzeTokens()
+	if err != nil {
+		return err
+	}
+	a.decodedAt = time.Now()
+	// A part of a split deposit without objects has not been checked yet
+	err = a.checkSplitPart()
+	if err != nil {
+		return err
+	}
+	// The parts of a split deposit share their unique contact IDs and orphans, so only the last part writes them once all parts are read
+	if a.part == nil || a.part.last {
+		// Now that all tags have been processed
+		// Write the unique contact IDs to the file, sorted so the output does not depend on the order of the map
+		log.Println("Writing unique contact IDs to file")
+		contactIDs := make([]string, 0, len(a.references.uniqueContactIDs))
+		for k := range a.references.uniqueContactIDs {
+			contactIDs = append(contactIDs, k)
+		}
+		sort.Strings(contactIDs)
+		for _, k := range contactIDs {
+			a.Counters["uniqueContactIDs"]++
+			err := a.writeRecord(UniqueContactIDRecord{k})
+			if err != nil {
+				return err
+			}
+		}
+		// Write the contacts and hosts that are not referenced by any domain
+		log.Println("Writing orphaned contacts and hosts to file")
+		err = a.writeOrphans()
+		if err != nil {
+			return err
+		}
+	}
+	// Check the header counts against the objects we found, for a split deposit this is done for all parts together
+	if a.part == nil {
+		a.reconcileHeaderCounts()
+	}
+	// Check the file name against the deposit and the header
+	if a.CheckFileName && a.XMLFile.stream == nil {
+		a.checkFileName()
+	}
+	if len(a.Findings) > 0 {
+		log.Printf("Analysis produced %d findings\n", len(a.Findings))
+	}
+	// Write the findings reports
+	err = a.WriteFindingsFiles()
+	if err != nil {
+		return err
+	}
+	// Finally, end the sinks so they write and close their files
+	err = a.endSinks()
 	if err != nil {
 		return err
 	}
 
-	// Create a map to hold unique contact IDs as found on domains. We will use this later to write to a file.
-	uniqueContactIDs := make(map[string]bool)
+	// In tolerant mode we finish with a summary of what went wrong
+	if a.Tolerant {
+		return a.tolerantSummary(fatalErr)
+	}
+	return nil
+}
 
+// Reads the deposit token by token and handles the start elements. In tolerant mode the error that stopped the analysis is returned as fatalErr,
+// so the output can still be written before it is reported.
+func (a *XMLAnalyzer) analyzeTokens() (fatalErr error, err error) {
 	// Read the entire file, token by token
 	for {
+		// Save the position of the next token so findings can point to the start of the object
+		pos := a.currentPosition()
 		// Read the next token
 		t, tokenErr := a.XMLFile.Decoder.Token()
 		if tokenErr != nil {
 			if tokenErr == io.EOF {
 				log.Println("Reached end of file")
-				break
+				if err := a.finishXMLFile(); err != nil {
+					return nil, err
+				}
+				return nil, nil
 			}
-			return fmt.Errorf("error decoding token: %s", tokenErr)
+			if a.Tolerant {
+				return fmt.Errorf("error decoding token: %s", tokenErr), nil
+			}
+			return nil, fmt.Errorf("error decoding token: %s", tokenErr)
 		}
 
 		// Depending on the token type and Name.Local we handle it accordingly
 		switch se := t.(type) {
 		case xml.StartElement:
-			switch se.Name.Local {
-			case "header":
-				var header XMLHeaderUnMarshall
-				if err := a.XMLFile.Decoder.DecodeElement(&header, &se); err != nil {
-					return fmt.Errorf("error decoding header: %s", err)
-				}
-				a.Header = header
-			case "registrar":
-				var registrar XMLRegistrar
-				// Found a registrar, add it to the counter for sanity checking
-				a.Counters["registrar"]++
-				// Skip registrars that are not in the registrar namespace
-				if err := a.XMLFile.Decoder.DecodeElement(&registrar, &se); err != nil {
-					return fmt.Errorf("error decoding registrar: %s", tokenErr)
-				}
-				// Prepare the CSV row and standardise the strings and add them to the CSV
-				csvRow := []string{registrar.ID, registrar.Name, strconv.Itoa(registrar.GurID), registrar.Status, registrar.WhoisInfo.URL, registrar.URL, registrar.CrDate, registrar.UpDate, registrar.Voice, registrar.Fax, registrar.Email}
-				err := a.CSVFiles["registrar"].CsvWriter.Write(StandardizeStringSlice(csvRow))
-				if err != nil {
-					return err
-				}
-				// Write the registrar postalinfo to the registrar postalinfo file
-				rPostalInfo := make(map[int][]string)
-				for i, postalInfo := range registrar.PostalInfo {
-					a.Counters["registrarPostalInfo"]++
-					rPostalInfo[i] = append(rPostalInfo[i], registrar.ID)
-					rPostalInfo[i] = append(rPostalInfo[i], postalInfo.Type)
-					// This is clunky but we need to ensure there are always 3 Street elements for CSV length consistency
-					// First add the ones that are there
-					rPostalInfo[i] = append(rPostalInfo[i], postalInfo.Address.Street...)
-					// Then add empty strings for the ones that are missing.
-					// A fully slice of strings with 3 street address lines is 4 elements long
-					// So we keep adding empty street strings until we reach a lenght of 4
-					for len(rPostalInfo[i]) <= 4 {
-						rPostalInfo[i] = append(rPostalInfo[i], "")
-					}
-					rPostalInfo[i] = append(rPostalInfo[i], StandardizeString(postalInfo.Address.City), StandardizeString(postalInfo.Address.StateProvince), StandardizeString(postalInfo.Address.PostalCode), StandardizeString(postalInfo.Address.CountryCode))
+			err := a.analyzeStartElement(se, pos)
+			if err != nil {
+				// Quarantined objects have been dealt with, move on to the next element
+				if isQuarantined(err) {
+					continue
 				}
-				for _, v := range rPostalInfo {
-					err := a.CSVFiles["registrarPostalInfo"].CsvWriter.Write(StandardizeStringSlice(v))
-					if err != nil {
-						return err
-					}
+				if a.Tolerant {
+					return err, nil
 				}
+				return nil, err
+			}
+		default:
+			// Skip all other token types
+			continue
+		}
+	}
+}
 
-			case "idnTableRef":
-				// Found an IDN table ref, add it to the counter for sanity checking
-				a.Counters["idnTableRef"]++
-				var idnTableRef XMLIdnTableReference
-				if err := a.XMLFile.Decoder.DecodeElement(&idnTableRef, &se); err != nil {
-					return fmt.Errorf("error decoding IDN table ref: %s", tokenErr)
-				}
-				// Write to the output file
-				idnRow := []string{idnTableRef.ID, idnTableRef.Url, idnTableRef.UrlPolicy}
-				err = a.CSVFiles["idnLanguage"].CsvWriter.Write(StandardizeStringSlice(idnRow))
-				if err != nil {
-					return err
-				}
+// Checks the deposit once it has been read to the end.
+func (a *XMLAnalyzer) finishXMLFile() error {
+	// Make sure the decrypted deposit has not been tampered with
+	if err := a.verifyDecryptedXMLReader(); err != nil {
+		return err
+	}
+	// Make sure the deposit was signed by a trusted key
+	if err := a.verifySignature(); err != nil {
+		return err
+	}
+	// Hash what is left of the input, e.g. the padding of a tar archive
+	return a.hashXMLFile()
+}
 
-			case "contact":
-				// Found a contact, add it to the counter for sanity checking
-				a.Counters["contact"]++
-				// Skip contact tokens that are not in the contact namespace
-				if se.Name.Space != NameSpace["rdeContact"] {
-					continue
-				}
-				var contact XMLContact
-				if err := a.XMLFile.Decoder.DecodeElement(&contact, &se); err != nil {
-					return fmt.Errorf("error decoding contact: %s", tokenErr)
-				}
-				// Write the contact to the contact file
-				contactRow := []string{contact.ID, contact.RoID, contact.Voice, contact.Fax, contact.Email, contact.ClID, contact.CrRr, contact.CrDate, contact.UpRr, contact.UpDate}
-				err = a.CSVFiles["contact"].CsvWriter.Write(StandardizeStringSlice(contactRow))
-				if err != nil {
-					return err
-				}
-				// Set Status in statusFile
-				cStatuses := []string{contact.ID}
-				for _, status := range contact.Status {
-					cStatuses = append(cStatuses, status.S)
-				}
-				for i, s := range cStatuses {
-					if i == 0 {
-						continue
-					}
-					a.Counters["contactStatus"]++
-					err = a.CSVFiles["contactStatus"].CsvWriter.Write(StandardizeStringSlice([]string{contact.ID, s}))
-					if err != nil {
-						return err
-					}
-				}
-				// Set postalInfo in postalInfoFile
-				cPostalInfo := make(map[int][]string)
-				for i, postalInfo := range contact.PostalInfo {
-					a.Counters["contactPostalInfo"]++
-					cPostalInfo[i] = append(cPostalInfo[i], contact.ID)
-					cPostalInfo[i] = append(cPostalInfo[i], postalInfo.Type, StandardizeString(postalInfo.Name), StandardizeString(postalInfo.Org))
-					// This is clunky but we need to ensure there are always 3 Street elements for CSV length consistency
-					// First add the ones that are there
-					cPostalInfo[i] = append(cPostalInfo[i], postalInfo.Address.Street...)
-					// Then add empty strings for the ones that are missing.
-					// A fully slice of strings with 3 street address lines is 6 elements long
-					// So we keep adding empty street strings until we reach a lenght of 6
-					for len(cPostalInfo[i]) <= 6 {
-						cPostalInfo[i] = append(cPostalInfo[i], "")
-					}
-					cPostalInfo[i] = append(cPostalInfo[i], postalInfo.Address.City, postalInfo.Address.StateProvince, postalInfo.Address.PostalCode, postalInfo.Address.CountryCode)
-				}
+// Handles a single start element: decodes the objects we are interested in and streams them to the appropriate CSV file.
+// pos is the position of the start element in the XML source.
+func (a *XMLAnalyzer) analyzeStartElement(se xml.StartElement, pos SourcePosition) error {
+	a.countElement(se)
+	v, label := newElementValue(se)
+	if v != nil {
+		if err := a.decodeObject(v, &se, pos); err != nil {
+			return fmt.Errorf("error decoding %s: %w", label, err)
+		}
+		a.Findings = append(a.Findings, a.elementRuleFindings(v, pos)...)
+	}
+	return a.handleElement(se, pos, v)
+}
 
-				for _, v := range cPostalInfo {
-					err := a.CSVFiles["contactPostalInfo"].CsvWriter.Write(StandardizeStringSlice(v))
-					if err != nil {
-						return err
-					}
-				}
+// Counts the objects in the deposit for sanity checking, also those that are not in the namespace we decode them from.
+func (a *XMLAnalyzer) countElement(se xml.StartElement) {
+	if counter := elementCounter(se.Name.Local); counter != "" {
+		a.Counters[counter]++
+	}
+}
 
-			case "domain":
-				// Found a domain, add it to the counter for sanity checking
-				a.Counters["domain"]++
-				// Skip domain tokens that are not in the domain namespace
-				if se.Name.Space != NameSpace["rdeDomain"] {
-					continue
-				}
-				var dom XMLDomain
-				if err := a.XMLFile.Decoder.DecodeElement(&dom, &se); err != nil {
-					return fmt.Errorf("error decoding domain: %s", tokenErr)
-				}
-				// Write the domain to the domain file
-				domainRow := []string{string(dom.Name), dom.RoID, dom.UName, dom.IdnTableId, dom.OriginalName, dom.Registrant, dom.ClID, dom.CrRr, dom.CrDate, dom.ExDate, dom.UpRr, dom.UpDate}
-				err = a.CSVFiles["domain"].CsvWriter.Write(StandardizeStringSlice(domainRow))
-				if err != nil {
-					return err
-				}
-				// Add a line to the contactID file for each contact, only if it does not exist yet
-				for _, contact := range dom.Contact {
-					// Only add it if it is not there already
-					if !uniqueContactIDs[contact.ID] {
-						uniqueContactIDs[contact.ID] = true
-						a.Counters["uniqueContactIDs"]++
-					}
-				}
-				// Write the domain statuses to the status file
-				dStatuses := []string{dom.Name}
-				for _, status := range dom.Status {
-					dStatuses = append(dStatuses, status.S)
-				}
-				for i, s := range dStatuses {
-					if i == 0 {
-						continue
-					}
-					a.Counters["domainStatus"]++
-					err := a.CSVFiles["domainStatus"].CsvWriter.Write(StandardizeStringSlice([]string{dom.Name, s}))
-					if err != nil {
-						return err
-					}
-				}
-				// Write the nameservers to the nameserver file
-				dNameservers := []string{dom.Name}
-				for _, ns := range dom.Ns {
-					dNameservers = append(dNameservers, ns.HostObjs...)
-				}
-				for i, ns := range dNameservers {
-					if i == 0 {
-						continue
-					}
-					a.Counters["domainNameservers"]++
-					err := a.CSVFiles["domainNameservers"].CsvWriter.Write(StandardizeStringSlice([]string{dom.Name, ns}))
-					if err != nil {
-						return err
-					}
-				}
-				// Write the dnssec information to the dnssec file
-				for _, dsData := range dom.SecDNS.DSData {
-					a.Counters["domainDnssec"]++
-					dnssecRow := []string{dom.Name, strconv.Itoa(dsData.KeyTag), strconv.Itoa(dsData.Alg), strconv.Itoa(dsData.DigestType), dsData.Digest}
-					err := a.CSVFiles["domainDnssec"].CsvWriter.Write(StandardizeStringSlice(dnssecRow))
-					if err != nil {
-						return err
-					}
-				}
-				// Write the transfer information to the transfer file
-				if dom.TrnData.TrStatus.State != "" {
-					a.Counters["domainTransfers"]++
-					transferRow := []string{dom.Name, dom.TrnData.TrStatus.State, dom.TrnData.ReRr.RegID, dom.TrnData.ReDate, dom.TrnData.ReRr.RegID, dom.TrnData.AcDate, dom.TrnData.ExDate}
-					err := a.CSVFiles["domainTransfers"].CsvWriter.Write(StandardizeStringSlice(transferRow))
-					if err != nil {
-						return err
-					}
-				}
+// Returns the counter for the objects with the given element name, or an empty string if they are not counted.
+func elementCounter(name string) string {
+	switch name {
+	case "registrar", "idnTableRef", "contact", "domain", "host":
+		return name
+	case "NNDN":
+		return "nndn"
+	}
+	return ""
+}
 
-			case "host":
-				// Found a host, add it to the counter for sanity checking
-				a.Counters["host"]++
-				// Skip host tags that are not in the host namespace
-				if se.Name.Space != NameSpace["rdeHost"] {
-					continue
-				}
-				var host XMLHost
-				if err := a.XMLFile.Decoder.DecodeElement(&host, &se); err != nil {
-					return fmt.Errorf("error decoding host: %s", tokenErr)
-				}
-				hostRow := []string{host.Name, host.RoID, host.ClID, host.CrRr, host.CrDate, host.UpRr, host.UpDate}
-				err = a.CSVFiles["host"].CsvWriter.Write(StandardizeStringSlice(hostRow))
-				if err != nil {
-					return err
-				}
-				// Set Status in statusFile
-				hStatuses := []string{host.Name}
-				for _, status := range host.Status {
-					hStatuses = append(hStatuses, status.S)
-				}
-				for i, s := range hStatuses {
-					if i == 0 {
-						continue
-					}
-					err := a.CSVFiles["hostStatus"].CsvWriter.Write(StandardizeStringSlice([]string{host.Name, s}))
-					if err != nil {
-						return err
-					}
-				}
-				// Set addresses in addrFile
-				for _, addr := range host.Addr {
-					a.Counters["hostAddress"]++
-					err := a.CSVFiles["hostAddress"].CsvWriter.Write(StandardizeStringSlice([]string{host.Name, addr.IP, addr.IP}))
-					if err != nil {
-						return err
-					}
-				}
+// Returns a new value to decode the start element into and the name of the element to use in errors,
+// or nil if the element is not decoded. Contacts, domains, hosts and NNDNs are only decoded from their own namespace.
+func newElementValue(se xml.StartElement) (any, string) {
+	switch se.Name.Local {
+	case "watermark":
+		if se.Name.Space == NameSpace["rde"] {
+			return new(string), "watermark"
+		}
+	case "header":
+		return &XMLHeaderUnMarshall{}, "header"
+	case "registrar":
+		return &XMLRegistrar{}, "registrar"
+	case "idnTableRef":
+		return &XMLIdnTableReference{}, "IDN table ref"
+	case "contact":
+		if se.Name.Space == NameSpace["rdeContact"] {
+			return &XMLContact{}, "contact"
+		}
+	case "domain":
+		if se.Name.Space == NameSpace["rdeDomain"] {
+			return &XMLDomain{}, "domain"
+		}
+	case "host":
+		if se.Name.Space == NameSpace["rdeHost"] {
+			return &XMLHost{}, "host"
+		}
+	case "NNDN":
+		if se.Name.Space == NameSpace["rdeNNDN"] {
+			return &XMLNNDN{}, "nndn"
+		}
+	}
+	return nil, ""
+}
 
-			case "NNDN":
-				// Found an nndn, add it to the counter for sanity checking
-				a.Counters["nndn"]++
-				// Skip nndns that are not in the nndns namespace
-				if se.Name.Space != NameSpace["rdeNNDN"] {
-					continue
-				}
-				var nndns XMLNNDN
-				if err := a.XMLFile.Decoder.DecodeElement(&nndns, &se); err != nil {
-					return fmt.Errorf("error decoding nndn: %s", tokenErr)
-				}
-				nndnRow := []string{nndns.AName, nndns.UName, nndns.IDNTableID, nndns.OriginalName, nndns.NameState, nndns.CrDate}
-				err := a.CSVFiles["nndn"].CsvWriter.Write(StandardizeStringSlice(nndnRow))
+// Returns the findings of the validation rules for a decoded element. Only domains, hosts, contacts and registrars have rules.
+func (a *XMLAnalyzer) elementRuleFindings(v any, pos SourcePosition) []Finding {
+	switch o := v.(type) {
+	case *XMLRegistrar:
+		return a.ruleFindings("registrar", o.ID, *o, pos)
+	case *XMLContact:
+		return a.ruleFindings("contact", o.ID, *o, pos)
+	case *XMLDomain:
+		return a.ruleFindings("domain", o.Name, *o, pos)
+	case *XMLHost:
+		return a.ruleFindings("host", o.Name, *o, pos)
+	}
+	return nil
+}
+
+// Handles a start element after it has been counted, and decoded into v by newElementValue and decodeObject if it is decoded:
+// saves the deposit attributes, watermark and header, and writes the objects and their records to the output sinks.
+func (a *XMLAnalyzer) handleElement(se xml.StartElement, pos SourcePosition, v any) error {
+	var err error
+	switch v.(type) {
+	case *XMLRegistrar, *XMLIdnTableReference, *XMLContact, *XMLDomain, *XMLHost, *XMLNNDN:
+		// Make sure a part of a split deposit belongs to the deposit before any of its objects are written
+		err = a.checkSplitPart()
+		if err != nil {
+			return err
+		}
+	}
+	switch o := v.(type) {
+	case nil:
+		// Save the deposit attributes, so streams do not need to be read twice to get them
+		if se.Name.Local != "deposit" || se.Name.Space != NameSpace["rde"] {
+			return nil
+		}
+		err = a.Deposit.setAttributes(se.Attr)
+		if err != nil {
+			return err
+		}
+		a.depositPosition = pos
+	case *string:
+		a.Deposit.Watermark = StandardizeString(*o)
+	case *XMLHeaderUnMarshall:
+		a.Header = *o
+		a.headerPosition = pos
+		err = a.checkSplitHeader()
+		if err != nil {
+			return err
+		}
+	case *XMLRegistrar:
+		registrar := *o
+		err = a.writeRecord(RegistrarRecord{registrar.ID, registrar.Name, registrar.GurID, registrar.Status, registrar.WhoisInfo.URL, registrar.URL, registrar.CrDate, registrar.UpDate, registrar.Voice, registrar.Fax, registrar.Email})
+		if err != nil {
+			return err
+		}
+		err = a.writeObject("registrar", registrar)
+		if err != nil {
+			return err
+		}
+		// Write the registrar postalinfo to the registrar postalinfo file
+		for _, postalInfo := range registrar.PostalInfo {
+			a.Counters["registrarPostalInfo"]++
+			err = a.writeRecord(RegistrarPostalInfoRecord{registrar.ID, postalInfo.Type, streetLines(postalInfo.Address.Street), postalInfo.Address.City, postalInfo.Address.StateProvince, postalInfo.Address.PostalCode, postalInfo.Address.CountryCode})
+			if err != nil {
+				return err
+			}
+		}
+
+	case *XMLIdnTableReference:
+		idnTableRef := *o
+		// Write to the output file
+		err = a.writeRecord(IDNTableRefRecord{idnTableRef.ID, idnTableRef.Url, idnTableRef.UrlPolicy})
+		if err != nil {
+			return err
+		}
+		err = a.writeObject("idnTableRef", idnTableRef)
+		if err != nil {
+			return err
+		}
+
+	case *XMLContact:
+		contact := *o
+		a.references.addContact(contact.ID)
+		// Write the contact to the contact file
+		err = a.writeRecord(ContactRecord{contact.ID, contact.RoID, contact.Voice, contact.Fax, contact.Email, contact.ClID, contact.CrRr, contact.CrDate, contact.UpRr, contact.UpDate})
+		if err != nil {
+			return err
+		}
+		err = a.writeObject("contact", contact)
+		if err != nil {
+			return err
+		}
+		// Set Status in statusFile
+		for _, status := range contact.Status {
+			a.Counters["contactStatus"]++
+			err = a.writeRecord(ContactStatusRecord{contact.ID, status.S})
+			if err != nil {
+				return err
+			}
+		}
+		// Set postalInfo in postalInfoFile
+		for _, postalInfo := range contact.PostalInfo {
+			a.Counters["contactPostalInfo"]++
+			err = a.writeRecord(ContactPostalInfoRecord{contact.ID, postalInfo.Type, postalInfo.Name, postalInfo.Org, streetLines(postalInfo.Address.Street), postalInfo.Address.City, postalInfo.Address.StateProvince, postalInfo.Address.PostalCode, postalInfo.Address.CountryCode})
+			if err != nil {
+				return err
+			}
+		}
+
+	case *XMLDomain:
+		dom := *o
+		a.references.addDomain(&dom)
+		// Write the domain to the domain file
+		err = a.writeRecord(DomainRecord{dom.Name, dom.RoID, dom.UName, dom.IdnTableId, dom.OriginalName, dom.Registrant, dom.ClID, dom.CrRr, dom.CrDate, dom.ExDate, dom.UpRr, dom.UpDate})
+		if err != nil {
+			return err
+		}
+		err = a.writeObject("domain", dom)
+		if err != nil {
+			return err
+		}
+		// Add a line to the contactID file for each contact, only if it does not exist yet
+		for _, contact := range dom.Contact {
+			a.references.uniqueContactIDs[contact.ID] = true
+		}
+		// Write the domain statuses to the status file
+		for _, status := range dom.Status {
+			a.Counters["domainStatus"]++
+			err = a.writeRecord(DomainStatusRecord{dom.Name, status.S})
+			if err != nil {
+				return err
+			}
+		}
+		// Write the nameservers to the nameserver file
+		for _, ns := range dom.Ns {
+			for _, hostObj := range ns.HostObjs {
+				a.Counters["domainNameservers"]++
+				err = a.writeRecord(DomainNameserverRecord{dom.Name, hostObj})
 				if err != nil {
 					return err
 				}
+			}
+		}
+		// Write the dnssec information to the dnssec file
+		for _, dsData := range dom.SecDNS.DSData {
+			a.Counters["domainDnssec"]++
+			err = a.writeRecord(DomainDnssecRecord{dom.Name, dsData.KeyTag, dsData.Alg, dsData.DigestType, dsData.Digest})
+			if err != nil {
+				return err
+			}
+		}
+		// Write the transfer information to the transfer file
+		if dom.TrnData.TrStatus.State != "" {
+			a.Counters["domainTransfers"]++
+			err = a.writeRecord(DomainTransferRecord{dom.Name, dom.TrnData.TrStatus.State, dom.TrnData.ReRr.RegID, dom.TrnData.ReDate, dom.TrnData.AcRr.RegID, dom.TrnData.AcDate, dom.TrnData.ExDate})
+			if err != nil {
+				return err
+			}
+		}
 
-			default:
-				// Skip all other tags
-				continue
+	case *XMLHost:
+		host := *o
+		a.references.addHost(host.Name)
+		err = a.writeRecord(HostRecord{host.Name, host.RoID, host.ClID, host.CrRr, host.CrDate, host.UpRr, host.UpDate})
+		if err != nil {
+			return err
+		}
+		err = a.writeObject("host", host)
+		if err != nil {
+			return err
+		}
+		// Set Status in statusFile
+		for _, status := range host.Status {
+			a.Counters["hostStatus"]++
+			err = a.writeRecord(HostStatusRecord{host.Name, status.S})
+			if err != nil {
+				return err
 			}
-		default:
-			// Skip all other token types
-			continue
 		}
-	}
-	// Now that all tags have been processed
-	// Write the unique contact IDs to the file
-	fmt.Println("Writing unique contact IDs to file")
-	for k := range uniqueContactIDs {
-		err := a.CSVFiles["uniqueContactID"].CsvWriter.Write(StandardizeStringSlice([]string{k}))
+		// Set addresses in addrFile
+		for _, addr := range host.Addr {
+			a.Counters["hostAddress"]++
+			err = a.writeRecord(HostAddressRecord{host.Name, addr.ID, addr.IP})
+			if err != nil {
+				return err
+			}
+		}
+
+	case *XMLNNDN:
+		nndns := *o
+		err = a.writeRecord(NNDNRecord{nndns.AName, nndns.UName, nndns.IDNTableID, nndns.OriginalName, nndns.NameState, nndns.CrDate})
 		if err != nil {
 			return err
 		}
+		err = a.writeObject("nndn", nndns)
+		if err != nil {
+			return err
+		}
+
 	}
-	// Write the analysis to the file
-	fmt.Println("Writing analysis to file")
-	analysisBytes, err := json.MarshalIndent(a, "", "  ")
-	if err != nil {
-		return err
-	}
-	err = a.CSVFiles["analysis"].CsvWriter.Write([]string{string(analysisBytes)})
+	return nil
+}
+
+// Writes the findings report as JSON and SARIF next to the CSV files.
+func (a *XMLAnalyzer) WriteFindingsFiles() error {
+	jsonFile, err := a.outputFS().OpenFile(a.GetBaseXMLFileName()+FINDINGS_JSON_FILE_SUFFIX, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
 	if err != nil {
 		return err
 	}
-	// Finally, flush the writers and close the files
-	err = a.FlushCSVWriters()
+	defer jsonFile.Close()
+	err = a.WriteFindingsJSON(jsonFile)
 	if err != nil {
 		return err
 	}
-	err = a.CloseCSVFiles()
+	sarifFile, err := a.outputFS().OpenFile(a.GetBaseXMLFileName()+FINDINGS_SARIF_FILE_SUFFIX, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
 	if err != nil {
 		return err
 	}
-
-	return nil
+	defer sarifFile.Close()
+	return a.WriteFindingsSARIF(sarifFile)
 }
 
-// Returns the XMLFile.FileName without the file extension.
+// Returns the base name for the output files: the configured BaseName, or the XMLFile.FileName without the file extension,
+// in OutputDir if it is set. The extension of a compressed file, e.g. deposit.xml.gz, is removed as well.
+// During and after an analysis this is the base name the output was written to, e.g. in the versioned subdirectory.
 func (a *XMLAnalyzer) GetBaseXMLFileName() string {
-	return strings.Join(strings.Split(a.XMLFile.FileName, ".")[0:len(strings.Split(a.XMLFile.FileName, "."))-1], ".")
+	if a.outputBase != "" {
+		return a.outputBase
+	}
+	base := a.BaseName
+	if base == "" {
+		fileName := trimCompressionExtension(a.XMLFile.FileName)
+		base = strings.Join(strings.Split(fileName, ".")[0:len(strings.Split(fileName, "."))-1], ".")
+	}
+	if a.OutputDir != "" {
+		base = filepath.Join(a.OutputDir, filepath.Base(base))
+	}
+	return base
+}
+
+// IsValidDepositFileName checks if the given filename has the extension of a deposit we can analyze.
+// Valid extensions are .ryde, or .xml or .tar optionally followed by the extension of a supported compression format, e.g. .xml.gz or .tar.zst.
+func IsValidDepositFileName(filename string) bool {
+	if strings.HasSuffix(filename, ".ryde") {
+		return true
+	}
+	filename = trimCompressionExtension(filename)
+	return strings.HasSuffix(filename, ".xml") || strings.HasSuffix(filename, ".tar")
 }
 
 // Count the number of lines and save the fileSize for the set of CSV files. Use this to check against the number of objects in the header
 func (a *XMLAnalyzer) CountLinesInCSVFilesAndSaveSize() error {
 	for k, csvFile := range a.CSVFiles {
-		file, err := os.OpenFile(csvFile.FileName, os.O_RDONLY, 0444)
+		if len(csvFile.Shards) > 0 {
+			err := a.countLinesInShards(&csvFile)
+			if err != nil {
+				return err
+			}
+			a.CSVFiles[k] = csvFile
+			continue
+		}
+		file, err := a.outputFS().Open(csvFile.FileName)
 		if err != nil {
 			return err
 		}
@@ -545,7 +937,7 @@ func (a *XMLAnalyzer) CreateCSVFiles() error {
 // Create csvWriters for each CSV file.
 func (a *XMLAnalyzer) CreateCSVWriters() error {
 	for k, v := range a.CSVFiles {
-		file, err := os.OpenFile(v.FileName, os.O_CREATE|os.O_WRONLY, 0666)
+		file, err := a.outputFS().OpenFile(v.FileName, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
 		if err != nil {
 			return err
 		}
@@ -568,9 +960,13 @@ func (a *XMLAnalyzer) FlushCSVWriters() error {
 
 // Close file descriptors for each CSV file.
 func (a *XMLAnalyzer) CloseCSVFiles() error {
-	for _, v := range a.CSVFiles {
+	for k, v := range a.CSVFiles {
+		if v.fileDescriptor == nil {
+			continue
+		}
 		v.fileDescriptor.Close()
 		v.fileDescriptor = nil
+		a.CSVFiles[k] = v
 	}
 	return nil
 }
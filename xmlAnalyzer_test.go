@@ -3,8 +3,11 @@ package ryde
 import (
 	"encoding/csv"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -65,8 +68,8 @@ func TestNewXMLAnalyzer(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Failed to open XML file: %v", err)
 	}
-	if a.XMLFile.osFile == nil {
-		t.Error("Expected XMLFile.osFile to be set")
+	if a.XMLFile.file == nil {
+		t.Error("Expected XMLFile.file to be set")
 	}
 	err = a.CloseXMLFile()
 	if err != nil {
@@ -454,3 +457,43 @@ func TestAnalyzeTags(t *testing.T) {
 		t.Fatalf("AnalyzeTags failed with error: %v", err)
 	}
 }
+
+// TestNewXMLAnalyzerFromReader tests that a deposit can be analyzed from an io.Reader, and that the deposit attributes are read while analyzing the tags.
+func TestNewXMLAnalyzerFromReader(t *testing.T) {
+	_, err := NewXMLAnalyzerFromReader(strings.NewReader(""), "", 0)
+	if err != ErrMissingBaseName {
+		t.Errorf("Expected ErrMissingBaseName, got %v", err)
+	}
+
+	baseName := filepath.Join(t.TempDir(), "stream")
+	input := getValidFullDepositXMLString()
+	a, err := NewXMLAnalyzerFromReader(io.MultiReader(strings.NewReader(input)), baseName, int64(len(input)))
+	if err != nil {
+		t.Fatalf("NewXMLAnalyzerFromReader returned an error: %s", err)
+	}
+	if a.GetBaseXMLFileName() != baseName {
+		t.Errorf("Expected base name to be %s, got %s", baseName, a.GetBaseXMLFileName())
+	}
+	err = a.AnalyzeTags()
+	if err != nil {
+		t.Fatalf("AnalyzeTags failed with error: %v", err)
+	}
+	if a.Deposit.ID != "20191017001" || a.Deposit.Type != "FULL" || a.Deposit.Watermark != "2019-10-17T00:00:00Z" {
+		t.Errorf("Expected the deposit to be read while analyzing the tags, got %v", a.Deposit)
+	}
+	if a.Counters["domain"] != 2 || a.Counters["host"] != 1 {
+		t.Errorf("Unexpected counters %v", a.Counters)
+	}
+	if a.XMLFile.BytesRead != int64(len(input)) {
+		t.Errorf("Expected %d bytes to be read, got %d", len(input), a.XMLFile.BytesRead)
+	}
+	if _, err := os.Stat(baseName + DOMAIN_FILE_SUFFIX); err != nil {
+		t.Errorf("Expected the domain file to be written with the base name: %v", err)
+	}
+
+	// A stream can only be read once
+	err = a.AnalyzeTags()
+	if err != ErrStreamAlreadyRead {
+		t.Errorf("Expected ErrStreamAlreadyRead, got %v", err)
+	}
+}
@@ -6,43 +6,43 @@ import (
 
 type XMLContact struct {
 	XMLName    xml.Name               `xml:"contact" json:"-"`
-	ID         string                 `xml:"id"`
-	RoID       string                 `xml:"roid"`
-	Status     []XMLContactStatus     `xml:"status"`
-	PostalInfo []XMLContactPostalInfo `xml:"postalInfo"`
-	Voice      string                 `xml:"voice"`
-	Fax        string                 `xml:"fax"`
-	Email      string                 `xml:"email"`
-	ClID       string                 `xml:"clID"`
-	CrRr       string                 `xml:"crRr"`
-	CrDate     string                 `xml:"crDate"`
-	UpRr       string                 `xml:"upRr"`
-	UpDate     string                 `xml:"upDate"`
-	Disclose   XMLDisclose            `xml:"disclose"`
+	ID         string                 `xml:"id" json:"id"`
+	RoID       string                 `xml:"roid" json:"roid"`
+	Status     []XMLContactStatus     `xml:"status" json:"status,omitempty"`
+	PostalInfo []XMLContactPostalInfo `xml:"postalInfo" json:"postalInfo,omitempty"`
+	Voice      string                 `xml:"voice" json:"voice,omitempty"`
+	Fax        string                 `xml:"fax" json:"fax,omitempty"`
+	Email      string                 `xml:"email" json:"email,omitempty"`
+	ClID       string                 `xml:"clID" json:"clID"`
+	CrRr       string                 `xml:"crRr" json:"crRr,omitempty"`
+	CrDate     string                 `xml:"crDate" json:"crDate,omitempty"`
+	UpRr       string                 `xml:"upRr" json:"upRr,omitempty"`
+	UpDate     string                 `xml:"upDate" json:"upDate,omitempty"`
+	Disclose   XMLDisclose            `xml:"disclose" json:"disclose,omitzero"`
 }
 
 type XMLContactPostalInfo struct {
-	XMLName xml.Name `xml:"postalInfo" json:"-"`
-	Name    string   `xml:"name"`
-	Type    string   `xml:"type,attr"`
-	Org     string   `xml:"org"`
-	Address XMLAddress
+	XMLName xml.Name   `xml:"postalInfo" json:"-"`
+	Name    string     `xml:"name" json:"name,omitempty"`
+	Type    string     `xml:"type,attr" json:"type"`
+	Org     string     `xml:"org" json:"org,omitempty"`
+	Address XMLAddress `json:"addr"`
 }
 
 type XMLContactStatus struct {
-	S string `xml:"s,attr"`
+	S string `xml:"s,attr" json:"s"`
 }
 
 type XMLDisclose struct {
-	Flag  bool                 `xml:"flag,attr"`
-	Name  []XMLContactWithType `xml:"name"`
-	Org   []XMLContactWithType `xml:"org"`
-	Addr  []XMLContactWithType `xml:"addr"`
-	Voice []string             `xml:"voice"`
-	Fax   []string             `xml:"fax"`
-	Email []string             `xml:"email"`
+	Flag  bool                 `xml:"flag,attr" json:"flag"`
+	Name  []XMLContactWithType `xml:"name" json:"name,omitempty"`
+	Org   []XMLContactWithType `xml:"org" json:"org,omitempty"`
+	Addr  []XMLContactWithType `xml:"addr" json:"addr,omitempty"`
+	Voice []string             `xml:"voice" json:"voice,omitempty"`
+	Fax   []string             `xml:"fax" json:"fax,omitempty"`
+	Email []string             `xml:"email" json:"email,omitempty"`
 }
 
 type XMLContactWithType struct {
-	Type string `xml:"type,attr"`
+	Type string `xml:"type,attr" json:"type"`
 }
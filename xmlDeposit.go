@@ -2,6 +2,8 @@ package ryde
 
 import (
 	"encoding/xml"
+	"fmt"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -65,11 +67,11 @@ func NewXMLDeposit(t, id, prevId string, resend int, watermark time.Time) (*XMLD
 // https://stackoverflow.com/questions/48609596/xml-namespace-prefix-issue-at-go
 type XMLDepositUnMarshall struct {
 	XMLName   xml.Name `xml:"urn:ietf:params:xml:ns:rde-1.0 deposit" json:"-"`
-	Type      string   `xml:"type,attr"`
-	ID        string   `xml:"id,attr"`
-	PrevID    string   `xml:"prevId,attr"`
-	Resend    int      `xml:"resend,attr"`
-	Watermark string   `xml:"watermark"`
+	Type      string   `xml:"type,attr" json:"type"`
+	ID        string   `xml:"id,attr" json:"id"`
+	PrevID    string   `xml:"prevId,attr" json:"prevId,omitempty"`
+	Resend    int      `xml:"resend,attr" json:"resend"`
+	Watermark string   `xml:"watermark" json:"watermark"`
 }
 
 // IsValidType checks if the given string is a valid type.
@@ -77,3 +79,25 @@ type XMLDepositUnMarshall struct {
 func IsValidType(t string) bool {
 	return strings.ToUpper(t) == "FULL" || strings.ToUpper(t) == "DIFF"
 }
+
+// Sets the attributes of the <rde:deposit> start element on the XMLDepositUnMarshall.
+// This allows the deposit to be read from the start element without decoding the whole element, which contains the entire deposit.
+func (d *XMLDepositUnMarshall) setAttributes(attrs []xml.Attr) error {
+	for _, attr := range attrs {
+		switch attr.Name.Local {
+		case "type":
+			d.Type = attr.Value
+		case "id":
+			d.ID = attr.Value
+		case "prevId":
+			d.PrevID = attr.Value
+		case "resend":
+			resend, err := strconv.Atoi(attr.Value)
+			if err != nil {
+				return fmt.Errorf("error decoding deposit resend attribute: %s", err)
+			}
+			d.Resend = resend
+		}
+	}
+	return nil
+}
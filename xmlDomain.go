@@ -5,74 +5,74 @@ import (
 )
 
 type XMLDomain struct {
-	XMLName      xml.Name             `xml:"domain"`
-	Name         string               `xml:"name"` // element that contains the fully qualified name of the domain name object. For IDNs, the A-label is used
-	RoID         string               `xml:"roid"` // element that contains the ROID assigned to the domain name object when it was created
-	UName        string               `xml:"uName"`
-	IdnTableId   string               `xml:"idnTableId"`
-	OriginalName string               `xml:"originalName"`
-	Status       []XMLDomainStatus    `xml:"status"`
-	RgpStatus    []XMLDomainRGPStatus `xml:"rgpStatus"`
-	Registrant   string               `xml:"registrant"`
-	Contact      []XMLDomainContact   `xml:"contact"`
-	Ns           []XMLDomainHost      `xml:"ns"`
-	ClID         string               `xml:"clID"`
-	CrRr         string               `xml:"crRr"`
-	CrDate       string               `xml:"crDate"`
-	ExDate       string               `xml:"exDate"`
-	UpRr         string               `xml:"upRr"`
-	UpDate       string               `xml:"upDate"`
-	SecDNS       XMLSecDNS            `xml:"secDNS"`
-	TrnData      TrnData              `xml:"trnData"`
+	XMLName      xml.Name             `xml:"domain" json:"-"`
+	Name         string               `xml:"name" json:"name"` // element that contains the fully qualified name of the domain name object. For IDNs, the A-label is used
+	RoID         string               `xml:"roid" json:"roid"` // element that contains the ROID assigned to the domain name object when it was created
+	UName        string               `xml:"uName" json:"uName,omitempty"`
+	IdnTableId   string               `xml:"idnTableId" json:"idnTableId,omitempty"`
+	OriginalName string               `xml:"originalName" json:"originalName,omitempty"`
+	Status       []XMLDomainStatus    `xml:"status" json:"status,omitempty"`
+	RgpStatus    []XMLDomainRGPStatus `xml:"rgpStatus" json:"rgpStatus,omitempty"`
+	Registrant   string               `xml:"registrant" json:"registrant,omitempty"`
+	Contact      []XMLDomainContact   `xml:"contact" json:"contact,omitempty"`
+	Ns           []XMLDomainHost      `xml:"ns" json:"ns,omitempty"`
+	ClID         string               `xml:"clID" json:"clID"`
+	CrRr         string               `xml:"crRr" json:"crRr,omitempty"`
+	CrDate       string               `xml:"crDate" json:"crDate,omitempty"`
+	ExDate       string               `xml:"exDate" json:"exDate,omitempty"`
+	UpRr         string               `xml:"upRr" json:"upRr,omitempty"`
+	UpDate       string               `xml:"upDate" json:"upDate,omitempty"`
+	SecDNS       XMLSecDNS            `xml:"secDNS" json:"secDNS,omitzero"`
+	TrnData      TrnData              `xml:"trnData" json:"trnData,omitzero"`
 }
 
 type XMLDomainStatus struct {
-	S string `xml:"s,attr"`
+	S string `xml:"s,attr" json:"s"`
 }
 
 type XMLDomainRGPStatus struct {
-	S string `xml:"s,attr"`
+	S string `xml:"s,attr" json:"s"`
 }
 
 type XMLDomainHost struct {
-	HostObjs []string `xml:"hostObj"`
+	HostObjs []string `xml:"hostObj" json:"hostObj"`
 }
 
 type XMLDomainContact struct {
-	Type string `xml:"type,attr"`
-	ID   string `xml:",chardata"`
+	Type string `xml:"type,attr" json:"type"`
+	ID   string `xml:",chardata" json:"id"`
 }
 
 type DSData struct {
-	KeyTag     int    `xml:"keyTag"`
-	Alg        int    `xml:"alg"`
-	DigestType int    `xml:"digestType"`
-	Digest     string `xml:"digest"`
+	KeyTag     int    `xml:"keyTag" json:"keyTag"`
+	Alg        int    `xml:"alg" json:"alg"`
+	DigestType int    `xml:"digestType" json:"digestType"`
+	Digest     string `xml:"digest" json:"digest"`
 }
 
 type XMLSecDNS struct {
-	DSData []DSData `xml:"dsData"`
+	DSData []DSData `xml:"dsData" json:"dsData,omitempty"`
 }
 
 type TrnData struct {
-	TrStatus TrStatus `xml:"trStatus"`
-	ReRr     ReRr     `xml:"reRr"`
-	ReDate   string   `xml:"reDate"`
-	AcRr     AcRr     `xml:"acRr"`
-	AcDate   string   `xml:"acDate"`
-	ExDate   string   `xml:"exDate,omitempty"`
+	TrStatus TrStatus `xml:"trStatus" json:"trStatus"`
+	ReRr     ReRr     `xml:"reRr" json:"reRr"`
+	ReDate   string   `xml:"reDate" json:"reDate,omitempty"`
+	AcRr     AcRr     `xml:"acRr" json:"acRr"`
+	AcDate   string   `xml:"acDate" json:"acDate,omitempty"`
+	ExDate   string   `xml:"exDate,omitempty" json:"exDate,omitempty"`
 }
 
 type TrStatus struct {
-	State string `xml:",chardata"`
+	State string `xml:",chardata" json:"state"`
 }
 
 type ReRr struct {
-	RegID  string `xml:",chardata"`
-	Client string `xml:"client,attr,omitempty"`
+	RegID  string `xml:",chardata" json:"id"`
+	Client string `xml:"client,attr,omitempty" json:"client,omitempty"`
 }
 
 type AcRr struct {
-	RegID  string `xml:",chardata"`
-	Client string `xml:"client,attr,omitempty"`
+	RegID  string `xml:",chardata" json:"id"`
+	Client string `xml:"client,attr,omitempty" json:"client,omitempty"`
 }
@@ -16,10 +16,10 @@ type XMLHeaderMarshall struct {
 // https://stackoverflow.com/questions/48609596/xml-namespace-prefix-issue-at-go
 type XMLHeaderUnMarshall struct {
 	XMLName   xml.Name         `xml:"header" json:"-"`
-	TLD       string           `xml:"tld"`
-	Registrar int              `xml:"registrar"`
-	PPSP      int              `xml:"ppsp"`
-	Count     []HeaderURICount `xml:"count"`
+	TLD       string           `xml:"tld" json:"tld"`
+	Registrar int              `xml:"registrar" json:"registrar"`
+	PPSP      int              `xml:"ppsp" json:"ppsp"`
+	Count     []HeaderURICount `xml:"count" json:"count"`
 }
 
 // RDECount represents a count of objects with a given URI.
@@ -1,22 +1,22 @@
 package ryde
 
 type XMLHost struct {
-	Name   string          `xml:"name"`
-	RoID   string          `xml:"roid"`
-	Status []XMLHostStatus `xml:"status"`
-	Addr   []XMLHostAddr   `xml:"addr"`
-	ClID   string          `xml:"clID"`
-	CrRr   string          `xml:"crRr"`
-	CrDate string          `xml:"crDate"`
-	UpRr   string          `xml:"upRr"`
-	UpDate string          `xml:"upDate"`
+	Name   string          `xml:"name" json:"name"`
+	RoID   string          `xml:"roid" json:"roid"`
+	Status []XMLHostStatus `xml:"status" json:"status,omitempty"`
+	Addr   []XMLHostAddr   `xml:"addr" json:"addr,omitempty"`
+	ClID   string          `xml:"clID" json:"clID"`
+	CrRr   string          `xml:"crRr" json:"crRr,omitempty"`
+	CrDate string          `xml:"crDate" json:"crDate,omitempty"`
+	UpRr   string          `xml:"upRr" json:"upRr,omitempty"`
+	UpDate string          `xml:"upDate" json:"upDate,omitempty"`
 }
 
 type XMLHostStatus struct {
-	S string `xml:"s,attr"`
+	S string `xml:"s,attr" json:"s"`
 }
 
 type XMLHostAddr struct {
-	IP string `xml:"ip,attr"`
-	ID string `xml:",chardata"`
+	IP string `xml:"ip,attr" json:"ip"`
+	ID string `xml:",chardata" json:"address"`
 }
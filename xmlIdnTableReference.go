@@ -4,7 +4,7 @@ import "encoding/xml"
 
 type XMLIdnTableReference struct {
 	XMLName   xml.Name `xml:"idnTableRef" json:"-"`
-	ID        string   `xml:"id,attr"`
-	Url       string   `xml:"url"`
-	UrlPolicy string   `xml:"urlPolicy"`
+	ID        string   `xml:"id,attr" json:"id"`
+	Url       string   `xml:"url" json:"url,omitempty"`
+	UrlPolicy string   `xml:"urlPolicy" json:"urlPolicy,omitempty"`
 }
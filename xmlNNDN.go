@@ -3,11 +3,11 @@ package ryde
 import "encoding/xml"
 
 type XMLNNDN struct {
-	XMLName      xml.Name `xml:"NNDN"`
-	AName        string   `xml:"aName"`
-	UName        string   `xml:"uName"`
-	IDNTableID   string   `xml:"idnTableId"`
-	OriginalName string   `xml:"originalName"`
-	NameState    string   `xml:"nameState"`
-	CrDate       string   `xml:"crDate"`
+	XMLName      xml.Name `xml:"NNDN" json:"-"`
+	AName        string   `xml:"aName" json:"aName"`
+	UName        string   `xml:"uName" json:"uName,omitempty"`
+	IDNTableID   string   `xml:"idnTableId" json:"idnTableId,omitempty"`
+	OriginalName string   `xml:"originalName" json:"originalName,omitempty"`
+	NameState    string   `xml:"nameState" json:"nameState"`
+	CrDate       string   `xml:"crDate" json:"crDate,omitempty"`
 }
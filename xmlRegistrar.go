@@ -7,38 +7,38 @@ import (
 
 type XMLWhoisInfo struct {
 	XMLName xml.Name `xml:"whoisInfo" json:"-"`
-	Name    string   `xml:"name"`
-	URL     string   `xml:"url"`
+	Name    string   `xml:"name" json:"name,omitempty"`
+	URL     string   `xml:"url" json:"url,omitempty"`
 }
 
 type XMLRegistrarPostalInfo struct {
-	XMLName xml.Name `xml:"postalInfo" json:"-"`
-	Type    string   `xml:"type,attr"`
-	Address XMLAddress
+	XMLName xml.Name   `xml:"postalInfo" json:"-"`
+	Type    string     `xml:"type,attr" json:"type"`
+	Address XMLAddress `json:"addr"`
 }
 
 type XMLAddress struct {
 	XMLName       xml.Name `xml:"addr" json:"-"`
-	Street        []string `xml:"street"`
-	City          string   `xml:"city"`
-	StateProvince string   `xml:"sp"`
-	PostalCode    string   `xml:"pc"`
-	CountryCode   string   `xml:"cc"`
+	Street        []string `xml:"street" json:"street,omitempty"`
+	City          string   `xml:"city" json:"city,omitempty"`
+	StateProvince string   `xml:"sp" json:"sp,omitempty"`
+	PostalCode    string   `xml:"pc" json:"pc,omitempty"`
+	CountryCode   string   `xml:"cc" json:"cc,omitempty"`
 }
 
 // Registrar Entity
 type XMLRegistrar struct {
 	XMLName    xml.Name                 `xml:"registrar" json:"-"`
-	ID         string                   `xml:"id"`
-	Name       string                   `xml:"name"`
-	GurID      int                      `xml:"gurid"`
-	Status     string                   `xml:"status"`
-	PostalInfo []XMLRegistrarPostalInfo `xml:"postalInfo"`
-	Voice      string                   `xml:"voice"`
-	Fax        string                   `xml:"fax"`
-	Email      string                   `xml:"email"`
-	URL        string                   `xml:"url"`
-	WhoisInfo  XMLWhoisInfo
-	CrDate     string `xml:"crDate"`
-	UpDate     string `xml:"upDate"`
+	ID         string                   `xml:"id" json:"id"`
+	Name       string                   `xml:"name" json:"name"`
+	GurID      int                      `xml:"gurid" json:"gurid,omitempty"`
+	Status     string                   `xml:"status" json:"status,omitempty"`
+	PostalInfo []XMLRegistrarPostalInfo `xml:"postalInfo" json:"postalInfo,omitempty"`
+	Voice      string                   `xml:"voice" json:"voice,omitempty"`
+	Fax        string                   `xml:"fax" json:"fax,omitempty"`
+	Email      string                   `xml:"email" json:"email,omitempty"`
+	URL        string                   `xml:"url" json:"url,omitempty"`
+	WhoisInfo  XMLWhoisInfo             `json:"whoisInfo,omitzero"`
+	CrDate     string                   `xml:"crDate" json:"crDate,omitempty"`
+	UpDate     string                   `xml:"upDate" json:"upDate,omitempty"`
 }